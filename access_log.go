@@ -0,0 +1,111 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// An AccessLogEntry describes an HTTP request served by a [Handler], for
+// nginx-style access logs.
+type AccessLogEntry struct {
+	Spec Spec
+	// Peer is zero if the request was rejected before the protocol was
+	// negotiated, for example because of an unsupported Content-Type.
+	Peer Peer
+	// HTTPStatus is the response's HTTP status code. The gRPC protocols report
+	// most errors with HTTP 200, so check Err too.
+	HTTPStatus int
+	// ResponseBytes is the size of the response body as written by the
+	// Handler, after compression but before any transfer encoding.
+	ResponseBytes int64
+	// Duration is the time taken to serve the request, including writing the
+	// end of the response.
+	Duration time.Duration
+	// Err is the error sent to the client, after any hooks configured with
+	// [WithErrorHook] and redaction. It's nil if the RPC succeeded. Requests
+	// rejected before the protocol was negotiated, because of their HTTP
+	// version, method, or Content-Type, get a CodeUnimplemented error
+	// describing the rejection; error hooks don't run for them.
+	Err error
+}
+
+// WithAccessLog configures Handlers to call log once they've finished
+// serving each HTTP request, including requests rejected before reaching the
+// implementation. Unlike an HTTP middleware, the entry knows which procedure
+// was called and the error returned; unlike an interceptor, it sees the
+// status and size of the response as written.
+//
+// The log function runs synchronously with the request's context, after the
+// response has been written.
+func WithAccessLog(log func(context.Context, *AccessLogEntry)) HandlerOption {
+	return &accessLogOption{log: log}
+}
+
+type accessLogOption struct {
+	log func(context.Context, *AccessLogEntry)
+}
+
+func (o *accessLogOption) applyToHandler(config *handlerConfig) {
+	config.AccessLog = o.log
+}
+
+// countingResponseWriter records the status code and body size of a
+// response.
+type countingResponseWriter struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int64
+}
+
+func (w *countingResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *countingResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	wrote, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(wrote)
+	return wrote, err
+}
+
+func (w *countingResponseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	flushResponseWriter(w.ResponseWriter)
+}
+
+// Unwrap returns the wrapped writer, so that [http.ResponseController] can
+// reach optional interfaces like [http.Hijacker] and [io.ReaderFrom].
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status code written, defaulting to 200 like net/http.
+func (w *countingResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
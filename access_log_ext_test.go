@@ -0,0 +1,136 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+	entries := make(chan *connect.AccessLogEntry, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				if request.Msg.Number < 0 {
+					return nil, connect.NewError(connect.CodeNotFound, errors.New("no such number"))
+				}
+				return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number}), nil
+			},
+			countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				for i := int64(1); i <= request.Msg.Number; i++ {
+					if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		connect.WithAccessLog(func(_ context.Context, entry *connect.AccessLogEntry) {
+			entries <- entry
+		}),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	post := func(body, contentType string) (int, int) {
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+			strings.NewReader(body),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", contentType)
+		// Setting Accept-Encoding disables transparent decompression, so we can
+		// compare sizes on the wire.
+		request.Header.Set("Accept-Encoding", "gzip")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		data, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		return response.StatusCode, len(data)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		status, size := post(`{"number": 42}`, "application/json")
+		entry := <-entries
+		assert.Equal(t, entry.Spec.Procedure, "/"+pingv1connect.PingServiceName+"/Ping")
+		assert.Equal(t, entry.Peer.Protocol, connect.ProtocolConnect)
+		assert.Equal(t, entry.HTTPStatus, status)
+		assert.Equal(t, entry.HTTPStatus, http.StatusOK)
+		assert.Equal(t, entry.ResponseBytes, int64(size))
+		assert.True(t, entry.Duration > 0)
+		assert.Nil(t, entry.Err)
+	})
+	t.Run("error", func(t *testing.T) {
+		status, size := post(`{"number": -1}`, "application/json")
+		entry := <-entries
+		assert.Equal(t, entry.HTTPStatus, status)
+		assert.Equal(t, entry.HTTPStatus, http.StatusNotFound)
+		assert.Equal(t, entry.ResponseBytes, int64(size))
+		assert.Equal(t, connect.CodeOf(entry.Err), connect.CodeNotFound)
+	})
+	t.Run("unsupported_content_type", func(t *testing.T) {
+		status, _ := post(`{}`, "text/plain")
+		entry := <-entries
+		assert.Equal(t, entry.HTTPStatus, status)
+		assert.Equal(t, entry.HTTPStatus, http.StatusUnsupportedMediaType)
+		assert.Equal(t, entry.Spec.Procedure, "/"+pingv1connect.PingServiceName+"/Ping")
+		assert.Zero(t, entry.Peer)
+		assert.Equal(t, connect.CodeOf(entry.Err), connect.CodeUnimplemented)
+	})
+	t.Run("method_not_allowed", func(t *testing.T) {
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodDelete,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+			http.NoBody,
+		)
+		assert.Nil(t, err)
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		entry := <-entries
+		assert.Equal(t, entry.HTTPStatus, http.StatusMethodNotAllowed)
+		assert.Equal(t, connect.CodeOf(entry.Err), connect.CodeUnimplemented)
+	})
+	t.Run("stream", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		for stream.Receive() {
+		}
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		entry := <-entries
+		assert.Equal(t, entry.Spec.Procedure, "/"+pingv1connect.PingServiceName+"/CountUp")
+		assert.Equal(t, entry.HTTPStatus, http.StatusOK)
+		// Three messages and the end-of-stream message, each with a prefix.
+		assert.True(t, entry.ResponseBytes > 4*5)
+	})
+}
@@ -0,0 +1,239 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// A ResponseCache stores unary responses for clients configured with
+// [WithResponseCache]. Implementations must be safe to call concurrently, and
+// they may evict entries at any time. Clients store and return copies of
+// responses, so implementations don't need to copy them.
+type ResponseCache interface {
+	// Get returns the entry stored under the key, if any. Clients ignore
+	// expired entries.
+	Get(key string) (CachedResponse, bool)
+	// Put stores an entry under the key, replacing any existing entry.
+	Put(key string, entry CachedResponse)
+}
+
+// CachedResponse is an entry in a [ResponseCache].
+type CachedResponse struct {
+	Response AnyResponse
+	Expires  time.Time
+}
+
+// WithResponseCache configures a client to cache the responses of unary RPCs
+// in the supplied cache, and to return cached responses without calling the
+// server. Responses are only cached if the server allows it with a
+// Cache-Control header that has a positive max-age and neither no-store nor
+// no-cache, and they expire after max-age seconds (less the response's Age, if
+// any). Errors are never cached. Clients can skip the cache for a single call
+// by setting "Cache-Control: no-cache" on the request; the fresh response is
+// still stored.
+//
+// Entries are keyed by the server's address (see [Peer]), the procedure, and
+// the deterministic binary encoding of the request message, so only Protobuf
+// messages are cached. Clients for different servers may share a cache, but
+// the key doesn't include the URL's path: don't share a cache between clients
+// for different path prefixes on the same host. Request headers aren't part of
+// the key either: if responses depend on headers (for example, on
+// credentials), don't share a cache between clients that send different
+// headers. Streaming RPCs aren't cached.
+func WithResponseCache(cache ResponseCache) ClientOption {
+	return WithInterceptors(&responseCacheInterceptor{cache: cache})
+}
+
+// NewMemoryResponseCache returns a [ResponseCache] that stores up to
+// maxEntries responses in memory. When it's full, it evicts expired entries
+// first and arbitrary entries if none have expired.
+func NewMemoryResponseCache(maxEntries int) ResponseCache {
+	return &memoryResponseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]CachedResponse),
+	}
+}
+
+type memoryResponseCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]CachedResponse
+}
+
+func (c *memoryResponseCache) Get(key string) (CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *memoryResponseCache) Put(key string, entry CachedResponse) {
+	if c.maxEntries <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		now := time.Now()
+		for existing, cached := range c.entries {
+			if !now.Before(cached.Expires) {
+				delete(c.entries, existing)
+			}
+		}
+		for existing := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, existing)
+		}
+	}
+	c.entries[key] = entry
+}
+
+type responseCacheInterceptor struct {
+	cache ResponseCache
+}
+
+func (i *responseCacheInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if !request.Spec().IsClient {
+			return next(ctx, request)
+		}
+		key, ok := responseCacheKey(request)
+		if !ok {
+			return next(ctx, request)
+		}
+		if !hasCacheDirective(request.Header(), "no-cache") {
+			if entry, ok := i.cache.Get(key); ok && time.Now().Before(entry.Expires) {
+				if response, ok := cloneResponse(entry.Response); ok {
+					return response, nil
+				}
+			}
+		}
+		response, err := next(ctx, request)
+		if err != nil {
+			return response, err
+		}
+		if maxAge, ok := cacheMaxAge(response.Header()); ok {
+			if cached, ok := cloneResponse(response); ok {
+				i.cache.Put(key, CachedResponse{
+					Response: cached,
+					Expires:  time.Now().Add(maxAge),
+				})
+			}
+		}
+		return response, nil
+	}
+}
+
+func (i *responseCacheInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *responseCacheInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return next
+}
+
+func responseCacheKey(request AnyRequest) (string, bool) {
+	message, ok := request.Any().(proto.Message)
+	if !ok {
+		return "", false
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(message)
+	if err != nil {
+		return "", false
+	}
+	return request.Peer().Addr + "\x00" + request.Spec().Procedure + "\x00" + string(data), true
+}
+
+// cacheMaxAge returns how long a response may be cached, according to its
+// Cache-Control and Age headers.
+func cacheMaxAge(header http.Header) (time.Duration, bool) {
+	if hasCacheDirective(header, "no-store") || hasCacheDirective(header, "no-cache") {
+		return 0, false
+	}
+	var maxAge int64 = -1
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if !strings.EqualFold(name, "max-age") {
+				continue
+			}
+			seconds, err := strconv.ParseInt(strings.Trim(arg, `"`), 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			maxAge = seconds
+		}
+	}
+	if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && age > 0 {
+		maxAge -= age
+	}
+	if maxAge <= 0 {
+		return 0, false
+	}
+	return time.Duration(maxAge) * time.Second, true
+}
+
+func hasCacheDirective(header http.Header, directive string) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, candidate := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(candidate), "=")
+			if strings.EqualFold(name, directive) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cloneResponse returns a deep copy of a response, so cached responses can't
+// be modified by callers.
+func cloneResponse(response AnyResponse) (AnyResponse, bool) {
+	cloner, ok := response.(interface{ clone() (AnyResponse, bool) })
+	if !ok {
+		return nil, false
+	}
+	return cloner.clone()
+}
+
+func (r *Response[T]) clone() (AnyResponse, bool) {
+	if r.Msg == nil {
+		return nil, false
+	}
+	message, ok := any(r.Msg).(proto.Message)
+	if !ok {
+		return nil, false
+	}
+	msg, ok := any(proto.Clone(message)).(*T)
+	if !ok {
+		return nil, false
+	}
+	return &Response[T]{
+		Msg:        msg,
+		header:     r.header.Clone(),
+		trailer:    r.trailer.Clone(),
+		httpStatus: r.httpStatus,
+	}, true
+}
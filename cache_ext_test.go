@@ -0,0 +1,128 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestResponseCache(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			atomic.AddInt32(&calls, 1)
+			switch request.Msg.Text {
+			case "error":
+				return nil, connect.NewError(connect.CodeUnavailable, errors.New("try again"))
+			case "volatile":
+				response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number})
+				response.Header().Set("Cache-Control", "no-store")
+				return response, nil
+			}
+			response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number})
+			response.Header().Set("Cache-Control", "public, max-age=60")
+			return response, nil
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithResponseCache(connect.NewMemoryResponseCache(10)),
+	)
+	ping := func(t *testing.T, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], int32) {
+		t.Helper()
+		before := atomic.LoadInt32(&calls)
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		return response, atomic.LoadInt32(&calls) - before
+	}
+
+	response, serverCalls := ping(t, connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+	assert.Equal(t, serverCalls, 1)
+	assert.Equal(t, response.Msg.Number, 1)
+	// Modifying a response doesn't affect the cache.
+	response.Msg.Number = 100
+
+	response, serverCalls = ping(t, connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+	assert.Equal(t, serverCalls, 0)
+	assert.Equal(t, response.Msg.Number, 1)
+	assert.Equal(t, response.Header().Get("Cache-Control"), "public, max-age=60")
+
+	_, serverCalls = ping(t, connect.NewRequest(&pingv1.PingRequest{Number: 2}))
+	assert.Equal(t, serverCalls, 1)
+
+	bypass := connect.NewRequest(&pingv1.PingRequest{Number: 1})
+	bypass.Header().Set("Cache-Control", "no-cache")
+	_, serverCalls = ping(t, bypass)
+	assert.Equal(t, serverCalls, 1)
+
+	for i := 0; i < 2; i++ {
+		_, serverCalls = ping(t, connect.NewRequest(&pingv1.PingRequest{Text: "volatile"}))
+		assert.Equal(t, serverCalls, 1)
+	}
+
+	for i := 0; i < 2; i++ {
+		before := atomic.LoadInt32(&calls)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "error"}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, atomic.LoadInt32(&calls)-before, 1)
+	}
+}
+
+func TestResponseCacheSharedAcrossServers(t *testing.T) {
+	t.Parallel()
+	newServer := func(number int64) *httptest.Server {
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+			ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				response := connect.NewResponse(&pingv1.PingResponse{Number: number})
+				response.Header().Set("Cache-Control", "max-age=60")
+				return response, nil
+			},
+		}))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server
+	}
+	cache := connect.NewMemoryResponseCache(10)
+	var clients []pingv1connect.PingServiceClient
+	for _, number := range []int64{0, 1} {
+		server := newServer(number)
+		clients = append(clients, pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithResponseCache(cache)))
+	}
+	// Each client gets its own server's response, from the server and then
+	// from the cache.
+	for i := 0; i < 2; i++ {
+		for number, client := range clients {
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, int64(number))
+		}
+	}
+}
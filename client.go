@@ -19,6 +19,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"time"
 )
 
 // Client is a reusable, concurrency-safe client for a single procedure.
@@ -44,6 +45,9 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 		return client
 	}
 	client.config = config
+	if config.Router != nil {
+		url = routeURL(url, config.Procedure, config.Router)
+	}
 	protocolClient, protocolErr := client.config.Protocol.NewClient(
 		&protocolClientParams{
 			CompressionName: config.RequestCompressionName,
@@ -51,14 +55,18 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 				config.CompressionPools,
 				config.CompressionNames,
 			),
-			Codec:            config.Codec,
-			Protobuf:         config.protobuf(),
-			CompressMinBytes: config.CompressMinBytes,
-			HTTPClient:       httpClient,
-			URL:              url,
-			BufferPool:       config.BufferPool,
-			ReadMaxBytes:     config.ReadMaxBytes,
-			SendMaxBytes:     config.SendMaxBytes,
+			Codec:                      config.codec(),
+			Protobuf:                   config.protobuf(),
+			CompressMinBytes:           config.CompressMinBytes,
+			HTTPClient:                 httpClient,
+			URL:                        url,
+			BufferPool:                 config.BufferPool,
+			ReadMaxBytes:               config.ReadMaxBytes,
+			SendMaxBytes:               config.SendMaxBytes,
+			MaxTrailerBytes:            config.MaxTrailerBytes,
+			DisableDeadlinePropagation: config.DisableDeadlinePropagation,
+			OmitGRPCAcceptEncoding:     config.OmitGRPCAcceptEncoding,
+			RejectProtocolMismatch:     config.RejectProtocolMismatch,
 		},
 	)
 	if protocolErr != nil {
@@ -70,6 +78,7 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 	// once at client creation.
 	unarySpec := config.newSpec(StreamTypeUnary)
 	unaryFunc := UnaryFunc(func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		ctx = withConnectionObserver(ctx, unarySpec, config.ConnectionObserver)
 		conn := client.protocolClient.NewConn(ctx, unarySpec, request.Header())
 		// Send always returns an io.EOF unless the error is from the client-side.
 		// We want the user to continue to call Receive in those cases to get the
@@ -100,6 +109,11 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 		request.spec = unarySpec
 		request.peer = client.protocolClient.Peer()
 		protocolClient.WriteRequestHeader(StreamTypeUnary, request.Header())
+		addDefaultHeaders(request.Header(), config.RequestHeader)
+		ctx, cancel := config.withDefaultTimeout(ctx)
+		if cancel != nil {
+			defer cancel()
+		}
 		response, err := unaryFunc(ctx, request)
 		if err != nil {
 			return nil, err
@@ -135,6 +149,13 @@ func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Reques
 		return nil, c.err
 	}
 	conn := c.newConn(ctx, StreamTypeServer)
+	// Headers on the request take precedence over those configured with
+	// WithRequestHeader.
+	for key := range request.header {
+		if _, ok := c.config.RequestHeader[key]; ok {
+			delete(conn.RequestHeader(), key)
+		}
+	}
 	mergeHeaders(conn.RequestHeader(), request.header)
 	// Send always returns an io.EOF unless the error is from the client-side.
 	// We want the user to continue to call Receive in those cases to get the
@@ -147,7 +168,7 @@ func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Reques
 	if err := conn.CloseRequest(); err != nil {
 		return nil, err
 	}
-	return &ServerStreamForClient[Res]{conn: conn}, nil
+	return &ServerStreamForClient[Res]{conn: conn, maxMessages: c.config.MaxStreamMessages}, nil
 }
 
 // CallBidiStream calls a bidirectional streaming procedure.
@@ -162,26 +183,58 @@ func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType) S
 	newConn := func(ctx context.Context, spec Spec) StreamingClientConn {
 		header := make(http.Header, 8) // arbitrary power of two, prevent immediate resizing
 		c.protocolClient.WriteRequestHeader(streamType, header)
+		addDefaultHeaders(header, c.config.RequestHeader)
+		ctx = withConnectionObserver(ctx, spec, c.config.ConnectionObserver)
 		return c.protocolClient.NewConn(ctx, spec, header)
 	}
 	if interceptor := c.config.Interceptor; interceptor != nil {
 		newConn = interceptor.WrapStreamingClient(newConn)
 	}
-	return newConn(ctx, c.config.newSpec(streamType))
+	ctx, cancel := c.config.withDefaultTimeout(ctx)
+	conn := newConn(ctx, c.config.newSpec(streamType))
+	if cancel == nil {
+		return conn
+	}
+	return &timeoutClientConn{StreamingClientConn: conn, cancel: cancel}
+}
+
+// timeoutClientConn releases the resources of a stream's default timeout when
+// the stream is closed.
+type timeoutClientConn struct {
+	StreamingClientConn
+
+	cancel context.CancelFunc
+}
+
+func (c *timeoutClientConn) CloseResponse() error {
+	err := c.StreamingClientConn.CloseResponse()
+	c.cancel()
+	return err
 }
 
 type clientConfig struct {
-	Protocol               protocol
-	Procedure              string
-	CompressMinBytes       int
-	Interceptor            Interceptor
-	CompressionPools       map[string]*compressionPool
-	CompressionNames       []string
-	Codec                  Codec
-	RequestCompressionName string
-	BufferPool             *bufferPool
-	ReadMaxBytes           int
-	SendMaxBytes           int
+	Protocol                   protocol
+	Procedure                  string
+	CompressMinBytes           int
+	Interceptor                Interceptor
+	CompressionPools           map[string]*compressionPool
+	CompressionNames           []string
+	Codec                      Codec
+	RequestCompressionName     string
+	BufferPool                 *bufferPool
+	ReadMaxBytes               int
+	SendMaxBytes               int
+	MaxTrailerBytes            int
+	PayloadTransformer         *payloadTransformer
+	StrictUTF8                 bool
+	ConnectionObserver         func(ConnectionInfo)
+	RequestHeader              http.Header
+	MaxStreamMessages          int
+	Timeout                    time.Duration
+	Router                     Router
+	DisableDeadlinePropagation bool
+	OmitGRPCAcceptEncoding     bool
+	RejectProtocolMismatch     bool
 }
 
 func newClientConfig(url string, options []ClientOption) (*clientConfig, *Error) {
@@ -191,6 +244,7 @@ func newClientConfig(url string, options []ClientOption) (*clientConfig, *Error)
 		Procedure:        protoPath,
 		CompressionPools: make(map[string]*compressionPool),
 		BufferPool:       newBufferPool(),
+		MaxTrailerBytes:  defaultMaxTrailerBytes,
 	}
 	withProtoBinaryCodec().applyToClient(&config)
 	withGzip().applyToClient(&config)
@@ -215,6 +269,18 @@ func (c *clientConfig) validate() *Error {
 	return nil
 }
 
+// codec returns the codec for messages, which may transform payloads.
+func (c *clientConfig) codec() Codec {
+	codec := c.Codec
+	if c.PayloadTransformer != nil {
+		codec = c.PayloadTransformer.wrapCodec(codec)
+	}
+	if c.StrictUTF8 {
+		codec = newUTF8ValidatingCodec(codec)
+	}
+	return codec
+}
+
 func (c *clientConfig) protobuf() Codec {
 	if c.Codec.Name() == codecNameProto {
 		return c.Codec
@@ -222,10 +288,24 @@ func (c *clientConfig) protobuf() Codec {
 	return &protoBinaryCodec{}
 }
 
+// withDefaultTimeout applies the timeout configured with WithTimeout if the
+// context doesn't have a deadline. The returned cancellation function is nil
+// if the context is unchanged.
+func (c *clientConfig) withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return ctx, nil
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
 func (c *clientConfig) newSpec(t StreamType) Spec {
 	return Spec{
 		StreamType: t,
 		Procedure:  c.Procedure,
 		IsClient:   true,
+		Codec:      c.Codec.Name(),
 	}
 }
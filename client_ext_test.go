@@ -17,9 +17,13 @@ package connect_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/bufbuild/connect-go/internal/assert"
@@ -163,3 +167,565 @@ func (a *assertPeerInterceptor) WrapStreamingHandler(next connect.StreamingHandl
 		return next(ctx, conn)
 	}
 }
+
+func TestClientProcedureHeaders(t *testing.T) {
+	t.Parallel()
+	const header = "Acme-Feature"
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			response.Header()[header] = request.Header().Values(header)
+			return response, nil
+		},
+		countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			stream.ResponseHeader()[header] = request.Header().Values(header)
+			return stream.Send(&pingv1.CountUpResponse{})
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithProcedureOptions(
+			"/"+pingv1connect.PingServiceName+"/Ping",
+			connect.WithRequestHeader(header, "on"),
+		),
+	)
+	ping := func(request *connect.Request[pingv1.PingRequest]) []string {
+		t.Helper()
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		return response.Header().Values(header)
+	}
+	countUp := func(request *connect.Request[pingv1.CountUpRequest]) []string {
+		t.Helper()
+		stream, err := client.CountUp(context.Background(), request)
+		assert.Nil(t, err)
+		for stream.Receive() {
+		}
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		return stream.ResponseHeader().Values(header)
+	}
+
+	assert.Equal(t, ping(connect.NewRequest(&pingv1.PingRequest{})), []string{"on"})
+	assert.Equal(t, ping(connect.NewRequest(&pingv1.PingRequest{})), []string{"on"})
+	overridden := connect.NewRequest(&pingv1.PingRequest{})
+	overridden.Header().Set(header, "off")
+	assert.Equal(t, ping(overridden), []string{"off"})
+	// The option doesn't apply to other procedures.
+	assert.Zero(t, countUp(connect.NewRequest(&pingv1.CountUpRequest{})))
+}
+
+func TestClientDeadlinePropagation(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			_, hasDeadline := ctx.Deadline()
+			if request.Msg.Number > 0 {
+				// Wait for the client to give up.
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			if hasDeadline {
+				response.Header().Set("Server-Deadline", "true")
+			}
+			return response, nil
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	testPropagation := func(t *testing.T, options ...connect.ClientOption) {
+		t.Helper()
+		ping := func(t *testing.T, client pingv1connect.PingServiceClient) string {
+			t.Helper()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			response, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			return response.Header().Get("Server-Deadline")
+		}
+		t.Run("default", func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, options...)
+			assert.Equal(t, ping(t, client), "true")
+		})
+		t.Run("disabled", func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL,
+				append(options, connect.WithSendDeadlinePropagation(false))...,
+			)
+			assert.Zero(t, ping(t, client))
+			// The deadline is still enforced locally.
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		})
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		testPropagation(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		testPropagation(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		testPropagation(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestClientMaxStreamMessages(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			// Number is the number of messages to send, or zero to send forever.
+			for i := int64(1); request.Msg.Number == 0 || i <= request.Msg.Number; i++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithMaxStreamMessages(3),
+	)
+	countUp := func(t *testing.T, number int64) (int, error) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: number}))
+		assert.Nil(t, err)
+		var received int
+		for stream.Receive() {
+			received++
+		}
+		cancel()
+		_ = stream.Close()
+		return received, stream.Err()
+	}
+	t.Run("within_limit", func(t *testing.T) {
+		t.Parallel()
+		received, err := countUp(t, 3)
+		assert.Nil(t, err)
+		assert.Equal(t, received, 3)
+	})
+	t.Run("unbounded", func(t *testing.T) {
+		t.Parallel()
+		received, err := countUp(t, 0)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		assert.Equal(t, received, 3)
+	})
+}
+
+func TestClientNonRPCErrorPage(t *testing.T) {
+	t.Parallel()
+	const page = "<html><body>upstream connect error</body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		body := page
+		if request.Header.Get("Long") != "" {
+			body = strings.Repeat("x", 1024)
+		}
+		response.Header().Set("Content-Type", "text/html")
+		response.WriteHeader(http.StatusBadGateway)
+		_, _ = io.WriteString(response, body)
+	}))
+	t.Cleanup(server.Close)
+	protocols := map[string]connect.ClientOption{
+		"connect": connect.WithProtoJSON(),
+		"grpc":    connect.WithGRPC(),
+		"grpcweb": connect.WithGRPCWeb(),
+	}
+	for name, opt := range protocols {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+			assert.True(t, strings.Contains(err.Error(), "502 Bad Gateway"))
+			assert.True(t, strings.Contains(err.Error(), fmt.Sprintf("%q", page)), assert.Sprintf("%v", err))
+
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeUnavailable)
+			assert.True(t, strings.Contains(stream.Err().Error(), fmt.Sprintf("%q", page)))
+			assert.Nil(t, stream.Close())
+
+			request := connect.NewRequest(&pingv1.PingRequest{})
+			request.Header().Set("Long", "true")
+			_, err = client.Ping(context.Background(), request)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+			assert.True(t, strings.HasSuffix(err.Error(), "(truncated)"))
+			assert.True(t, len(err.Error()) < 600)
+		})
+	}
+}
+
+func TestClientLargeErrorBody(t *testing.T) {
+	t.Parallel()
+	// Connect unary errors with long messages or details are larger than the
+	// snippet we keep for non-RPC error pages.
+	message := strings.Repeat("x", 600)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			err := connect.NewError(connect.CodeAlreadyExists, errors.New(message))
+			detail, detailErr := connect.NewErrorDetail(&pingv1.PingResponse{Text: message})
+			if detailErr != nil {
+				return nil, detailErr
+			}
+			err.AddDetail(detail)
+			err.Meta().Set("Large", "true")
+			return nil, err
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	var connectErr *connect.Error
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, connectErr.Code(), connect.CodeAlreadyExists)
+	assert.Equal(t, connectErr.Message(), message)
+	assert.Equal(t, len(connectErr.Details()), 1)
+	assert.Equal(t, connectErr.Meta().Get("Large"), "true")
+}
+
+func TestClientProtocolMismatch(t *testing.T) {
+	t.Parallel()
+	// A server that only supports Connect rejects other protocols with a
+	// Connect error, and a gRPC-only server does the reverse. The Connect error
+	// is larger than the snippets we keep for errors, and the code comes last.
+	connectOnly := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.Header().Set("Content-Type", "application/json")
+		response.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprintf(response, `{"message": %q, "code": "unimplemented"}`, strings.Repeat("x", 1024))
+	}))
+	t.Cleanup(connectOnly.Close)
+	grpcOnly := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.Header().Set("Content-Type", "application/grpc")
+		response.Header().Set("Grpc-Status", "12")
+		response.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(grpcOnly.Close)
+	tests := []struct {
+		name    string
+		server  *httptest.Server
+		options []connect.ClientOption
+		want    string
+	}{
+		{
+			name:    "grpc_client",
+			server:  connectOnly,
+			options: []connect.ClientOption{connect.WithGRPC()},
+			want:    `protocol mismatch: gRPC client received a Connect response (HTTP status 404, Content-Type "application/json"): the server may not support gRPC`,
+		},
+		{
+			name:    "grpcweb_client",
+			server:  connectOnly,
+			options: []connect.ClientOption{connect.WithGRPCWeb()},
+			want:    `protocol mismatch: gRPC-Web client received a Connect response`,
+		},
+		{
+			name:   "connect_client",
+			server: grpcOnly,
+			want:   `protocol mismatch: Connect client received a gRPC response (HTTP status 200, Content-Type "application/grpc"): use connect.WithGRPC()`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			options := append([]connect.ClientOption{connect.WithRejectProtocolMismatch()}, test.options...)
+			client := pingv1connect.NewPingServiceClient(test.server.Client(), test.server.URL, options...)
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+			assert.True(t, strings.Contains(err.Error(), test.want), assert.Sprintf("%v", err))
+
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInternal)
+			assert.True(t, strings.Contains(stream.Err().Error(), test.want), assert.Sprintf("%v", stream.Err()))
+			assert.Nil(t, stream.Close())
+		})
+	}
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		// Without WithRejectProtocolMismatch, clients use their own protocol's
+		// error handling.
+		client := pingv1connect.NewPingServiceClient(connectOnly.Client(), connectOnly.URL, connect.WithGRPC())
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+		assert.False(t, strings.Contains(err.Error(), "protocol mismatch"))
+	})
+	t.Run("gateway_error", func(t *testing.T) {
+		t.Parallel()
+		// Gateways often send JSON error pages, which aren't a protocol mismatch.
+		gateway := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.Header().Set("Content-Type", "application/json")
+			response.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = io.WriteString(response, `{"message": "no healthy upstream"}`)
+		}))
+		t.Cleanup(gateway.Close)
+		for _, option := range []connect.ClientOption{connect.WithGRPC(), connect.WithGRPCWeb()} {
+			client := pingv1connect.NewPingServiceClient(gateway.Client(), gateway.URL, option, connect.WithRejectProtocolMismatch())
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+			assert.True(t, strings.Contains(err.Error(), "no healthy upstream"), assert.Sprintf("%v", err))
+		}
+	})
+}
+
+func TestClientTimeout(t *testing.T) {
+	t.Parallel()
+	deadlines := make(chan time.Duration, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				deadlines <- 0
+			} else {
+				deadlines <- time.Until(deadline)
+			}
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], _ *connect.ServerStream[pingv1.CountUpResponse]) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithTimeout(time.Minute))
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	got := <-deadlines
+	assert.True(t, got > 50*time.Second && got <= time.Minute, assert.Sprintf("got %v", got))
+
+	// Existing deadlines are unchanged, even if they're longer.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	_, err = client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	got = <-deadlines
+	assert.True(t, got > 50*time.Minute, assert.Sprintf("got %v", got))
+
+	// Streams are covered too.
+	streamClient := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithTimeout(50*time.Millisecond))
+	stream, err := streamClient.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+	assert.Nil(t, err)
+	assert.False(t, stream.Receive())
+	assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeDeadlineExceeded)
+	assert.Nil(t, stream.Close())
+}
+
+func TestClientStreamSendReturnsServerError(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		sum: func(_ context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			stream.Receive()
+			return nil, connect.NewError(connect.CodeResourceExhausted, errors.New("upload too large"))
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	protocols := map[string]connect.ClientOption{
+		"connect": connect.WithProtoJSON(),
+		"grpc":    connect.WithGRPC(),
+		"grpcweb": connect.WithGRPCWeb(),
+	}
+	for name, opt := range protocols {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			stream := client.Sum(context.Background())
+			var err error
+			for i := 0; i < 1000 && err == nil; i++ {
+				err = stream.Send(&pingv1.SumRequest{Number: 1})
+				if err == nil {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			assert.NotNil(t, err)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Message(), "upload too large")
+			// Code checking for io.EOF keeps working.
+			assert.True(t, errors.Is(err, io.EOF))
+			assert.Equal(t, connect.CodeOf(stream.Send(&pingv1.SumRequest{})), connect.CodeResourceExhausted)
+
+			_, err = stream.CloseAndReceive()
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		})
+	}
+}
+
+func TestWithoutGRPCAcceptEncoding(t *testing.T) {
+	t.Parallel()
+	newServer := func(t *testing.T, options ...connect.HandlerOption) (*httptest.Server, <-chan http.Header) {
+		t.Helper()
+		requestHeaders := make(chan http.Header, 1)
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, options...))
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestHeaders <- r.Header.Clone()
+			mux.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+		return server, requestHeaders
+	}
+	for _, opt := range []connect.ClientOption{connect.WithGRPC(), connect.WithGRPCWeb()} {
+		// By default, both sides advertise the encodings they support.
+		server, requestHeaders := newServer(t)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, (<-requestHeaders).Get("Grpc-Accept-Encoding"), "gzip")
+		assert.Equal(t, response.Header().Get("Grpc-Accept-Encoding"), "gzip")
+
+		server, requestHeaders = newServer(t, connect.WithoutGRPCAcceptEncoding())
+		client = pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt, connect.WithoutGRPCAcceptEncoding())
+		response, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		_, sent := (<-requestHeaders)["Grpc-Accept-Encoding"]
+		assert.False(t, sent)
+		_, received := response.Header()["Grpc-Accept-Encoding"]
+		assert.False(t, received)
+	}
+}
+
+func TestClientMaxTrailerBytes(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			// Number is the size of the padding trailer.
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			response.Trailer().Set("Padding", strings.Repeat("a", int(request.Msg.Number)))
+			return response, nil
+		},
+		countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			// Number is the size of the padding trailer. If it's negative, we don't
+			// send any messages, so gRPC-Web sends a trailers-only response.
+			if request.Msg.Number < 0 {
+				stream.ResponseTrailer().Set("Padding", strings.Repeat("a", int(-request.Msg.Number)))
+				return nil
+			}
+			stream.ResponseTrailer().Set("Padding", strings.Repeat("a", int(request.Msg.Number)))
+			return stream.Send(&pingv1.CountUpResponse{})
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	countUp := func(t *testing.T, padding int64, options ...connect.ClientOption) error {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, options...)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: padding}))
+		assert.Nil(t, err)
+		for stream.Receive() {
+		}
+		assert.Nil(t, stream.Close())
+		return stream.Err()
+	}
+	protocols := map[string]connect.ClientOption{
+		connect.ProtocolConnect: connect.WithProtoJSON(),
+		connect.ProtocolGRPC:    connect.WithGRPC(),
+		connect.ProtocolGRPCWeb: connect.WithGRPCWeb(),
+	}
+	for name, protocol := range protocols {
+		name, protocol := name, protocol
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Nil(t, countUp(t, 4096, protocol))
+			err := countUp(t, 4096, protocol, connect.WithMaxTrailerBytes(1024))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+			if name == connect.ProtocolGRPC {
+				assert.True(t, strings.HasSuffix(err.Error(), "(server status: ok)"))
+			}
+			// The default limit is generous but bounded.
+			err = countUp(t, 2*1024*1024, protocol)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+			assert.Nil(t, countUp(t, 2*1024*1024, protocol, connect.WithMaxTrailerBytes(0)))
+
+			// Responses without any messages.
+			assert.Nil(t, countUp(t, -4096, protocol))
+			err = countUp(t, -4096, protocol, connect.WithMaxTrailerBytes(1024))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+			// Unary responses.
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, protocol)
+			_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 4096}))
+			assert.Nil(t, err)
+			client = pingv1connect.NewPingServiceClient(server.Client(), server.URL, protocol, connect.WithMaxTrailerBytes(1024))
+			_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 4096}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		})
+	}
+	t.Run("read_max_bytes", func(t *testing.T) {
+		t.Parallel()
+		// A smaller read limit still applies to trailers read into memory.
+		err := countUp(t, 4096, connect.WithReadMaxBytes(1024))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		err = countUp(t, 4096, connect.WithGRPCWeb(), connect.WithReadMaxBytes(1024))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Parallel()
+	client := connect.NewHTTPClient(nil)
+	// Whole-response timeouts would cut off long-lived streams.
+	assert.Zero(t, client.Timeout)
+	transport, ok := client.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.NotZero(t, transport.TLSHandshakeTimeout)
+	assert.True(t, transport.MaxIdleConnsPerHost > http.DefaultMaxIdleConnsPerHost)
+
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	// Supplied transports are used as-is.
+	client = connect.NewHTTPClient(server.Client().Transport)
+	assert.True(t, client.Transport == server.Client().Transport)
+	pingClient := pingv1connect.NewPingServiceClient(client, server.URL, connect.WithGRPC())
+	stream := pingClient.CumSum(context.Background())
+	assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+	response, err := stream.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, response.Sum, 1)
+	assert.Nil(t, stream.CloseRequest())
+	assert.Nil(t, stream.CloseResponse())
+}
@@ -28,6 +28,11 @@ type ClientStreamForClient[Req, Res any] struct {
 	conn StreamingClientConn
 	// Error from client construction. If non-nil, return for all calls.
 	err error
+	// Result of receiving the response early, after Send finds that the server
+	// has already ended the stream.
+	received    bool
+	response    *Response[Res]
+	responseErr error
 }
 
 // Spec returns the specification for the RPC.
@@ -55,25 +60,48 @@ func (c *ClientStreamForClient[Req, Res]) RequestHeader() http.Header {
 // Send a message to the server. The first call to Send also sends the request
 // headers.
 //
-// If the server returns an error, Send returns an error that wraps [io.EOF].
-// Clients should check for case using the standard library's [errors.Is] and
-// unmarshal the error using CloseAndReceive.
+// If the server has already ended the stream with an error, for example by
+// rejecting an upload after its first message, Send returns the server's
+// error: [CodeOf] and [errors.As] see its code, message, details, and
+// metadata. The error also wraps [io.EOF], so clients written to check for
+// io.EOF with the standard library's [errors.Is] and then unmarshal the error
+// with CloseAndReceive continue to work. If the server ended the stream
+// successfully, Send returns io.EOF and CloseAndReceive returns the response.
 func (c *ClientStreamForClient[Req, Res]) Send(request *Req) error {
 	if c.err != nil {
 		return c.err
 	}
-	if request == nil {
-		return c.conn.Send(nil)
+	if !c.received {
+		var err error
+		if request == nil {
+			err = c.conn.Send(nil)
+		} else {
+			err = c.conn.Send(request)
+		}
+		if err == nil || !errors.Is(err, io.EOF) {
+			return err
+		}
+		c.receiveEarly()
+	}
+	if connectErr, ok := asError(c.responseErr); ok {
+		return &streamEndedError{err: connectErr}
 	}
-	return c.conn.Send(request)
+	return io.EOF
 }
 
 // CloseAndReceive closes the send side of the stream and waits for the
-// response.
+// response. The response's trailers are complete when it returns.
 func (c *ClientStreamForClient[Req, Res]) CloseAndReceive() (*Response[Res], error) {
 	if c.err != nil {
 		return nil, c.err
 	}
+	if c.received {
+		if c.responseErr != nil {
+			_ = c.conn.CloseResponse()
+			return nil, c.responseErr
+		}
+		return c.response, c.conn.CloseResponse()
+	}
 	if err := c.conn.CloseRequest(); err != nil {
 		_ = c.conn.CloseResponse()
 		return nil, err
@@ -92,6 +120,17 @@ func (c *ClientStreamForClient[Req, Res]) Conn() (StreamingClientConn, error) {
 	return c.conn, c.err
 }
 
+// receiveEarly closes the send side of the stream and receives the response,
+// which the server has already sent.
+func (c *ClientStreamForClient[Req, Res]) receiveEarly() {
+	c.received = true
+	if err := c.conn.CloseRequest(); err != nil {
+		c.responseErr = err
+		return
+	}
+	c.response, c.responseErr = receiveUnaryResponse[Res](c.conn)
+}
+
 // ServerStreamForClient is the client's view of a server streaming RPC.
 //
 // It's returned from [Client].CallServerStream, but doesn't currently have an
@@ -103,6 +142,9 @@ type ServerStreamForClient[Res any] struct {
 	constructErr error
 	// Error from conn.Receive().
 	receiveErr error
+	// Limit from WithMaxStreamMessages, and the number of messages received.
+	maxMessages int
+	received    int
 }
 
 // Receive advances the stream to the next message, which will then be
@@ -110,12 +152,23 @@ type ServerStreamForClient[Res any] struct {
 // either by reaching the end or by encountering an unexpected error. After
 // Receive returns false, the Err method will return any unexpected error
 // encountered.
+//
+// If the server sends some messages and then fails, Receive returns each of
+// those messages before reporting the error, so clients of best-effort
+// streaming APIs can keep partial results.
 func (s *ServerStreamForClient[Res]) Receive() bool {
 	if s.constructErr != nil || s.receiveErr != nil {
 		return false
 	}
 	s.msg = new(Res)
 	s.receiveErr = s.conn.Receive(s.msg)
+	if s.receiveErr == nil && s.maxMessages > 0 {
+		s.received++
+		if s.received > s.maxMessages {
+			s.msg = nil
+			s.receiveErr = errorf(CodeResourceExhausted, "server stream sent more than %d messages", s.maxMessages)
+		}
+	}
 	return s.receiveErr == nil
 }
 
@@ -139,7 +192,11 @@ func (s *ServerStreamForClient[Res]) Err() error {
 }
 
 // ResponseHeader returns the headers received from the server. It blocks until
-// the first call to Receive returns.
+// the server sends its headers, which usually happens along with the first
+// message. Handlers may send headers earlier, without a message, so clients
+// can act on them while the server is still preparing the stream. If the RPC
+// fails before the server sends headers, ResponseHeader returns as soon as the
+// failure is known.
 func (s *ServerStreamForClient[Res]) ResponseHeader() http.Header {
 	if s.constructErr != nil {
 		return http.Header{}
@@ -148,7 +205,10 @@ func (s *ServerStreamForClient[Res]) ResponseHeader() http.Header {
 }
 
 // ResponseTrailer returns the trailers received from the server. Trailers
-// aren't fully populated until Receive() returns an error wrapping io.EOF.
+// aren't fully populated until Receive returns false, which happens when the
+// stream ends cleanly or with an error. As with [Response.Trailer], the same
+// code reads trailers for every protocol, so they're available at the same
+// point whether they arrived as HTTP trailers or in the response body.
 func (s *ServerStreamForClient[Res]) ResponseTrailer() http.Header {
 	if s.constructErr != nil {
 		return http.Header{}
@@ -249,7 +309,8 @@ func (b *BidiStreamForClient[Req, Res]) CloseResponse() error {
 }
 
 // ResponseHeader returns the headers received from the server. It blocks until
-// the first call to Receive returns.
+// the server sends its headers, which usually happens along with the first
+// message.
 func (b *BidiStreamForClient[Req, Res]) ResponseHeader() http.Header {
 	if b.err != nil {
 		return http.Header{}
@@ -258,7 +319,8 @@ func (b *BidiStreamForClient[Req, Res]) ResponseHeader() http.Header {
 }
 
 // ResponseTrailer returns the trailers received from the server. Trailers
-// aren't fully populated until Receive() returns an error wrapping [io.EOF].
+// aren't fully populated until Receive returns an error, either one wrapping
+// [io.EOF] when the stream ends cleanly or the error that ended the stream.
 func (b *BidiStreamForClient[Req, Res]) ResponseTrailer() http.Header {
 	if b.err != nil {
 		return http.Header{}
@@ -271,3 +333,23 @@ func (b *BidiStreamForClient[Req, Res]) ResponseTrailer() http.Header {
 func (b *BidiStreamForClient[Req, Res]) Conn() (StreamingClientConn, error) {
 	return b.conn, b.err
 }
+
+// streamEndedError is returned from ClientStreamForClient.Send when the server
+// has already ended the stream with an error. It unwraps to the server's
+// error, but also matches io.EOF for compatibility with code written before
+// Send returned the server's error.
+type streamEndedError struct {
+	err *Error
+}
+
+func (e *streamEndedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *streamEndedError) Unwrap() error {
+	return e.err
+}
+
+func (e *streamEndedError) Is(target error) bool {
+	return target == io.EOF //nolint:errorlint
+}
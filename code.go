@@ -224,3 +224,19 @@ func CodeOf(err error) Code {
 	}
 	return CodeUnknown
 }
+
+// IsServerErrorCode is the default classification of codes that indicate a
+// server-side failure, rather than a problem with the request: it reports
+// true for [CodeUnknown], [CodeInternal], and [CodeDataLoss]. Handlers use it
+// to decide which errors [WithRedactedServerErrors] redacts, and logging and
+// metrics interceptors can use it (by way of [IsServerError]) to decide which
+// errors should alert the server's owners. Use [WithServerErrorClassifier] to
+// classify codes differently.
+func IsServerErrorCode(code Code) bool {
+	switch code {
+	case CodeUnknown, CodeInternal, CodeDataLoss:
+		return true
+	default:
+		return false
+	}
+}
@@ -16,9 +16,11 @@ package connect
 
 import (
 	"fmt"
+	"unicode/utf8"
 
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 const (
@@ -28,6 +30,17 @@ const (
 )
 
 // Codec marshals structs (typically generated from a schema) to and from bytes.
+//
+// Codecs only marshal messages. Errors are always encoded as each protocol
+// requires, regardless of the codec in use: the Connect protocol uses JSON
+// (both for unary error bodies and for the end-of-stream message), and gRPC
+// and gRPC-Web send a binary-encoded google.rpc.Status in the
+// Grpc-Status-Details-Bin trailer. Custom codecs therefore don't need to
+// handle errors, and any client can read errors from any handler, even if it
+// can't unmarshal their messages. The same applies to error details, which are
+// binary Protobuf messages. The one exception is details constructed with
+// [NewJSONErrorDetail], which use a JSON encoding that only this package
+// understands.
 type Codec interface {
 	// Name returns the name of the Codec.
 	//
@@ -142,6 +155,136 @@ func (m *codecMap) Names() []string {
 	return names
 }
 
+// payloadTransformer transforms messages after they're marshaled and before
+// they're unmarshaled.
+type payloadTransformer struct {
+	transform   func([]byte) ([]byte, error)
+	untransform func([]byte) ([]byte, error)
+}
+
+func (t *payloadTransformer) wrapCodec(codec Codec) Codec {
+	return &transformingCodec{Codec: codec, transformer: t}
+}
+
+// wrapCodecs wraps each codec with the transformer. The Protobuf codec used for
+// protocol-specific messages, like gRPC statuses, isn't transformed: clients
+// must be able to read errors even if they can't untransform messages.
+func (t *payloadTransformer) wrapCodecs(codecs readOnlyCodecs) readOnlyCodecs {
+	return wrapCodecs(codecs, t.wrapCodec)
+}
+
+// wrapCodecs wraps each codec used for messages. The Protobuf codec used for
+// protocol-specific messages is left alone.
+func wrapCodecs(codecs readOnlyCodecs, wrap func(Codec) Codec) readOnlyCodecs {
+	names := codecs.Names()
+	nameToCodec := make(map[string]Codec, len(names))
+	for _, name := range names {
+		nameToCodec[name] = wrap(codecs.Get(name))
+	}
+	return &transformedCodecs{
+		readOnlyCodecs: newReadOnlyCodecs(nameToCodec),
+		protobuf:       codecs.Protobuf(),
+	}
+}
+
+type transformingCodec struct {
+	Codec
+
+	transformer *payloadTransformer
+}
+
+func (c *transformingCodec) Marshal(message any) ([]byte, error) {
+	data, err := c.Codec.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return c.transformer.transform(data)
+}
+
+func (c *transformingCodec) Unmarshal(data []byte, message any) error {
+	data, err := c.transformer.untransform(data)
+	if err != nil {
+		return err
+	}
+	return c.Codec.Unmarshal(data, message)
+}
+
+// utf8ValidatingCodec checks that the string fields of unmarshaled Protobuf
+// messages are valid UTF-8.
+type utf8ValidatingCodec struct {
+	Codec
+}
+
+func newUTF8ValidatingCodec(codec Codec) Codec {
+	return &utf8ValidatingCodec{Codec: codec}
+}
+
+func (c *utf8ValidatingCodec) Unmarshal(data []byte, message any) error {
+	if err := c.Codec.Unmarshal(data, message); err != nil {
+		return err
+	}
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil
+	}
+	return validateUTF8(protoMessage.ProtoReflect(), "")
+}
+
+// validateUTF8 checks the populated string fields of a message, recursing into
+// nested messages, lists, and maps. Errors name the offending field with a
+// path like "items[2].tags[key]".
+func validateUTF8(message protoreflect.Message, path string) error {
+	var err error
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		fieldPath := string(field.Name())
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+		switch {
+		case field.IsList():
+			list := value.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = validateUTF8Value(field, list.Get(i), fmt.Sprintf("%s[%d]", fieldPath, i))
+			}
+		case field.IsMap():
+			value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+				if field.MapKey().Kind() == protoreflect.StringKind && !utf8.ValidString(key.String()) {
+					err = fmt.Errorf("map key in field %s contains invalid UTF-8", fieldPath)
+					return false
+				}
+				err = validateUTF8Value(field.MapValue(), value, fmt.Sprintf("%s[%v]", fieldPath, key))
+				return err == nil
+			})
+		default:
+			err = validateUTF8Value(field, value, fieldPath)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func validateUTF8Value(field protoreflect.FieldDescriptor, value protoreflect.Value, path string) error {
+	switch field.Kind() { //nolint:exhaustive // other kinds can't contain strings
+	case protoreflect.StringKind:
+		if !utf8.ValidString(value.String()) {
+			return fmt.Errorf("field %s contains invalid UTF-8", path)
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return validateUTF8(value.Message(), path)
+	}
+	return nil
+}
+
+type transformedCodecs struct {
+	readOnlyCodecs
+
+	protobuf Codec
+}
+
+func (c *transformedCodecs) Protobuf() Codec {
+	return c.protobuf
+}
+
 func errNotProto(message any) error {
 	return fmt.Errorf("%T doesn't implement proto.Message", message)
 }
@@ -0,0 +1,81 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"testing"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestValidateUTF8(t *testing.T) {
+	t.Parallel()
+	const invalid = "\xff"
+	list := func(values ...string) *structpb.Value {
+		items := make([]*structpb.Value, 0, len(values))
+		for _, value := range values {
+			items = append(items, structpb.NewStringValue(value))
+		}
+		return structpb.NewListValue(&structpb.ListValue{Values: items})
+	}
+	testCases := []struct {
+		name    string
+		message *structpb.Struct
+		wantErr string
+	}{
+		{
+			name: "valid",
+			message: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"name": structpb.NewStringValue("café"),
+				"tags": list("a", "b"),
+			}},
+		},
+		{
+			name: "map_value",
+			message: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"name": structpb.NewStringValue(invalid),
+			}},
+			wantErr: "field fields[name].string_value contains invalid UTF-8",
+		},
+		{
+			name: "nested_list",
+			message: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"tags": list("a", invalid),
+			}},
+			wantErr: "field fields[tags].list_value.values[1].string_value contains invalid UTF-8",
+		},
+		{
+			name: "map_key",
+			message: &structpb.Struct{Fields: map[string]*structpb.Value{
+				invalid: structpb.NewNullValue(),
+			}},
+			wantErr: "map key in field fields contains invalid UTF-8",
+		},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateUTF8(testCase.message.ProtoReflect(), "")
+			if testCase.wantErr == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.NotNil(t, err)
+			assert.Equal(t, err.Error(), testCase.wantErr)
+		})
+	}
+}
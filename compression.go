@@ -93,9 +93,9 @@ func (c *compressionPool) Decompress(dst *bytes.Buffer, src *bytes.Buffer, readM
 		discardedBytes, err := io.Copy(io.Discard, decompressor)
 		_ = c.putDecompressor(decompressor)
 		if err != nil {
-			return errorf(CodeResourceExhausted, "message is larger than configured max %d - unable to determine message size: %w", readMaxBytes, err)
+			return errorf(CodeResourceExhausted, "decompressed message is larger than configured max %d - unable to determine message size: %w", readMaxBytes, err)
 		}
-		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", bytesRead+discardedBytes, readMaxBytes)
+		return errorf(CodeResourceExhausted, "decompressed message size %d is larger than configured max %d", bytesRead+discardedBytes, readMaxBytes)
 	}
 	if err := c.putDecompressor(decompressor); err != nil {
 		return errorf(CodeUnknown, "recycle decompressor: %w", err)
@@ -162,8 +162,12 @@ func (c *compressionPool) putCompressor(compressor Compressor) error {
 // readOnlyCompressionPools is a read-only interface to a map of named
 // compressionPools.
 type readOnlyCompressionPools interface {
+	// Get, Contains, and Canonical match names case-insensitively, since HTTP
+	// content-coding tokens are case-insensitive.
 	Get(string) *compressionPool
 	Contains(string) bool
+	// Canonical returns the registered spelling of the name.
+	Canonical(string) (string, bool)
 	// Wordy, but clarifies how this is different from readOnlyCodecs.Names().
 	CommaSeparatedNames() string
 }
@@ -184,14 +188,20 @@ func newReadOnlyCompressionPools(
 		seen[name] = struct{}{}
 		names = append(names, name)
 	}
+	lowerToName := make(map[string]string, len(nameToPool))
+	for name := range nameToPool {
+		lowerToName[strings.ToLower(name)] = name
+	}
 	return &namedCompressionPools{
 		nameToPool:          nameToPool,
+		lowerToName:         lowerToName,
 		commaSeparatedNames: strings.Join(names, ","),
 	}
 }
 
 type namedCompressionPools struct {
 	nameToPool          map[string]*compressionPool
+	lowerToName         map[string]string
 	commaSeparatedNames string
 }
 
@@ -199,14 +209,36 @@ func (m *namedCompressionPools) Get(name string) *compressionPool {
 	if name == "" || name == compressionIdentity {
 		return nil
 	}
-	return m.nameToPool[name]
+	if canonical, ok := m.Canonical(name); ok {
+		return m.nameToPool[canonical]
+	}
+	return nil
 }
 
 func (m *namedCompressionPools) Contains(name string) bool {
-	_, ok := m.nameToPool[name]
+	_, ok := m.Canonical(name)
 	return ok
 }
 
+func (m *namedCompressionPools) Canonical(name string) (string, bool) {
+	if _, ok := m.nameToPool[name]; ok {
+		return name, true
+	}
+	// Some clients send tokens like "GZIP" or "Gzip".
+	canonical, ok := m.lowerToName[strings.ToLower(name)]
+	return canonical, ok
+}
+
 func (m *namedCompressionPools) CommaSeparatedNames() string {
 	return m.commaSeparatedNames
 }
+
+// describeMessage names a message in errors about size limits, so operators
+// can tell whether the limit applied to compressed input or to uncompressed
+// data. Limits on decompressed output say so explicitly.
+func describeMessage(compressed bool) string {
+	if compressed {
+		return "compressed message"
+	}
+	return "message"
+}
@@ -15,13 +15,19 @@
 package connect
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/binary"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/bufbuild/connect-go/internal/assert"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestAcceptEncodingOrdering(t *testing.T) {
@@ -54,3 +60,54 @@ func TestAcceptEncodingOrdering(t *testing.T) {
 	_, _ = client.CallUnary(context.Background(), NewRequest(&emptypb.Empty{}))
 	assert.True(t, called)
 }
+
+func TestCompressionNamesCaseInsensitive(t *testing.T) {
+	t.Parallel()
+	config := newHandlerConfig("/test.v1.Service/Method", nil)
+	pools := newReadOnlyCompressionPools(config.CompressionPools, config.CompressionNames)
+	for _, sent := range []string{"gzip", "GZIP", "Gzip"} {
+		request, response, err := negotiateCompression(pools, sent, "")
+		assert.Nil(t, err)
+		assert.Equal(t, request, compressionGzip)
+		assert.Equal(t, response, compressionGzip)
+		assert.NotNil(t, pools.Get(sent))
+	}
+	request, response, err := negotiateCompression(pools, "IDENTITY", "GZip")
+	assert.Nil(t, err)
+	assert.Equal(t, request, compressionIdentity)
+	assert.Equal(t, response, compressionGzip)
+	_, _, err = negotiateCompression(pools, "BR", "")
+	assert.Equal(t, CodeOf(err), CodeUnimplemented)
+
+	// End to end, a gRPC client sending upper-case names gets a gzipped
+	// response labeled with the canonical name.
+	const procedure = "/test.v1.Service/Echo"
+	handler := NewUnaryHandler(
+		procedure,
+		func(_ context.Context, request *Request[wrapperspb.StringValue]) (*Response[wrapperspb.StringValue], error) {
+			return NewResponse(request.Msg), nil
+		},
+		WithCompressMinBytes(1),
+	)
+	data, marshalErr := proto.Marshal(wrapperspb.String("hello"))
+	assert.Nil(t, marshalErr)
+	compressed := &bytes.Buffer{}
+	writer := gzip.NewWriter(compressed)
+	_, writeErr := writer.Write(data)
+	assert.Nil(t, writeErr)
+	assert.Nil(t, writer.Close())
+	body := []byte{1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(body[1:], uint32(compressed.Len()))
+	body = append(body, compressed.Bytes()...)
+	httpRequest := httptest.NewRequest(http.MethodPost, procedure, bytes.NewReader(body))
+	httpRequest.Header.Set("Content-Type", "application/grpc")
+	httpRequest.Header.Set("Grpc-Encoding", "GZIP")
+	httpRequest.Header.Set("Grpc-Accept-Encoding", "Gzip")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httpRequest)
+	result := recorder.Result()
+	defer result.Body.Close()
+	_, _ = io.Copy(io.Discard, result.Body)
+	assert.Equal(t, result.Trailer.Get("Grpc-Status"), "0")
+	assert.Equal(t, result.Header.Get("Grpc-Encoding"), compressionGzip)
+}
@@ -199,8 +199,9 @@ type AnyRequest interface {
 type Response[T any] struct {
 	Msg *T
 
-	header  http.Header
-	trailer http.Header
+	header     http.Header
+	trailer    http.Header
+	httpStatus int
 }
 
 // NewResponse wraps a generated response message.
@@ -233,6 +234,19 @@ func (r *Response[_]) Header() http.Header {
 // RPC protocol, trailers may be sent as HTTP trailers or a protocol-specific
 // block of in-body metadata.
 //
+// Trailers reach clients over HTTP/1.1 as well as HTTP/2. Unary Connect
+// responses send them as headers prefixed with "Trailer-", and streaming
+// Connect and gRPC-Web responses send them in the body after the last message,
+// so neither depends on HTTP trailer support. Whether metadata is a header or a
+// trailer is decided by the map it's written to: there's no need to declare
+// trailers in advance.
+//
+// In clients, the response's trailers are complete as soon as the call
+// returns, regardless of protocol. Streaming clients read trailers from the
+// stream's ResponseTrailer method instead, which returns the same kind of map
+// once the stream ends. If a call fails, its trailers are merged into the
+// error's metadata (see [Error.Meta]).
+//
 // Trailers beginning with "Connect-" and "Grpc-" are reserved for use by the
 // Connect and gRPC protocols: applications may read them but shouldn't write
 // them.
@@ -243,6 +257,33 @@ func (r *Response[_]) Trailer() http.Header {
 	return r.trailer
 }
 
+// SetHTTPStatus overrides the HTTP status code used for a successful response.
+// This is helpful when exposing RPCs to HTTP clients with RESTful
+// expectations, like a 201 from creation methods or a 204 from deletions.
+//
+// The status is only used by unary handlers speaking the Connect protocol. The
+// gRPC and gRPC-Web protocols require a 200, so they ignore it, as do
+// streaming handlers and clients. Because HTTP doesn't allow a 204 response to
+// have a body, the response message isn't sent and clients receive the
+// message's zero value. Connect clients from this package accept any 2xx
+// status as a successful unary response, since that's the range handlers may
+// send.
+//
+// To report errors, return an [*Error] instead. Statuses outside the 2xx range
+// are ignored, and the response uses the default 200.
+func (r *Response[_]) SetHTTPStatus(status int) {
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return
+	}
+	r.httpStatus = status
+}
+
+// successHTTPStatus returns the status set with SetHTTPStatus, or zero if the
+// default should be used.
+func (r *Response[_]) successHTTPStatus() int {
+	return r.httpStatus
+}
+
 // internalOnly implements AnyResponse.
 func (r *Response[_]) internalOnly() {}
 
@@ -275,6 +316,13 @@ type Spec struct {
 	StreamType StreamType
 	Procedure  string // for example, "/acme.foo.v1.FooService/Bar"
 	IsClient   bool   // otherwise we're in a handler
+	// Codec is the name of the codec used for messages, as returned by the
+	// Codec's Name method: for example, "proto" or "json". Handlers only know
+	// the codec once a request arrives, so it's empty in specs passed to
+	// error-handling hooks that run earlier. Unary Connect handlers may
+	// respond with a different codec if the client asks for one in the Accept
+	// header.
+	Codec string
 }
 
 // Peer describes the other party to an RPC.
@@ -313,6 +361,11 @@ type handlerConnCloser interface {
 func receiveUnaryResponse[T any](conn StreamingClientConn) (*Response[T], error) {
 	var msg T
 	if err := conn.Receive(&msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			// The server ended the stream successfully without sending a message,
+			// for example with a gRPC trailers-only response.
+			return nil, NewError(CodeUnimplemented, errors.New("unary stream has no messages"))
+		}
 		return nil, err
 	}
 	// In a well-formed stream, the response message may be followed by a block
@@ -321,6 +374,10 @@ func receiveUnaryResponse[T any](conn StreamingClientConn) (*Response[T], error)
 	if err := conn.Receive(new(T)); err == nil {
 		return nil, NewError(CodeUnknown, errors.New("unary stream has multiple messages"))
 	} else if err != nil && !errors.Is(err, io.EOF) {
+		// Keep the code of errors like oversized trailers.
+		if connectErr, ok := asError(err); ok {
+			return nil, connectErr
+		}
 		return nil, NewError(CodeUnknown, err)
 	}
 	return &Response[T]{
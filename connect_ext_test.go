@@ -20,6 +20,7 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -27,6 +28,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -700,6 +702,77 @@ func TestGRPCMissingTrailersError(t *testing.T) {
 	})
 }
 
+func TestGRPCTrailersOnlyResponse(t *testing.T) {
+	t.Parallel()
+	// grpc-go and other gRPC servers respond to many errors with a
+	// trailers-only response: a single HEADERS frame with the status and
+	// trailing metadata, and no body. Connect handlers never send successful
+	// trailers-only responses, so we write them by hand.
+	newServer := func(t *testing.T, status string) *httptest.Server {
+		t.Helper()
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+			w.Header().Set("Grpc-Status", status)
+			if status != "0" {
+				w.Header().Set("Grpc-Message", "not%20found")
+			}
+			w.Header().Set("Acme-Trailer", "value")
+			w.WriteHeader(http.StatusOK)
+		}))
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+	testTrailersOnly := func(t *testing.T, option connect.ClientOption) {
+		t.Helper()
+		t.Run("error", func(t *testing.T) {
+			t.Parallel()
+			server := newServer(t, "5")
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, option)
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Message(), "not found")
+			assert.Equal(t, connectErr.Meta().Get("Acme-Trailer"), "value")
+
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeNotFound)
+			assert.Nil(t, stream.Close())
+		})
+		t.Run("success", func(t *testing.T) {
+			t.Parallel()
+			server := newServer(t, "0")
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, option)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Nil(t, stream.Err())
+			assert.Equal(t, stream.ResponseTrailer().Get("Acme-Trailer"), "value")
+			assert.Zero(t, stream.ResponseHeader().Get("Acme-Trailer"))
+			assert.Nil(t, stream.Close())
+
+			// Unary RPCs must return exactly one message, so a successful response
+			// without one is an error, but not an unexpected EOF.
+			_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+			assert.False(t, errors.Is(err, io.ErrUnexpectedEOF))
+		})
+	}
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		testTrailersOnly(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		testTrailersOnly(t, connect.WithGRPCWeb())
+	})
+}
+
 func TestUnavailableIfHostInvalid(t *testing.T) {
 	t.Parallel()
 	client := pingv1connect.NewPingServiceClient(
@@ -740,6 +813,50 @@ func TestBidiRequiresHTTP2(t *testing.T) {
 	)
 }
 
+func TestStreamsOverHTTP1(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux) // HTTP/1.1 only
+	t.Cleanup(server.Close)
+	protocols := map[string]connect.ClientOption{
+		"connect": connect.WithProtoJSON(),
+		"grpc":    connect.WithGRPC(),
+		"grpcweb": connect.WithGRPCWeb(),
+	}
+	for name, opt := range protocols {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			// Half-duplex streams work over HTTP/1.1.
+			sum := client.Sum(context.Background())
+			assert.Nil(t, sum.Send(&pingv1.SumRequest{Number: 1}))
+			assert.Nil(t, sum.Send(&pingv1.SumRequest{Number: 2}))
+			response, err := sum.CloseAndReceive()
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Sum, 3)
+			countUp, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+			assert.Nil(t, err)
+			var received int
+			for countUp.Receive() {
+				received++
+			}
+			assert.Nil(t, countUp.Err())
+			assert.Equal(t, received, 2)
+			assert.Nil(t, countUp.Close())
+
+			// Bidi streams fail fast with a clear error rather than hanging.
+			cumSum := client.CumSum(context.Background())
+			_ = cumSum.Send(&pingv1.CumSumRequest{Number: 1})
+			_, err = cumSum.Receive()
+			assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+			assert.True(t, strings.Contains(err.Error(), "bidi streams require at least HTTP/2"))
+			assert.Nil(t, cumSum.CloseRequest())
+			assert.Nil(t, cumSum.CloseResponse())
+		})
+	}
+}
+
 func TestCompressMinBytesClient(t *testing.T) {
 	t.Parallel()
 	assertContentType := func(tb testing.TB, text, expect string) {
@@ -822,6 +939,205 @@ func TestCompressMinBytes(t *testing.T) {
 	})
 }
 
+func TestStrictUTF8(t *testing.T) {
+	t.Parallel()
+	const invalid = "caf\xe9"
+	newServer := func(t *testing.T, opts ...connect.HandlerOption) *httptest.Server {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			&pluggablePingServer{
+				ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+					return connect.NewResponse(&pingv1.PingResponse{Text: request.Msg.Text}), nil
+				},
+			},
+			append(opts, connect.WithCodec(rawTextCodec{}))...,
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	t.Run("handler", func(t *testing.T) {
+		t.Parallel()
+		server := newServer(t, connect.WithStrictUTF8())
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithCodec(rawTextCodec{}))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: invalid}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		assert.True(t, strings.Contains(err.Error(), "field text contains invalid UTF-8"))
+
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "café"}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, "café")
+	})
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		server := newServer(t)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithCodec(rawTextCodec{}),
+			connect.WithStrictUTF8(),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: invalid}))
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "field text contains invalid UTF-8"))
+	})
+	t.Run("lenient", func(t *testing.T) {
+		t.Parallel()
+		server := newServer(t)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithCodec(rawTextCodec{}))
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: invalid}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, invalid)
+	})
+}
+
+func TestCustomCodecErrors(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				err := connect.NewError(connect.CodeFailedPrecondition, errors.New("not ready"))
+				detail, detailErr := connect.NewErrorDetail(&pingv1.PingResponse{Text: "detail"})
+				if detailErr != nil {
+					return nil, detailErr
+				}
+				err.AddDetail(detail)
+				return nil, err
+			},
+		},
+		connect.WithCodec(pingOnlyCodec{}),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithCodec(pingOnlyCodec{}))...,
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Code(), connect.CodeFailedPrecondition)
+		assert.Equal(t, connectErr.Message(), "not ready")
+		assert.Equal(t, len(connectErr.Details()), 1)
+		detail, err := connectErr.Details()[0].Value()
+		assert.Nil(t, err)
+		assert.Equal(t, detail, proto.Message(&pingv1.PingResponse{Text: "detail"}))
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestPayloadTransformer(t *testing.T) {
+	t.Parallel()
+	// A toy "signature": a fixed prefix that must be present on receipt.
+	const signature = "signed:"
+	sign := func(data []byte) ([]byte, error) {
+		return append([]byte(signature), data...), nil
+	}
+	verify := func(data []byte) ([]byte, error) {
+		if !bytes.HasPrefix(data, []byte(signature)) {
+			return nil, errors.New("missing signature")
+		}
+		return data[len(signature):], nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				if request.Msg.Number < 0 {
+					return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("negative"))
+				}
+				return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number}), nil
+			},
+			cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+				var sum int64
+				for {
+					request, err := stream.Receive()
+					if errors.Is(err, io.EOF) {
+						return nil
+					} else if err != nil {
+						return err
+					}
+					sum += request.Number
+					if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+						return err
+					}
+				}
+			},
+		},
+		connect.WithPayloadTransformer(sign, verify),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(opts, connect.WithPayloadTransformer(sign, verify))...,
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 42)
+
+		stream := client.CumSum(context.Background())
+		for _, number := range []int64{1, 2} {
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: number}))
+			_, err := stream.Receive()
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+
+		// Errors aren't transformed.
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Message(), "negative")
+
+		// Clients without the transformer can't call the handler.
+		unsigned := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		_, err = unsigned.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		assert.True(t, strings.Contains(err.Error(), "missing signature"))
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
 func TestCustomCompression(t *testing.T) {
 	t.Parallel()
 	mux := http.NewServeMux()
@@ -855,6 +1171,104 @@ func TestCustomCompression(t *testing.T) {
 	assert.Equal(t, response.Msg, &pingv1.PingResponse{Text: request.Text})
 }
 
+func TestClientCompressionAsymmetry(t *testing.T) {
+	t.Parallel()
+	type capturedHeaders struct {
+		request, response http.Header
+	}
+	captured := make(chan capturedHeaders, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.ServeHTTP(writer, request)
+		captured <- capturedHeaders{
+			request:  request.Header.Clone(),
+			response: writer.Header().Clone(),
+		}
+	}))
+	t.Cleanup(server.Close)
+	ping := func(t *testing.T, opts ...connect.ClientOption) capturedHeaders {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		request := &pingv1.PingRequest{Text: strings.Repeat("ping", 1024)}
+		response, err := client.Ping(context.Background(), connect.NewRequest(request))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, request.Text)
+		return <-captured
+	}
+	t.Run("accept_gzip_send_identity", func(t *testing.T) {
+		headers := ping(t)
+		assert.Zero(t, headers.request.Get("Content-Encoding"))
+		assert.Equal(t, headers.request.Get("Accept-Encoding"), "gzip")
+		assert.Equal(t, headers.response.Get("Content-Encoding"), "gzip")
+	})
+	t.Run("send_gzip_then_identity", func(t *testing.T) {
+		headers := ping(t, connect.WithSendGzip(), connect.WithSendCompression("identity"))
+		assert.Zero(t, headers.request.Get("Content-Encoding"))
+		assert.Equal(t, headers.request.Get("Accept-Encoding"), "gzip")
+	})
+	t.Run("send_gzip", func(t *testing.T) {
+		headers := ping(t, connect.WithSendGzip())
+		assert.Equal(t, headers.request.Get("Content-Encoding"), "gzip")
+		assert.Equal(t, headers.request.Get("Accept-Encoding"), "gzip")
+	})
+}
+
+func TestDisableResponseCompression(t *testing.T) {
+	t.Parallel()
+	const text = "already compressed"
+	payload := strings.Repeat(text, 1024)
+	responseHeaders := make(chan http.Header, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if request.Msg.Text == text {
+				assert.True(t, connect.DisableResponseCompression(ctx))
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Text: payload}), nil
+		},
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			assert.True(t, connect.DisableResponseCompression(ctx))
+			return stream.Send(&pingv1.CountUpResponse{Number: 1})
+		},
+	}))
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.ServeHTTP(writer, request)
+		responseHeaders <- writer.Header().Clone()
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	assert.False(t, connect.DisableResponseCompression(context.Background()))
+	t.Run("unary", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, payload)
+		assert.Equal(t, (<-responseHeaders).Get("Content-Encoding"), "gzip")
+		response, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Text, payload)
+		assert.Zero(t, (<-responseHeaders).Get("Content-Encoding"))
+	})
+	t.Run("streaming", func(t *testing.T) {
+		for _, opts := range [][]connect.ClientOption{nil, {connect.WithGRPC()}, {connect.WithGRPCWeb()}} {
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.True(t, stream.Receive())
+			assert.Equal(t, stream.Msg().Number, 1)
+			assert.False(t, stream.Receive())
+			assert.Nil(t, stream.Err())
+			assert.Nil(t, stream.Close())
+			header := <-responseHeaders
+			assert.Zero(t, header.Get("Connect-Content-Encoding"))
+			assert.Zero(t, header.Get("Grpc-Encoding"))
+		}
+	})
+}
+
 func TestClientWithoutGzipSupport(t *testing.T) {
 	// See https://github.com/bufbuild/connect-go/pull/349 for why we want to
 	// support this. TL;DR is that Microsoft's dapr sidecar can't handle
@@ -967,7 +1381,13 @@ func TestHandlerWithReadMaxBytes(t *testing.T) {
 			_, err := client.Ping(context.Background(), connect.NewRequest(pingRequest))
 			assert.NotNil(t, err, assert.Sprintf("expected non-nil error for large message"))
 			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
-			assert.True(t, strings.HasSuffix(err.Error(), fmt.Sprintf("message size %d is larger than configured max %d", proto.Size(pingRequest), readMaxBytes)))
+			// With compression, the compressed message fits, so the error blames
+			// decompression.
+			expectedMessage := "message"
+			if compressed {
+				expectedMessage = "decompressed message"
+			}
+			assert.Equal(t, err.Error(), fmt.Sprintf("resource_exhausted: %s size %d is larger than configured max %d", expectedMessage, proto.Size(pingRequest), readMaxBytes))
 		})
 		t.Run("read_max_large", func(t *testing.T) {
 			t.Parallel()
@@ -985,7 +1405,11 @@ func TestHandlerWithReadMaxBytes(t *testing.T) {
 			_, err := client.Ping(context.Background(), connect.NewRequest(pingRequest))
 			assert.NotNil(t, err, assert.Sprintf("expected non-nil error for large message"))
 			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
-			assert.Equal(t, err.Error(), fmt.Sprintf("resource_exhausted: message size %d is larger than configured max %d", expectedSize, readMaxBytes))
+			expectedMessage := "message"
+			if compressed {
+				expectedMessage = "compressed message"
+			}
+			assert.Equal(t, err.Error(), fmt.Sprintf("resource_exhausted: %s size %d is larger than configured max %d", expectedMessage, expectedSize, readMaxBytes))
 		})
 	}
 	newHTTP2Server := func(t *testing.T) *httptest.Server {
@@ -1034,6 +1458,40 @@ func TestHandlerWithReadMaxBytes(t *testing.T) {
 	})
 }
 
+func TestHandlerWithReadMaxBytesContentLength(t *testing.T) {
+	t.Parallel()
+	const readMaxBytes = 16
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithReadMaxBytes(readMaxBytes),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	body := `{"text":"` + strings.Repeat("a", readMaxBytes) + `"}`
+	request, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+		strings.NewReader(body),
+	)
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "application/json")
+	assert.Equal(t, request.ContentLength, int64(len(body)))
+	response, err := server.Client().Do(request)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, response.StatusCode, http.StatusTooManyRequests)
+	var wireErr struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&wireErr))
+	assert.Equal(t, wireErr.Code, connect.CodeResourceExhausted.String())
+	assert.Equal(t, wireErr.Message, fmt.Sprintf("message size %d is larger than configured max %d", len(body), readMaxBytes))
+}
+
 func TestHandlerWithHTTPMaxBytes(t *testing.T) {
 	// This is similar to Connect's own ReadMaxBytes option, but applied to the
 	// whole stream using the stdlib's http.MaxBytesHandler.
@@ -1162,7 +1620,13 @@ func TestClientWithReadMaxBytes(t *testing.T) {
 			_, err := client.Ping(context.Background(), connect.NewRequest(pingRequest))
 			assert.NotNil(t, err, assert.Sprintf("expected non-nil error for large message"))
 			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
-			assert.True(t, strings.HasSuffix(err.Error(), fmt.Sprintf("message size %d is larger than configured max %d", proto.Size(pingRequest), readMaxBytes)))
+			// With compression, the compressed message fits, so the error blames
+			// decompression.
+			expectedMessage := "message"
+			if compressed {
+				expectedMessage = "decompressed message"
+			}
+			assert.Equal(t, err.Error(), fmt.Sprintf("resource_exhausted: %s size %d is larger than configured max %d", expectedMessage, proto.Size(pingRequest), readMaxBytes))
 		})
 		t.Run("read_max_large", func(t *testing.T) {
 			t.Parallel()
@@ -1181,7 +1645,11 @@ func TestClientWithReadMaxBytes(t *testing.T) {
 			_, err := client.Ping(context.Background(), connect.NewRequest(pingRequest))
 			assert.NotNil(t, err, assert.Sprintf("expected non-nil error for large message"))
 			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
-			assert.Equal(t, err.Error(), fmt.Sprintf("resource_exhausted: message size %d is larger than configured max %d", expectedSize, readMaxBytes))
+			expectedMessage := "message"
+			if compressed {
+				expectedMessage = "compressed message"
+			}
+			assert.Equal(t, err.Error(), fmt.Sprintf("resource_exhausted: %s size %d is larger than configured max %d", expectedMessage, expectedSize, readMaxBytes))
 		})
 	}
 	t.Run("connect", func(t *testing.T) {
@@ -1385,77 +1853,457 @@ func TestClientWithSendMaxBytes(t *testing.T) {
 	}
 	t.Run("connect", func(t *testing.T) {
 		t.Parallel()
-		sendMaxBytes := 1024
-		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes))
-		sendMaxBytesMatrix(t, client, sendMaxBytes, false)
+		sendMaxBytes := 1024
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes))
+		sendMaxBytesMatrix(t, client, sendMaxBytes, false)
+	})
+	t.Run("connect_gzip", func(t *testing.T) {
+		t.Parallel()
+		sendMaxBytes := 1024
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithSendGzip())
+		sendMaxBytesMatrix(t, client, sendMaxBytes, true)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		sendMaxBytes := 1024
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithGRPC())
+		sendMaxBytesMatrix(t, client, sendMaxBytes, false)
+	})
+	t.Run("grpc_gzip", func(t *testing.T) {
+		t.Parallel()
+		sendMaxBytes := 1024
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithGRPC(), connect.WithSendGzip())
+		sendMaxBytesMatrix(t, client, sendMaxBytes, true)
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		sendMaxBytes := 1024
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithGRPCWeb())
+		sendMaxBytesMatrix(t, client, sendMaxBytes, false)
+	})
+	t.Run("grpcweb_gzip", func(t *testing.T) {
+		t.Parallel()
+		sendMaxBytes := 1024
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithGRPCWeb(), connect.WithSendGzip())
+		sendMaxBytesMatrix(t, client, sendMaxBytes, true)
+	})
+}
+
+func TestBidiStreamServerSendsFirstMessage(t *testing.T) {
+	t.Parallel()
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		headersSent := make(chan struct{})
+		pingServer := &pluggablePingServer{
+			cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+				close(headersSent)
+				return nil
+			},
+		}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer))
+		server := httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithClientOptions(opts...),
+			connect.WithInterceptors(&assertPeerInterceptor{t}),
+		)
+		stream := client.CumSum(context.Background())
+		t.Cleanup(func() {
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+		})
+		assert.Nil(t, stream.Send(nil))
+		select {
+		case <-time.After(time.Second):
+			t.Error("timed out to get request headers")
+		case <-headersSent:
+		}
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestBidiStreamHalfClose(t *testing.T) {
+	t.Parallel()
+	receiveErrs := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var sum int64
+			for {
+				msg, err := stream.Receive()
+				if err != nil {
+					receiveErrs <- err
+					if errors.Is(err, io.EOF) {
+						// The client is done sending, but we can still flush a final
+						// response.
+						return stream.Send(&pingv1.CumSumResponse{Sum: sum})
+					}
+					return err
+				}
+				sum += msg.Number
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		t.Run("close_request", func(t *testing.T) {
+			stream := client.CumSum(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 42}))
+			msg, err := stream.Receive()
+			assert.Nil(t, err)
+			assert.Equal(t, msg.Sum, 42)
+			assert.Nil(t, stream.CloseRequest())
+			receiveErr := <-receiveErrs
+			assert.True(t, errors.Is(receiveErr, io.EOF))
+			msg, err = stream.Receive()
+			assert.Nil(t, err)
+			assert.Equal(t, msg.Sum, 42)
+			_, err = stream.Receive()
+			assert.True(t, errors.Is(err, io.EOF))
+			assert.Nil(t, stream.CloseResponse())
+		})
+		t.Run("cancel", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			stream := client.CumSum(ctx)
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 42}))
+			_, err := stream.Receive()
+			assert.Nil(t, err)
+			cancel()
+			receiveErr := <-receiveErrs
+			assert.NotNil(t, receiveErr)
+			assert.False(t, errors.Is(receiveErr, io.EOF))
+			var connectErr *connect.Error
+			assert.True(t, errors.As(receiveErr, &connectErr))
+			assert.Nil(t, stream.CloseRequest())
+			assert.Equal(t, connect.CodeOf(stream.CloseResponse()), connect.CodeCanceled)
+		})
+	}
+	// Subtests share the handler's error channel, so they run sequentially.
+	t.Run("connect", func(t *testing.T) {
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestServerStreamTrailersAfterMessages(t *testing.T) {
+	t.Parallel()
+	const (
+		totalTrailer = "X-Total-Rows"
+		tokenTrailer = "X-Next-Page-Token"
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			for i := int64(1); i <= request.Msg.Number; i++ {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			// Trailers are only known after the last message has been sent.
+			stream.ResponseTrailer().Set(totalTrailer, strconv.FormatInt(request.Msg.Number, 10))
+			stream.ResponseTrailer().Set(tokenTrailer, "next")
+			return nil
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		var count int
+		for stream.Receive() {
+			count++
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, count, 3)
+		assert.Equal(t, stream.ResponseTrailer().Get(totalTrailer), "3")
+		assert.Equal(t, stream.ResponseTrailer().Get(tokenTrailer), "next")
+		assert.Nil(t, stream.Close())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestServerStreamPartialResults(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			for i := int64(1); i <= request.Msg.Number; i++ {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			// The source fails partway through the results.
+			return connect.NewError(connect.CodeUnavailable, errors.New("shard offline"))
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		var got []int64
+		for stream.Receive() {
+			assert.Nil(t, stream.Err())
+			got = append(got, stream.Msg().Number)
+		}
+		assert.Equal(t, got, []int64{1, 2, 3})
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeUnavailable)
+		assert.Equal(t, stream.Err().(*connect.Error).Message(), "shard offline") //nolint:errorlint
+		assert.False(t, stream.Receive())
+		assert.Nil(t, stream.Close())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
+func TestResponseTrailersAcrossStreamTypes(t *testing.T) {
+	t.Parallel()
+	const trailerKey = "X-Checksum"
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			response.Trailer().Set(trailerKey, "unary")
+			return response, nil
+		},
+		sum: func(_ context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			for stream.Receive() {
+			}
+			response := connect.NewResponse(&pingv1.SumResponse{})
+			response.Trailer().Set(trailerKey, "client")
+			return response, stream.Err()
+		},
+		countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			stream.ResponseTrailer().Set(trailerKey, "server")
+			if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+				return err
+			}
+			return connect.NewError(connect.CodeDataLoss, errors.New("truncated"))
+		},
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			stream.ResponseTrailer().Set(trailerKey, "bidi")
+			for {
+				if _, err := stream.Receive(); errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		ctx := context.Background()
+
+		response, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Trailer().Get(trailerKey), "unary")
+
+		clientStream := client.Sum(ctx)
+		assert.Nil(t, clientStream.Send(&pingv1.SumRequest{Number: 1}))
+		sumResponse, err := clientStream.CloseAndReceive()
+		assert.Nil(t, err)
+		assert.Equal(t, sumResponse.Trailer().Get(trailerKey), "client")
+
+		serverStream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		for serverStream.Receive() {
+		}
+		assert.Equal(t, connect.CodeOf(serverStream.Err()), connect.CodeDataLoss)
+		assert.Equal(t, serverStream.ResponseTrailer().Get(trailerKey), "server")
+		assert.Equal(t, serverStream.Err().(*connect.Error).Meta().Get(trailerKey), "server") //nolint:errorlint
+		assert.Nil(t, serverStream.Close())
+
+		bidiStream := client.CumSum(ctx)
+		assert.Nil(t, bidiStream.Send(&pingv1.CumSumRequest{Number: 1}))
+		assert.Nil(t, bidiStream.CloseRequest())
+		_, err = bidiStream.Receive()
+		assert.True(t, errors.Is(err, io.EOF))
+		assert.Equal(t, bidiStream.ResponseTrailer().Get(trailerKey), "bidi")
+		assert.Nil(t, bidiStream.CloseResponse())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
 	})
-	t.Run("connect_gzip", func(t *testing.T) {
+	t.Run("grpc", func(t *testing.T) {
 		t.Parallel()
-		sendMaxBytes := 1024
-		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithSendGzip())
-		sendMaxBytesMatrix(t, client, sendMaxBytes, true)
+		run(t, connect.WithGRPC())
 	})
-	t.Run("grpc", func(t *testing.T) {
+	t.Run("grpcweb", func(t *testing.T) {
 		t.Parallel()
-		sendMaxBytes := 1024
-		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithGRPC())
-		sendMaxBytesMatrix(t, client, sendMaxBytes, false)
+		run(t, connect.WithGRPCWeb())
 	})
-	t.Run("grpc_gzip", func(t *testing.T) {
+}
+
+func TestTrailersOverHTTP1(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			response.Header().Set("X-Phase", "header")
+			response.Trailer().Set("X-Phase", "trailer")
+			return response, nil
+		},
+		countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			stream.ResponseHeader().Set("X-Phase", "header")
+			if err := stream.Send(&pingv1.CountUpResponse{}); err != nil {
+				return err
+			}
+			stream.ResponseTrailer().Set("X-Phase", "trailer")
+			return nil
+		},
+	}))
+	// httptest.NewServer only speaks HTTP/1.1.
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Header().Values("X-Phase"), []string{"header"})
+		assert.Equal(t, response.Trailer().Values("X-Phase"), []string{"trailer"})
+
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		for stream.Receive() {
+			assert.Equal(t, stream.ResponseHeader().Values("X-Phase"), []string{"header"})
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, stream.ResponseTrailer().Values("X-Phase"), []string{"trailer"})
+		assert.Nil(t, stream.Close())
+	}
+	t.Run("connect", func(t *testing.T) {
 		t.Parallel()
-		sendMaxBytes := 1024
-		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithGRPC(), connect.WithSendGzip())
-		sendMaxBytesMatrix(t, client, sendMaxBytes, true)
+		run(t)
 	})
-	t.Run("grpcweb", func(t *testing.T) {
+	t.Run("grpc", func(t *testing.T) {
 		t.Parallel()
-		sendMaxBytes := 1024
-		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithGRPCWeb())
-		sendMaxBytesMatrix(t, client, sendMaxBytes, false)
+		run(t, connect.WithGRPC())
 	})
-	t.Run("grpcweb_gzip", func(t *testing.T) {
+	t.Run("grpcweb", func(t *testing.T) {
 		t.Parallel()
-		sendMaxBytes := 1024
-		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithSendMaxBytes(sendMaxBytes), connect.WithGRPCWeb(), connect.WithSendGzip())
-		sendMaxBytesMatrix(t, client, sendMaxBytes, true)
+		run(t, connect.WithGRPCWeb())
 	})
 }
 
-func TestBidiStreamServerSendsFirstMessage(t *testing.T) {
+func TestServerStreamFlushesEachMessage(t *testing.T) {
+	// Clients accept gzip by default, so this also checks that compressed
+	// responses are streamed message by message.
 	t.Parallel()
+	const messages = 64
 	run := func(t *testing.T, opts ...connect.ClientOption) {
 		t.Helper()
-		headersSent := make(chan struct{})
-		pingServer := &pluggablePingServer{
-			cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
-				close(headersSent)
+		received := make(chan struct{})
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+			countUp: func(ctx context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				for i := int64(1); i <= request.Msg.Number; i++ {
+					if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+						return err
+					}
+					// Don't produce the next message until the client has received
+					// this one. If responses were buffered, this would deadlock.
+					select {
+					case <-received:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
 				return nil
 			},
-		}
-		mux := http.NewServeMux()
-		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer))
+		}))
 		server := httptest.NewUnstartedServer(mux)
 		server.EnableHTTP2 = true
 		server.StartTLS()
 		t.Cleanup(server.Close)
 
-		client := pingv1connect.NewPingServiceClient(
-			server.Client(),
-			server.URL,
-			connect.WithClientOptions(opts...),
-			connect.WithInterceptors(&assertPeerInterceptor{t}),
-		)
-		stream := client.CumSum(context.Background())
-		t.Cleanup(func() {
-			assert.Nil(t, stream.CloseRequest())
-			assert.Nil(t, stream.CloseResponse())
-		})
-		assert.Nil(t, stream.Send(nil))
-		select {
-		case <-time.After(time.Second):
-			t.Error("timed out to get request headers")
-		case <-headersSent:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: messages}))
+		assert.Nil(t, err)
+		var count int64
+		for stream.Receive() {
+			count++
+			assert.Equal(t, stream.Msg().Number, count)
+			received <- struct{}{}
 		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, count, messages)
+		assert.Nil(t, stream.Close())
 	}
 	t.Run("connect", func(t *testing.T) {
 		t.Parallel()
@@ -1471,6 +2319,56 @@ func TestBidiStreamServerSendsFirstMessage(t *testing.T) {
 	})
 }
 
+func TestServerStreamHeadersBeforeFirstMessage(t *testing.T) {
+	t.Parallel()
+	const sessionHeader = "X-Session-Token"
+	headersRead := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			stream.ResponseHeader().Set(sessionHeader, "abc")
+			if err := stream.Send(nil); err != nil {
+				return err
+			}
+			// Don't produce any messages until the client has seen the headers.
+			select {
+			case <-headersRead:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return stream.Send(&pingv1.CountUpResponse{Number: 1})
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, stream.ResponseHeader().Get(sessionHeader), "abc")
+		headersRead <- struct{}{}
+		assert.True(t, stream.Receive())
+		assert.Equal(t, stream.Msg().Number, 1)
+		assert.False(t, stream.Receive())
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+	}
+	// Subtests share the headersRead channel, so they run sequentially.
+	t.Run("connect", func(t *testing.T) {
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		run(t, connect.WithGRPCWeb())
+	})
+}
+
 func TestStreamForServer(t *testing.T) {
 	t.Parallel()
 	newPingServer := func(pingServer pingv1connect.PingServiceHandler) (pingv1connect.PingServiceClient, *httptest.Server) {
@@ -1745,6 +2643,74 @@ func TestConnectHTTPErrorCodes(t *testing.T) {
 	})
 }
 
+func TestConnectSuccessHTTPStatus(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number})
+			response.SetHTTPStatus(int(request.Msg.Number))
+			return response, nil
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	rawStatus := func(t *testing.T, contentType string, body []byte) int {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+			bytes.NewReader(body),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", contentType)
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		return response.StatusCode
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, rawStatus(t, "application/json", []byte(`{"number":201}`)), http.StatusCreated)
+		assert.Equal(t, rawStatus(t, "application/json", []byte(`{"number":204}`)), http.StatusNoContent)
+		assert.Equal(t, rawStatus(t, "application/json", []byte(`{"number":404}`)), http.StatusOK)
+		for _, opts := range [][]connect.ClientOption{nil, {connect.WithProtoJSON()}} {
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 201}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 201)
+			response, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 204}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 0)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		for _, status := range []int64{http.StatusContinue, http.StatusNotFound} {
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: status}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, status)
+		}
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC())
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 201}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 201)
+		protoBytes, err := proto.Marshal(&pingv1.PingRequest{Number: 201})
+		assert.Nil(t, err)
+		var prefix [5]byte
+		binary.BigEndian.PutUint32(prefix[1:5], uint32(len(protoBytes)))
+		assert.Equal(t, rawStatus(t, "application/grpc", append(prefix[:], protoBytes...)), http.StatusOK)
+	})
+}
+
 func TestFailCompression(t *testing.T) {
 	t.Parallel()
 	mux := http.NewServeMux()
@@ -1973,8 +2939,8 @@ func TestBidiOverHTTP1(t *testing.T) {
 	}
 	_, err := stream.Receive()
 	assert.NotNil(t, err)
-	assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
-	assert.Equal(t, err.Error(), "unknown: HTTP status 505 HTTP Version Not Supported")
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+	assert.True(t, strings.HasSuffix(err.Error(), "is HTTP/1.1: bidi streams require at least HTTP/2"))
 	assert.Nil(t, stream.CloseRequest())
 	assert.Nil(t, stream.CloseResponse())
 }
@@ -2069,6 +3035,61 @@ func (c failCodec) Unmarshal(data []byte, message any) error {
 	return proto.Unmarshal(data, protoMessage)
 }
 
+// pingOnlyCodec is a custom codec that only handles the ping service's
+// messages, so it fails if it's ever asked to marshal an error.
+type pingOnlyCodec struct{}
+
+func (c pingOnlyCodec) Name() string {
+	return "ping-only"
+}
+
+func (c pingOnlyCodec) Marshal(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok || protoMessage.ProtoReflect().Descriptor().ParentFile() != pingv1.File_connect_ping_v1_ping_proto {
+		return nil, fmt.Errorf("unexpected message: %T", message)
+	}
+	return proto.Marshal(protoMessage)
+}
+
+func (c pingOnlyCodec) Unmarshal(data []byte, message any) error {
+	protoMessage, ok := message.(proto.Message)
+	if !ok || protoMessage.ProtoReflect().Descriptor().ParentFile() != pingv1.File_connect_ping_v1_ping_proto {
+		return fmt.Errorf("unexpected message: %T", message)
+	}
+	return proto.Unmarshal(data, protoMessage)
+}
+
+// rawTextCodec sends only the text of pings, without validating it, like a
+// proto2 string field would.
+type rawTextCodec struct{}
+
+func (c rawTextCodec) Name() string {
+	return "raw-text"
+}
+
+func (c rawTextCodec) Marshal(message any) ([]byte, error) {
+	switch message := message.(type) {
+	case *pingv1.PingRequest:
+		return []byte(message.Text), nil
+	case *pingv1.PingResponse:
+		return []byte(message.Text), nil
+	default:
+		return nil, fmt.Errorf("unexpected message: %T", message)
+	}
+}
+
+func (c rawTextCodec) Unmarshal(data []byte, message any) error {
+	switch message := message.(type) {
+	case *pingv1.PingRequest:
+		message.Text = string(data)
+	case *pingv1.PingResponse:
+		message.Text = string(data)
+	default:
+		return fmt.Errorf("unexpected message: %T", message)
+	}
+	return nil
+}
+
 type pluggablePingServer struct {
 	pingv1connect.UnimplementedPingServiceHandler
 
@@ -2115,11 +3136,11 @@ func failNoHTTP2(tb testing.TB, stream *connect.BidiStreamForClient[pingv1.CumSu
 	}
 	assert.Nil(tb, stream.CloseRequest())
 	_, err := stream.Receive()
-	assert.NotNil(tb, err) // should be 505
+	assert.Equal(tb, connect.CodeOf(err), connect.CodeUnimplemented)
 	assert.True(
 		tb,
-		strings.Contains(err.Error(), "HTTP status 505"),
-		assert.Sprintf("expected 505, got %v", err),
+		strings.Contains(err.Error(), "bidi streams require at least HTTP/2"),
+		assert.Sprintf("expected HTTP/2 error, got %v", err),
 	)
 	assert.Nil(tb, stream.CloseResponse())
 }
@@ -2366,3 +3387,137 @@ func (failCompressor) Close() error {
 }
 
 func (failCompressor) Reset(io.Writer) {}
+
+func TestJSONErrorDetails(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			connectErr := connect.NewError(connect.CodeResourceExhausted, errors.New("over quota"))
+			jsonDetail, err := connect.NewJSONErrorDetail("acme.Quota", map[string]int{"limit": 10})
+			if err != nil {
+				return nil, err
+			}
+			connectErr.AddDetail(jsonDetail)
+			protoDetail, err := connect.NewErrorDetail(&pingv1.PingResponse{Text: "detail"})
+			if err != nil {
+				return nil, err
+			}
+			connectErr.AddDetail(protoDetail)
+			return nil, connectErr
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	ping := func(t *testing.T, opts ...connect.ClientOption) []*connect.ErrorDetail {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Code(), connect.CodeResourceExhausted)
+		return connectErr.Details()
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		details := ping(t)
+		assert.Equal(t, len(details), 2)
+		assert.Equal(t, details[0].Type(), "acme.Quota")
+		value, ok := details[0].JSON()
+		assert.True(t, ok)
+		var quota map[string]int
+		assert.Nil(t, json.Unmarshal(value, &quota))
+		assert.Equal(t, quota["limit"], 10)
+		assert.Equal(t, details[1].Type(), "connect.ping.v1.PingResponse")
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		// gRPC can only carry Protobuf details.
+		details := ping(t, connect.WithGRPC())
+		assert.Equal(t, len(details), 1)
+		assert.Equal(t, details[0].Type(), "connect.ping.v1.PingResponse")
+	})
+}
+
+func TestErrorDetailsParityAcrossProtocols(t *testing.T) {
+	t.Parallel()
+	newErr := func() error {
+		err := connect.NewError(connect.CodeFailedPrecondition, errors.New("not ready"))
+		for _, msg := range []proto.Message{
+			&pingv1.PingResponse{Number: 1, Text: "first"},
+			&pingv1.SumResponse{Sum: 2},
+		} {
+			detail, detailErr := connect.NewErrorDetail(msg)
+			if detailErr != nil {
+				return detailErr
+			}
+			err.AddDetail(detail)
+		}
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return nil, newErr()
+		},
+		countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			// Errors after messages travel in-body (or in trailers), rather than
+			// in headers.
+			for i := int64(0); i < request.Msg.Number; i++ {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			return newErr()
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	type detail struct {
+		Type  string
+		Bytes []byte
+	}
+	receive := func(t *testing.T, opt connect.ClientOption, number int64) []detail {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		var err error
+		if number < 0 {
+			_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		} else {
+			stream, streamErr := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: number}))
+			assert.Nil(t, streamErr)
+			for stream.Receive() {
+			}
+			err = stream.Err()
+			assert.Nil(t, stream.Close())
+		}
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Code(), connect.CodeFailedPrecondition)
+		assert.Equal(t, connectErr.Message(), "not ready")
+		details := make([]detail, 0, len(connectErr.Details()))
+		for _, d := range connectErr.Details() {
+			details = append(details, detail{Type: d.Type(), Bytes: d.Bytes()})
+		}
+		return details
+	}
+	var want []detail
+	for _, msg := range []proto.Message{
+		&pingv1.PingResponse{Number: 1, Text: "first"},
+		&pingv1.SumResponse{Sum: 2},
+	} {
+		data, err := proto.Marshal(msg)
+		assert.Nil(t, err)
+		want = append(want, detail{Type: string(msg.ProtoReflect().Descriptor().FullName()), Bytes: data})
+	}
+	for _, number := range []int64{-1, 0, 2} { // unary, stream without messages, stream with messages
+		assert.Equal(t, receive(t, connect.WithProtoJSON(), number), want)
+		assert.Equal(t, receive(t, connect.WithGRPC(), number), want)
+		assert.Equal(t, receive(t, connect.WithGRPCWeb(), number), want)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net"
+	"net/http/httptrace"
+	"time"
+)
+
+// ConnectionInfo describes the HTTP connection used by a client for an RPC.
+type ConnectionInfo struct {
+	Spec       Spec
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// Reused is false if the connection was newly established for this RPC.
+	// HTTP/2 connections are shared by concurrent RPCs, so only the first RPC
+	// on each connection sees Reused set to false.
+	Reused bool
+	// WasIdle and IdleTime report whether the connection was idle in the pool,
+	// and for how long, before this RPC used it.
+	WasIdle  bool
+	IdleTime time.Duration
+}
+
+// WithConnectionObserver configures a client to call observe with the
+// connection used for each RPC, as soon as one is obtained from the HTTP
+// client's connection pool. It's useful for diagnosing connection churn: for
+// example, a burst of new connections alongside CodeUnavailable errors
+// suggests that servers are restarting or load balancers are closing
+// connections.
+//
+// The observer relies on [net/http/httptrace], so it only works with HTTP
+// clients built on [http.Transport] (including the HTTP/2 transport). net/http
+// doesn't expose other connection events, like GOAWAY frames or closed
+// connections; they surface as errors, which [IsUnprocessed] and
+// [IsRetryable] classify. The observer is called synchronously, so it must be
+// fast and safe to call concurrently.
+func WithConnectionObserver(observe func(ConnectionInfo)) ClientOption {
+	return &connectionObserverOption{observe: observe}
+}
+
+// ContextWithConnectionObserver returns a copy of the context that makes
+// clients call observe with the connection used for the RPC made with it. It
+// works like [WithConnectionObserver], but for a single call: for example, to
+// record which backend served a particular request when diagnosing uneven load
+// across replicas. With connection pooling, each call may use a different
+// connection. If the client also has an observer configured with
+// WithConnectionObserver, both are called.
+//
+// Like WithConnectionObserver, it relies on [net/http/httptrace], so it's best
+// effort: observe isn't called if the HTTP client doesn't report connections.
+func ContextWithConnectionObserver(ctx context.Context, observe func(ConnectionInfo)) context.Context {
+	return context.WithValue(ctx, connectionObserverKey{}, observe)
+}
+
+type connectionObserverKey struct{}
+
+type connectionObserverOption struct {
+	observe func(ConnectionInfo)
+}
+
+func (o *connectionObserverOption) applyToClient(config *clientConfig) {
+	config.ConnectionObserver = o.observe
+}
+
+// withConnectionObserver returns a context that reports the connection used
+// by HTTP requests made with it to the client's observer and to any observer
+// attached with ContextWithConnectionObserver.
+func withConnectionObserver(ctx context.Context, spec Spec, observe func(ConnectionInfo)) context.Context {
+	if callObserve, ok := ctx.Value(connectionObserverKey{}).(func(ConnectionInfo)); ok && callObserve != nil {
+		if clientObserve := observe; clientObserve != nil {
+			observe = func(info ConnectionInfo) {
+				clientObserve(info)
+				callObserve(info)
+			}
+		} else {
+			observe = callObserve
+		}
+	}
+	if observe == nil {
+		return ctx
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			connInfo := ConnectionInfo{
+				Spec:     spec,
+				Reused:   info.Reused,
+				WasIdle:  info.WasIdle,
+				IdleTime: info.IdleTime,
+			}
+			if info.Conn != nil {
+				connInfo.LocalAddr = info.Conn.LocalAddr()
+				connInfo.RemoteAddr = info.Conn.RemoteAddr()
+			}
+			observe(connInfo)
+		},
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestConnectionObserver(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			return stream.Send(&pingv1.CountUpResponse{})
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	var (
+		mu    sync.Mutex
+		infos []connect.ConnectionInfo
+	)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithConnectionObserver(func(info connect.ConnectionInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			infos = append(infos, info)
+		}),
+	)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+	assert.Nil(t, err)
+	for stream.Receive() {
+	}
+	assert.Nil(t, stream.Err())
+	assert.Nil(t, stream.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, len(infos), 2)
+	assert.Equal(t, infos[0].Spec.Procedure, "/"+pingv1connect.PingServiceName+"/Ping")
+	assert.False(t, infos[0].Reused)
+	assert.NotNil(t, infos[0].LocalAddr)
+	assert.Equal(t, infos[0].RemoteAddr.String(), server.Listener.Addr().String())
+	assert.Equal(t, infos[1].Spec.Procedure, "/"+pingv1connect.PingServiceName+"/CountUp")
+	assert.True(t, infos[1].Reused)
+}
+
+func TestContextWithConnectionObserver(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	var clientObserved int
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL,
+		connect.WithConnectionObserver(func(connect.ConnectionInfo) {
+			clientObserved++
+		}),
+	)
+	var callInfo connect.ConnectionInfo
+	ctx := connect.ContextWithConnectionObserver(context.Background(), func(info connect.ConnectionInfo) {
+		callInfo = info
+	})
+	_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, clientObserved, 1)
+	assert.Equal(t, callInfo.Spec.Procedure, "/"+pingv1connect.PingServiceName+"/Ping")
+	assert.Equal(t, callInfo.RemoteAddr.String(), server.Listener.Addr().String())
+
+	// Calls without the context only report to the client's observer.
+	callInfo = connect.ConnectionInfo{}
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, clientObserved, 2)
+	assert.Nil(t, callInfo.RemoteAddr)
+
+	// Clients without an observer still report to the call's observer.
+	plain := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	_, err = plain.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, callInfo.RemoteAddr.String(), server.Listener.Addr().String())
+}
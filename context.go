@@ -0,0 +1,190 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// SpecFromContext returns the Spec of the RPC handled with the context. It
+// reports false for contexts that didn't come from a [Handler].
+//
+// The context a Handler passes to interceptors and implementations carries the
+// RPC's [Spec] and [Peer], which are available with SpecFromContext and
+// [PeerFromContext]. They're useful in code that only has the context, like
+// loggers and data access layers. The Handler doesn't authenticate clients or
+// assign request IDs, but interceptors often do: they should attach those
+// values with [ContextWithPrincipal] and [ContextWithRequestID], so that
+// downstream code can read them with [PrincipalFromContext] and
+// [RequestIDFromContext]. The context keys are unexported, so these values
+// can't collide with values stored by other packages.
+func SpecFromContext(ctx context.Context) (Spec, bool) {
+	call, ok := handlerCallFromContext(ctx)
+	if !ok {
+		return Spec{}, false
+	}
+	return call.conn.Spec(), true
+}
+
+// PeerFromContext returns the client of the RPC handled with the context. It
+// reports false for contexts that didn't come from a [Handler].
+func PeerFromContext(ctx context.Context) (Peer, bool) {
+	call, ok := handlerCallFromContext(ctx)
+	if !ok {
+		return Peer{}, false
+	}
+	return call.conn.Peer(), true
+}
+
+// ContextWithPrincipal returns a copy of the context that carries the
+// authenticated identity of the client, usually attached by an authentication
+// interceptor. The principal's type is up to the application.
+func ContextWithPrincipal(ctx context.Context, principal any) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal attached with
+// [ContextWithPrincipal]. It reports false if there's no principal.
+func PrincipalFromContext(ctx context.Context) (any, bool) {
+	principal := ctx.Value(principalContextKey{})
+	return principal, principal != nil
+}
+
+// ContextWithRequestID returns a copy of the context that carries an ID for
+// the request, usually attached by an interceptor that reads it from a request
+// header or generates it.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the ID attached with [ContextWithRequestID]. It
+// reports false if there's no ID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok
+}
+
+// RequestHeaderFromContext returns the request headers of the RPC handled
+// with the context. It's most useful deep in a call stack, where the
+// [Request] isn't available: for example, to forward correlation headers to
+// outbound calls (see [WithClientTracePropagation]). Callers must not modify
+// the returned headers. It reports false for contexts that didn't come from
+// a [Handler].
+func RequestHeaderFromContext(ctx context.Context) (http.Header, bool) {
+	call, ok := handlerCallFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return call.conn.RequestHeader(), true
+}
+
+// ResponseHeaderFromContext returns the response headers of the RPC handled
+// with the context. Interceptors and implementations can use it to set headers
+// that are sent whether the RPC succeeds or fails: for example, a request ID
+// or quota headers set before an error is returned. Headers are sent with the
+// first message, so they must be set before a unary implementation returns or
+// a stream's first Send. It reports false for contexts that didn't come from
+// a [Handler].
+//
+// Headers set on a successful unary [Response] are merged into these headers,
+// and errors' metadata (see [Error.Meta]) is merged in when they're sent. When
+// an error is sent before any messages, gRPC-Web sends headers and trailers
+// together, so clients see these headers as trailers.
+func ResponseHeaderFromContext(ctx context.Context) (http.Header, bool) {
+	call, ok := handlerCallFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return call.conn.ResponseHeader(), true
+}
+
+// ResponseTrailerFromContext returns the response trailers of the RPC handled
+// with the context. Like the headers returned by [ResponseHeaderFromContext],
+// trailers set here are sent whether the RPC succeeds or fails. They may be
+// set at any time before the handler returns. It reports false for contexts
+// that didn't come from a [Handler].
+func ResponseTrailerFromContext(ctx context.Context) (http.Header, bool) {
+	call, ok := handlerCallFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return call.conn.ResponseTrailer(), true
+}
+
+// RequestContentLengthFromContext returns the Content-Length of the HTTP
+// request carrying the RPC handled with the context. Client streaming
+// handlers can use it to report upload progress or to pre-allocate buffers.
+// The length includes the protocol's framing and is measured before
+// decompression, so it's only an estimate of the size of the messages. It's -1
+// if the length is unknown, as it is for chunked HTTP/1.1 requests and HTTP/2
+// requests without a Content-Length header. Many clients, including this
+// package's, stream request bodies, so the length is often unknown. It reports
+// false for contexts that didn't come from a [Handler].
+func RequestContentLengthFromContext(ctx context.Context) (int64, bool) {
+	call, ok := handlerCallFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	return call.contentLength, true
+}
+
+// IsServerError reports whether the error indicates a server-side failure,
+// using the classifier configured on the [Handler] that handled the RPC with
+// [WithServerErrorClassifier]. Without a classifier, or for contexts that
+// didn't come from a Handler, it uses [IsServerErrorCode]. Errors that aren't
+// an [*Error] have [CodeUnknown], so they're server errors by default; nil
+// errors never are.
+//
+// Logging and metrics interceptors and error hooks should use IsServerError,
+// so that they agree with each other and with [WithRedactedServerErrors].
+func IsServerError(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	code := CodeOf(wrapIfContextError(err))
+	if call, ok := handlerCallFromContext(ctx); ok && call.classifier != nil {
+		return call.classifier(code)
+	}
+	return IsServerErrorCode(code)
+}
+
+type principalContextKey struct{}
+
+type requestIDContextKey struct{}
+
+// handlerCallKey stores the *handlerCall for the RPC.
+type handlerCallKey struct{}
+
+// handlerCall is the per-RPC state that a Handler attaches to the context.
+// Keeping it in a single context value means that serving an RPC costs one
+// allocation for all the accessors in this file, rather than one each.
+type handlerCall struct {
+	conn          handlerConnCloser
+	contentLength int64
+	// From WithServerErrorClassifier, if set.
+	classifier func(Code) bool
+	// From WithRawRequestBody. It's nil unless the body was buffered.
+	rawBody []byte
+	// Closing the request body stops a concurrent read, which ForwardDecoded
+	// uses to stop forwarding requests early.
+	requestBody io.Closer
+}
+
+func handlerCallFromContext(ctx context.Context) (*handlerCall, bool) {
+	call, ok := ctx.Value(handlerCallKey{}).(*handlerCall)
+	return call, ok
+}
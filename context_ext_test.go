@@ -0,0 +1,235 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestHandlerContextValues(t *testing.T) {
+	t.Parallel()
+	type user struct{ name string }
+	authenticate := func(ctx context.Context, header http.Header) context.Context {
+		ctx = connect.ContextWithRequestID(ctx, header.Get("Request-Id"))
+		return connect.ContextWithPrincipal(ctx, &user{name: "alice"})
+	}
+	assertContext := func(ctx context.Context, procedure string) {
+		spec, ok := connect.SpecFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, spec.Procedure, procedure)
+		assert.False(t, spec.IsClient)
+		peer, ok := connect.PeerFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, peer.Protocol, connect.ProtocolConnect)
+		assert.NotZero(t, peer.Addr)
+		principal, ok := connect.PrincipalFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, principal.(*user).name, "alice") //nolint:forcetypeassert
+		id, ok := connect.RequestIDFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, id, "123")
+	}
+	interceptor := &contextValueInterceptor{attach: authenticate}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				assertContext(ctx, "/"+pingv1connect.PingServiceName+"/Ping")
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+			countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				assertContext(ctx, "/"+pingv1connect.PingServiceName+"/CountUp")
+				return stream.Send(&pingv1.CountUpResponse{})
+			},
+		},
+		connect.WithInterceptors(interceptor),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	request := connect.NewRequest(&pingv1.PingRequest{})
+	request.Header().Set("Request-Id", "123")
+	_, err := client.Ping(context.Background(), request)
+	assert.Nil(t, err)
+
+	streamRequest := connect.NewRequest(&pingv1.CountUpRequest{})
+	streamRequest.Header().Set("Request-Id", "123")
+	stream, err := client.CountUp(context.Background(), streamRequest)
+	assert.Nil(t, err)
+	assert.True(t, stream.Receive())
+	assert.False(t, stream.Receive())
+	assert.Nil(t, stream.Err())
+	assert.Nil(t, stream.Close())
+
+	// Contexts that didn't come from a Handler have none of these values.
+	ctx := context.Background()
+	_, ok := connect.SpecFromContext(ctx)
+	assert.False(t, ok)
+	_, ok = connect.PeerFromContext(ctx)
+	assert.False(t, ok)
+	_, ok = connect.PrincipalFromContext(ctx)
+	assert.False(t, ok)
+	_, ok = connect.RequestIDFromContext(ctx)
+	assert.False(t, ok)
+}
+
+func TestHandlerRequestContentLength(t *testing.T) {
+	t.Parallel()
+	var pingLength, sumLength int64
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				length, ok := connect.RequestContentLengthFromContext(ctx)
+				assert.True(t, ok)
+				pingLength = length
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+			sum: func(ctx context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+				length, ok := connect.RequestContentLengthFromContext(ctx)
+				assert.True(t, ok)
+				sumLength = length
+				for stream.Receive() {
+				}
+				return connect.NewResponse(&pingv1.SumResponse{}), stream.Err()
+			},
+		},
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	// Requests with a body of known size report its length.
+	body := []byte(`{"text": "hello, world"}`)
+	response, err := server.Client().Post(
+		server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+		"application/json",
+		bytes.NewReader(body),
+	)
+	assert.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
+	assert.Equal(t, response.StatusCode, http.StatusOK)
+	assert.Equal(t, pingLength, int64(len(body)))
+
+	// Clients stream request bodies, so their length is unknown.
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	stream := client.Sum(context.Background())
+	assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+	_, err = stream.CloseAndReceive()
+	assert.Nil(t, err)
+	assert.Equal(t, sumLength, int64(-1))
+
+	_, ok := connect.RequestContentLengthFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+// contextValueInterceptor attaches values to handler contexts.
+type contextValueInterceptor struct {
+	attach func(context.Context, http.Header) context.Context
+}
+
+func (i *contextValueInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+		return next(i.attach(ctx, request.Header()), request)
+	}
+}
+
+func (i *contextValueInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *contextValueInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		return next(i.attach(ctx, conn.RequestHeader()), conn)
+	}
+}
+
+func TestHandlerErrorMetadata(t *testing.T) {
+	t.Parallel()
+	setMetadata := func(ctx context.Context) {
+		header, ok := connect.ResponseHeaderFromContext(ctx)
+		assert.True(t, ok)
+		header.Set("X-Request-Id", "123")
+		trailer, ok := connect.ResponseTrailerFromContext(ctx)
+		assert.True(t, ok)
+		trailer.Set("X-Quota-Remaining", "0")
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				setMetadata(ctx)
+				return nil, connect.NewError(connect.CodeResourceExhausted, errors.New("quota exceeded"))
+			},
+			countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], _ *connect.ServerStream[pingv1.CountUpResponse]) error {
+				setMetadata(ctx)
+				return connect.NewError(connect.CodeResourceExhausted, errors.New("quota exceeded"))
+			},
+		},
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	assertMetadata := func(t *testing.T, header, trailer http.Header) {
+		t.Helper()
+		assert.Equal(t, header.Get("X-Request-Id"), "123")
+		assert.Equal(t, trailer.Get("X-Quota-Remaining"), "0")
+	}
+	protocols := map[string]connect.ClientOption{
+		"connect": connect.WithProtoJSON(),
+		"grpc":    connect.WithGRPC(),
+		"grpcweb": connect.WithGRPCWeb(),
+	}
+	for name, opt := range protocols {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			// Unary errors carry both headers and trailers as metadata.
+			assertMetadata(t, connectErr.Meta(), connectErr.Meta())
+
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.True(t, errors.As(stream.Err(), &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeResourceExhausted)
+			// gRPC-Web errors without messages are trailers-only responses, so
+			// clients see the headers as trailers. The error carries both.
+			assertMetadata(t, connectErr.Meta(), connectErr.Meta())
+			assert.Equal(t, stream.ResponseTrailer().Get("X-Quota-Remaining"), "0")
+			assert.Nil(t, stream.Close())
+		})
+	}
+
+	// Contexts that didn't come from a Handler have no response metadata.
+	_, ok := connect.ResponseHeaderFromContext(context.Background())
+	assert.False(t, ok)
+	_, ok = connect.ResponseTrailerFromContext(context.Background())
+	assert.False(t, ok)
+}
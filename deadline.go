@@ -0,0 +1,91 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.20
+
+package connect
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// newDeadlineResponseWriter wraps the writer so that each write and flush
+// must complete within the timeout. If the writer doesn't support write
+// deadlines (see [http.ResponseController]), it's returned unchanged.
+func newDeadlineResponseWriter(w http.ResponseWriter, timeout time.Duration) http.ResponseWriter {
+	controller := http.NewResponseController(w)
+	// Clearing the deadline is harmless, and tells us whether it's supported.
+	if err := controller.SetWriteDeadline(time.Time{}); errors.Is(err, http.ErrNotSupported) {
+		return w
+	}
+	return &deadlineResponseWriter{
+		ResponseWriter: w,
+		controller:     controller,
+		timeout:        timeout,
+	}
+}
+
+type deadlineResponseWriter struct {
+	http.ResponseWriter
+
+	controller *http.ResponseController
+	timeout    time.Duration
+	timedOut   bool
+}
+
+func (w *deadlineResponseWriter) Write(data []byte) (int, error) {
+	var wrote int
+	err := w.withDeadline(func() error {
+		var err error
+		wrote, err = w.ResponseWriter.Write(data)
+		return err
+	})
+	return wrote, err
+}
+
+func (w *deadlineResponseWriter) Flush() {
+	_ = w.withDeadline(w.controller.Flush)
+}
+
+// Unwrap returns the wrapped writer, so that [http.ResponseController] can
+// reach optional interfaces like [http.Hijacker] and [io.ReaderFrom].
+func (w *deadlineResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withDeadline runs the write with a deadline, clearing it afterwards so it
+// doesn't apply to later reuse of the connection. Once any write has
+// overrun its deadline, the stream is broken and all errors are reported as
+// CodeDeadlineExceeded.
+func (w *deadlineResponseWriter) withDeadline(write func() error) error {
+	deadline := time.Now().Add(w.timeout)
+	// If the writer can't set the deadline (for example, because the stream
+	// is already closed), the write below reports the problem.
+	_ = w.controller.SetWriteDeadline(deadline)
+	err := write()
+	_ = w.controller.SetWriteDeadline(time.Time{})
+	if !w.timedOut && !time.Now().Before(deadline) {
+		w.timedOut = true
+	}
+	if err != nil && w.timedOut {
+		return NewError(
+			CodeDeadlineExceeded,
+			fmt.Errorf("client didn't accept data within %v: %w", w.timeout, err),
+		)
+	}
+	return err
+}
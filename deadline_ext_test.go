@@ -0,0 +1,71 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.20
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+)
+
+func TestHandlerStreamSendTimeout(t *testing.T) {
+	t.Parallel()
+	const procedure = "/connect.test.v1.DownloadService/Download"
+	sendErr := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewServerStreamHandler(
+		procedure,
+		func(_ context.Context, _ *connect.Request[pingv1.PingRequest], stream *connect.ServerStream[pingv1.PingResponse]) error {
+			chunk := &pingv1.PingResponse{Text: strings.Repeat("a", 64*1024)}
+			for {
+				if err := stream.Send(chunk); err != nil {
+					sendErr <- err
+					return err
+				}
+			}
+		},
+		connect.WithStreamSendTimeout(100*time.Millisecond),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+procedure,
+		// Without compression, the messages fill flow control windows quickly.
+		connect.WithAcceptCompression("gzip", nil, nil),
+	)
+	// The client never reads, so flow control eventually blocks the handler.
+	stream, err := client.CallServerStream(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = stream.Close() })
+	select {
+	case err := <-sendErr:
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+	case <-time.After(10 * time.Second):
+		t.Fatal("handler wasn't evicted after the client stopped reading")
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !go1.20
+
+package connect
+
+import (
+	"net/http"
+	"time"
+)
+
+// newDeadlineResponseWriter returns the writer unchanged: before Go 1.20,
+// net/http doesn't support per-write deadlines, so WithStreamSendTimeout has
+// no effect.
+func newDeadlineResponseWriter(w http.ResponseWriter, _ time.Duration) http.ResponseWriter {
+	return w
+}
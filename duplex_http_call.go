@@ -45,6 +45,12 @@ type duplexHTTPCall struct {
 	request         *http.Request
 	response        *http.Response
 
+	// Once the response headers arrive, net/http stops watching the context
+	// until the request body is closed. While the client is still streaming,
+	// we watch the context ourselves until stopWatching is closed.
+	stopWatching     chan struct{}
+	stopWatchingOnce sync.Once
+
 	errMu sync.Mutex
 	err   error
 }
@@ -72,6 +78,7 @@ func newDuplexHTTPCall(
 		requestBodyWriter: pipeWriter,
 		request:           request,
 		responseReady:     make(chan struct{}),
+		stopWatching:      make(chan struct{}),
 	}
 	if err != nil {
 		// We can't construct a request, so we definitely can't send it over the
@@ -123,6 +130,7 @@ func (d *duplexHTTPCall) CloseWrite() error {
 	// forever. To make sure users don't have to worry about this, the generated
 	// code for unary, client streaming, and server streaming RPCs must call
 	// CloseWrite automatically rather than requiring the user to do it.
+	d.stopWatchingContext()
 	return d.requestBodyWriter.Close()
 }
 
@@ -158,6 +166,7 @@ func (d *duplexHTTPCall) Read(data []byte) (int, error) {
 }
 
 func (d *duplexHTTPCall) CloseRead() error {
+	d.stopWatchingContext()
 	d.BlockUntilResponseReady()
 	if d.response == nil {
 		return nil
@@ -216,6 +225,7 @@ func (d *duplexHTTPCall) SetError(err error) {
 	// It's safe to ignore the returned error here. Under the hood, Close calls
 	// CloseWithError, which is documented to always return nil.
 	_ = d.requestBodyReader.Close()
+	d.stopWatchingContext()
 }
 
 // SetValidateResponse sets the response validation function. The function runs
@@ -254,13 +264,11 @@ func (d *duplexHTTPCall) makeRequest() {
 		return
 	}
 	d.response = response
-	if err := d.validateResponse(response); err != nil {
-		d.SetError(err)
-		return
-	}
-	if (d.streamType&StreamTypeBidi) == StreamTypeBidi && response.ProtoMajor < 2 {
-		// If we somehow dialed an HTTP/1.x server, fail with an explicit message
-		// rather than returning a more cryptic error later on.
+	if (d.streamType&StreamTypeBidi) == StreamTypeBidi && !isFullDuplex(response.Proto, response.ProtoMajor) {
+		// If we somehow dialed an HTTP/1.x server (or a proxy downgraded the
+		// connection), fail with an explicit message rather than returning a more
+		// cryptic error later on. Check before validating the response: handlers
+		// reject bidi streams over HTTP/1.x with a bare HTTP 505.
 		d.SetError(errorf(
 			CodeUnimplemented,
 			"response from %v is HTTP/%d.%d: bidi streams require at least HTTP/2",
@@ -268,9 +276,44 @@ func (d *duplexHTTPCall) makeRequest() {
 			response.ProtoMajor,
 			response.ProtoMinor,
 		))
+		return
+	}
+	if err := d.validateResponse(response); err != nil {
+		d.SetError(err)
+		return
+	}
+	if (d.streamType & StreamTypeClient) != 0 {
+		go d.watchContext()
 	}
 }
 
+// watchContext aborts the request body if the context is canceled while the
+// client may still be sending. Failing the pipe makes net/http reset the
+// stream, so the server sees a transport error rather than a clean end of
+// stream.
+func (d *duplexHTTPCall) watchContext() {
+	select {
+	case <-d.ctx.Done():
+		err := wrapIfContextError(d.ctx.Err())
+		d.errMu.Lock()
+		if d.err == nil {
+			d.err = err
+		}
+		d.errMu.Unlock()
+		// Unlike SetError, close the write side of the pipe: net/http then reads
+		// the context error from the request body and reports it from the
+		// response body too, rather than a generic io.ErrClosedPipe.
+		_ = d.requestBodyWriter.CloseWithError(err)
+	case <-d.stopWatching:
+	}
+}
+
+func (d *duplexHTTPCall) stopWatchingContext() {
+	d.stopWatchingOnce.Do(func() {
+		close(d.stopWatching)
+	})
+}
+
 func (d *duplexHTTPCall) getError() error {
 	d.errMu.Lock()
 	defer d.errMu.Unlock()
@@ -115,6 +115,9 @@ func (w *envelopeWriter) write(env *envelope) *Error {
 		return errorf(CodeUnknown, "write envelope: %w", err)
 	}
 	if _, err := io.Copy(w.writer, env.Data); err != nil {
+		if connectErr, ok := asError(err); ok {
+			return connectErr
+		}
 		return errorf(CodeUnknown, "write message: %w", err)
 	}
 	return nil
@@ -127,6 +130,10 @@ type envelopeReader struct {
 	compressionPool *compressionPool
 	bufferPool      *bufferPool
 	readMaxBytes    int
+	// If positive, limits envelopes with protocol-specific flags, which carry
+	// trailers or end-of-stream metadata rather than messages, instead of
+	// readMaxBytes.
+	trailerMaxBytes int
 }
 
 func (r *envelopeReader) Unmarshal(message any) *Error {
@@ -160,7 +167,8 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 		}
 		decompressed := r.bufferPool.Get()
 		defer r.bufferPool.Put(decompressed)
-		if err := r.compressionPool.Decompress(decompressed, data, int64(r.readMaxBytes)); err != nil {
+		maxBytes, _ := r.maxBytes(env.Flags)
+		if err := r.compressionPool.Decompress(decompressed, data, int64(maxBytes)); err != nil {
 			return err
 		}
 		data = decompressed
@@ -205,15 +213,20 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 		// to the user so that they know that the stream has ended. We shouldn't
 		// add any alarming text about protocol errors, though.
 		return NewError(CodeUnknown, err)
-	case err != nil || prefixBytesRead < 5:
-		// Something else has gone wrong - the stream didn't end cleanly.
-		if connectErr, ok := asError(err); ok {
+	case err != nil && !errors.Is(err, io.EOF):
+		// The underlying transport failed (for example, because the peer reset
+		// the stream). This must not look like a clean end of stream, or callers
+		// can't distinguish a half-close from a broken connection.
+		if connectErr, ok := asError(wrapIfContextError(err)); ok {
 			return connectErr
 		}
 		if maxBytesErr := asMaxBytesError(err, "read 5 byte message prefix"); maxBytesErr != nil {
 			// We're reading from an http.MaxBytesHandler, and we've exceeded the read limit.
 			return maxBytesErr
 		}
+		return errorf(CodeUnknown, "read 5 byte message prefix: %w", err)
+	case err != nil || prefixBytesRead < 5:
+		// The stream ended partway through the prefix.
 		return errorf(
 			CodeInvalidArgument,
 			"protocol error: incomplete envelope: %w", err,
@@ -223,12 +236,16 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 	if size < 0 {
 		return errorf(CodeInvalidArgument, "message size %d overflowed uint32", size)
 	}
-	if r.readMaxBytes > 0 && size > r.readMaxBytes {
+	if maxBytes, description := r.maxBytes(prefixes[0]); maxBytes > 0 && size > maxBytes {
 		_, err := io.CopyN(io.Discard, r.reader, int64(size))
 		if err != nil && !errors.Is(err, io.EOF) {
 			return errorf(CodeUnknown, "read enveloped message: %w", err)
 		}
-		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", size, r.readMaxBytes)
+		return errorf(
+			CodeResourceExhausted,
+			"%s size %d is larger than configured max %d",
+			description, size, maxBytes,
+		)
 	}
 	if size > 0 {
 		env.Data.Grow(size)
@@ -271,3 +288,17 @@ func isSizeZeroPrefix(prefix [5]byte) bool {
 	}
 	return true
 }
+
+// maxBytes returns the size limit for an envelope with the given flags, and
+// a description of the envelope for errors. Trailers are subject to both the
+// trailer limit and the read limit, so they get whichever is smaller.
+func (r *envelopeReader) maxBytes(flags uint8) (int, string) {
+	if flags&^flagEnvelopeCompressed == 0 {
+		return r.readMaxBytes, describeMessage(flags&flagEnvelopeCompressed != 0)
+	}
+	limit := r.readMaxBytes
+	if r.trailerMaxBytes > 0 && (limit <= 0 || r.trailerMaxBytes < limit) {
+		limit = r.trailerMaxBytes
+	}
+	return limit, "trailers"
+}
@@ -16,12 +16,15 @@ package connect
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
 
+	statusv1 "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/status/v1"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 )
@@ -39,9 +42,16 @@ const (
 //
 // The [google.golang.org/genproto/googleapis/rpc/errdetails] package contains a
 // variety of Protobuf messages commonly used as error details.
+//
+// Deployments whose clients all use this package's Connect protocol support may
+// prefer details that are plain JSON rather than Protobuf messages. See
+// [NewJSONErrorDetail].
 type ErrorDetail struct {
 	pb       *anypb.Any
 	wireJSON string // preserve human-readable JSON
+	// JSON details have no Protobuf representation, so pb is nil.
+	jsonType  string
+	jsonValue json.RawMessage
 }
 
 // NewErrorDetail constructs a new error detail. If msg is an *[anypb.Any] then
@@ -59,9 +69,34 @@ func NewErrorDetail(msg proto.Message) (*ErrorDetail, error) {
 	return &ErrorDetail{pb: pb}, nil
 }
 
+// NewJSONErrorDetail constructs an error detail from arbitrary JSON: value is
+// marshaled with the standard library's [encoding/json], and typeName
+// identifies the kind of detail to clients.
+//
+// JSON details are an extension to the Connect protocol that only this
+// package supports: handlers include them in the error's "details" array as
+// objects with "type" and "json" keys, rather than the "type" and
+// base64-encoded "value" keys the protocol specifies for Protobuf details.
+// Other Connect implementations, including connect-web, don't understand them
+// and may ignore them or fail to parse the error, so only use JSON details when
+// every client uses this package. gRPC and gRPC-Web can only send Protobuf
+// details, so they drop JSON details. To reach every client, wrap the detail
+// in a Protobuf message (for example, a google.protobuf.Struct) and use
+// [NewErrorDetail] instead.
+func NewJSONErrorDetail(typeName string, value any) (*ErrorDetail, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &ErrorDetail{jsonType: typeName, jsonValue: data}, nil
+}
+
 // Type is the fully-qualified name of the detail's Protobuf message (for
-// example, acme.foo.v1.FooDetail).
+// example, acme.foo.v1.FooDetail), or the type name of a JSON detail.
 func (d *ErrorDetail) Type() string {
+	if d.pb == nil {
+		return d.jsonType
+	}
 	// proto.Any tries to make messages self-describing by using type URLs rather
 	// than plain type names, but there aren't any descriptor registries
 	// deployed. With the current state of the `Any` code, it's not possible to
@@ -73,8 +108,14 @@ func (d *ErrorDetail) Type() string {
 	return strings.TrimPrefix(d.pb.TypeUrl, defaultAnyResolverPrefix)
 }
 
-// Bytes returns a copy of the Protobuf-serialized detail.
+// Bytes returns a copy of the Protobuf-serialized detail. For JSON details, it
+// returns a copy of the JSON.
 func (d *ErrorDetail) Bytes() []byte {
+	if d.pb == nil {
+		out := make([]byte, len(d.jsonValue))
+		copy(out, d.jsonValue)
+		return out
+	}
 	out := make([]byte, len(d.pb.Value))
 	copy(out, d.pb.Value)
 	return out
@@ -83,10 +124,27 @@ func (d *ErrorDetail) Bytes() []byte {
 // Value uses the Protobuf runtime's package-global registry to unmarshal the
 // Detail into a strongly-typed message. Typically, clients use Go type
 // assertions to cast from the proto.Message interface to concrete types.
+//
+// JSON details don't have a Protobuf message, so Value returns an error. Use
+// JSON instead.
 func (d *ErrorDetail) Value() (proto.Message, error) {
+	if d.pb == nil {
+		return nil, fmt.Errorf("%s is a JSON error detail", d.jsonType)
+	}
 	return d.pb.UnmarshalNew()
 }
 
+// JSON returns the value of a detail constructed with [NewJSONErrorDetail] (or
+// received as JSON from a Connect server), and whether the detail is a JSON
+// detail. Unmarshal the returned value with the standard library's
+// [encoding/json].
+func (d *ErrorDetail) JSON() (json.RawMessage, bool) {
+	if d.pb != nil {
+		return nil, false
+	}
+	return json.RawMessage(d.Bytes()), true
+}
+
 // An Error captures four key pieces of information: a [Code], an underlying Go
 // error, a map of metadata, and an optional collection of arbitrary Protobuf
 // messages called "details" (more on those below). Servers send the code, the
@@ -118,6 +176,72 @@ func NewError(c Code, underlying error) *Error {
 	return &Error{code: c, err: underlying}
 }
 
+// NewErrorFromHTTPStatus annotates any Go error with the code that best
+// describes an HTTP status. It's useful in gateways and proxies that translate
+// failures from plain HTTP backends into RPC errors.
+//
+// The mapping follows the statuses' REST semantics, so it's not the same as
+// the mapping the Connect protocol uses for responses without a Connect error
+// body:
+//
+//	400 Bad Request             CodeInvalidArgument
+//	401 Unauthorized            CodeUnauthenticated
+//	403 Forbidden               CodePermissionDenied
+//	404 Not Found               CodeNotFound
+//	405 Method Not Allowed      CodeUnimplemented
+//	408 Request Timeout         CodeDeadlineExceeded
+//	409 Conflict                CodeAborted
+//	412 Precondition Failed     CodeFailedPrecondition
+//	413 Content Too Large       CodeResourceExhausted
+//	416 Range Not Satisfiable   CodeOutOfRange
+//	429 Too Many Requests       CodeResourceExhausted
+//	499 Client Closed Request   CodeCanceled
+//	500 Internal Server Error   CodeInternal
+//	501 Not Implemented         CodeUnimplemented
+//	502 Bad Gateway             CodeUnavailable
+//	503 Service Unavailable     CodeUnavailable
+//	504 Gateway Timeout         CodeDeadlineExceeded
+//
+// Any other status, including successful ones, maps to CodeUnknown.
+func NewErrorFromHTTPStatus(status int, underlying error) *Error {
+	return NewError(httpStatusToCode(status), underlying)
+}
+
+func httpStatusToCode(status int) Code {
+	// As in the protocol-specific mappings, literals are easier to compare to
+	// the table above.
+	switch status {
+	case 400:
+		return CodeInvalidArgument
+	case 401:
+		return CodeUnauthenticated
+	case 403:
+		return CodePermissionDenied
+	case 404:
+		return CodeNotFound
+	case 405, 501:
+		return CodeUnimplemented
+	case 408, 504:
+		return CodeDeadlineExceeded
+	case 409:
+		return CodeAborted
+	case 412:
+		return CodeFailedPrecondition
+	case 413, 429:
+		return CodeResourceExhausted
+	case 416:
+		return CodeOutOfRange
+	case 499:
+		return CodeCanceled
+	case 500:
+		return CodeInternal
+	case 502, 503:
+		return CodeUnavailable
+	default:
+		return CodeUnknown
+	}
+}
+
 // NewWireError is similar to [NewError], but the resulting *Error returns true
 // when tested with [IsWireError].
 //
@@ -168,7 +292,15 @@ func (e *Error) Message() string {
 	return ""
 }
 
-// Unwrap allows [errors.Is] and [errors.As] access to the underlying error.
+// Unwrap allows [errors.Is] and [errors.As] access to the underlying error,
+// so they traverse the full chain of causes. For example, code that receives
+// NewError(CodeNotFound, fmt.Errorf("user %d: %w", id, ErrNoUser)) from an
+// implementation, interceptor, or error hook can check for the ErrNoUser
+// sentinel with errors.Is.
+//
+// Only the code, message, details, and metadata cross the network: errors
+// returned by clients are reconstructed from the wire, so their underlying
+// errors are new values and sentinels from the server don't match.
 func (e *Error) Unwrap() error {
 	return e.err
 }
@@ -188,6 +320,42 @@ func (e *Error) AddDetail(d *ErrorDetail) {
 	e.details = append(e.details, d)
 }
 
+// WithDetails returns a copy of err with the details appended, so that errors
+// from lower layers can be enriched without rebuilding them. If err is (or
+// wraps) an [*Error], the copy has the same code, message, metadata, and
+// existing details. Otherwise, err is wrapped in a new *Error with
+// [CodeUnknown]. The original error is never modified. WithDetails returns nil
+// if err is nil.
+//
+// If a detail can't be marshaled, WithDetails returns an error with
+// [CodeInternal] instead.
+func WithDetails(err error, details ...proto.Message) error {
+	if err == nil {
+		return nil
+	}
+	var enriched *Error
+	if connectErr, ok := asError(err); ok {
+		enriched = &Error{
+			code:    connectErr.code,
+			err:     connectErr.err,
+			details: make([]*ErrorDetail, len(connectErr.details), len(connectErr.details)+len(details)),
+			meta:    connectErr.meta.Clone(),
+			wireErr: connectErr.wireErr,
+		}
+		copy(enriched.details, connectErr.details)
+	} else {
+		enriched = NewError(CodeUnknown, err)
+	}
+	for _, msg := range details {
+		detail, detailErr := NewErrorDetail(msg)
+		if detailErr != nil {
+			return errorf(CodeInternal, "add detail to error %q: %w", err.Error(), detailErr)
+		}
+		enriched.AddDetail(detail)
+	}
+	return enriched
+}
+
 // Meta allows the error to carry additional information as key-value pairs.
 //
 // Metadata attached to errors returned by unary handlers is always sent as
@@ -206,14 +374,78 @@ func (e *Error) Meta() http.Header {
 	return e.meta
 }
 
+// MarshalStatus encodes the error as a binary google.rpc.Status Protobuf
+// message, the same representation the gRPC protocol uses for errors. It's
+// useful when integrating with systems that expect that message, like a
+// database column or another transport: unmarshal the result into the
+// google.rpc.Status type from the googleapis module (or grpc-go's status
+// package). Details added with [NewJSONErrorDetail] can't be represented and
+// are omitted. Metadata isn't included.
+func (e *Error) MarshalStatus() ([]byte, error) {
+	return proto.Marshal(grpcStatusFromError(e))
+}
+
+// ErrorFromStatus decodes a binary google.rpc.Status Protobuf message, like
+// those produced by [Error.MarshalStatus], into an [*Error]. It returns nil if
+// the status has code 0 (OK).
+func ErrorFromStatus(data []byte) (*Error, error) {
+	var status statusv1.Status
+	if err := proto.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("unmarshal google.rpc.Status: %w", err)
+	}
+	if status.Code == 0 {
+		return nil, nil //nolint: nilnil
+	}
+	connectErr := NewError(Code(status.Code), errors.New(status.Message))
+	for _, detail := range status.Details {
+		connectErr.details = append(connectErr.details, &ErrorDetail{pb: detail})
+	}
+	return connectErr, nil
+}
+
 func (e *Error) detailsAsAny() []*anypb.Any {
 	anys := make([]*anypb.Any, 0, len(e.details))
 	for _, detail := range e.details {
+		if detail.pb == nil {
+			// JSON details can't be sent as Protobuf.
+			continue
+		}
 		anys = append(anys, detail.pb)
 	}
 	return anys
 }
 
+// redactServerError replaces the message of errors that indicate a
+// server-side failure (according to IsServerError), which may describe
+// internal details. Details can leak the same information (debug info and
+// stack traces are common), so they're dropped too. The redacted error keeps
+// the original's code and metadata, and wraps the original so that it's still
+// available to errors.Is and errors.As.
+func redactServerError(ctx context.Context, err error, message string) error {
+	err = wrapIfContextError(err)
+	if !IsServerError(ctx, err) {
+		return err
+	}
+	redacted := NewError(CodeOf(err), &redactedError{message: message, original: err})
+	if connectErr, ok := asError(err); ok {
+		redacted.meta = connectErr.meta
+	}
+	return redacted
+}
+
+type redactedError struct {
+	message  string
+	original error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.original
+}
+
 // errorf calls fmt.Errorf with the supplied template and arguments, then wraps
 // the resulting error.
 func errorf(c Code, template string, args ...any) *Error {
@@ -222,6 +454,14 @@ func errorf(c Code, template string, args ...any) *Error {
 
 // asError uses errors.As to unwrap any error and look for a connect *Error.
 func asError(err error) (*Error, bool) {
+	// This is on the hot path, and errors.As always allocates. Skip it when we
+	// can.
+	if err == nil {
+		return nil, false
+	}
+	if connectErr, ok := err.(*Error); ok { //nolint:errorlint
+		return connectErr, true
+	}
 	var connectErr *Error
 	ok := errors.As(err, &connectErr)
 	return connectErr, ok
@@ -261,6 +501,21 @@ func wrapIfContextError(err error) error {
 	return err
 }
 
+// wrapIfClientGone reports a handler's failure to read the request body as
+// cancellation (or an expired deadline) if the request's context is done.
+// When clients cancel streams, net/http's HTTP/2 server resets the stream and
+// cancels the request's context, but reads fail with an uncoded transport
+// error.
+func wrapIfClientGone(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, io.EOF) || ctx.Err() == nil {
+		return err
+	}
+	if connectErr, ok := asError(err); ok && connectErr.Code() != CodeUnknown {
+		return err
+	}
+	return wrapIfContextError(ctx.Err())
+}
+
 // wrapIfLikelyWithGRPCNotUsedError adds a wrapping error that has a message
 // telling the caller that they likely need to use h2c but are using a raw http.Client{}.
 //
@@ -325,8 +580,9 @@ func wrapIfRSTError(err error) error {
 		streamErrPrefix = "stream error: "
 		fromPeerSuffix  = "; received from peer"
 	)
-	if err == nil {
-		return nil
+	if err == nil || errors.Is(err, io.EOF) {
+		// Reading to EOF is the common case, so avoid allocating.
+		return err
 	}
 	if _, ok := asError(err); ok {
 		return err
@@ -33,3 +33,21 @@ func ExampleError_Message() {
 	// Output:
 	// underlying error message: failed to foo
 }
+
+func ExampleError_Unwrap() {
+	errNoUser := errors.New("no such user")
+	err := connect.NewError(
+		connect.CodeNotFound,
+		fmt.Errorf("user 42: %w", errNoUser),
+	)
+	// Within a process, for example in an interceptor, code can branch on the
+	// underlying error.
+	if errors.Is(err, errNoUser) {
+		fmt.Println("code:", connect.CodeOf(err))
+		fmt.Println("message:", err.Message())
+	}
+
+	// Output:
+	// code: not_found
+	// message: user 42: no such user
+}
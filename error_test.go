@@ -17,11 +17,14 @@ package connect
 import (
 	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/bufbuild/connect-go/internal/assert"
+	statusv1 "github.com/bufbuild/connect-go/internal/gen/connectext/grpc/status/v1"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -77,6 +80,26 @@ func TestCodeOf(t *testing.T) {
 	assert.Equal(t, CodeOf(errors.New("foo")), CodeUnknown)
 }
 
+func TestNewErrorFromHTTPStatus(t *testing.T) {
+	t.Parallel()
+	underlying := errors.New("backend failed")
+	for status, code := range map[int]Code{
+		http.StatusBadRequest:         CodeInvalidArgument,
+		http.StatusNotFound:           CodeNotFound,
+		http.StatusConflict:           CodeAborted,
+		http.StatusTooManyRequests:    CodeResourceExhausted,
+		http.StatusServiceUnavailable: CodeUnavailable,
+		http.StatusGatewayTimeout:     CodeDeadlineExceeded,
+		http.StatusOK:                 CodeUnknown,
+		http.StatusTeapot:             CodeUnknown,
+	} {
+		err := NewErrorFromHTTPStatus(status, underlying)
+		assert.Equal(t, err.Code(), code, assert.Sprintf("status %d", status))
+		assert.ErrorIs(t, err, underlying)
+		assert.Equal(t, err.Message(), underlying.Error())
+	}
+}
+
 func TestErrorDetails(t *testing.T) {
 	t.Parallel()
 	second := durationpb.New(time.Second)
@@ -94,6 +117,70 @@ func TestErrorDetails(t *testing.T) {
 	assert.Equal(t, detail.Bytes(), secondBin)
 }
 
+func TestWithDetails(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, WithDetails(nil, durationpb.New(time.Second)))
+
+	original := NewError(CodeNotFound, errors.New("no such user"))
+	original.Meta().Set("Key", "value")
+	first, err := NewErrorDetail(durationpb.New(time.Second))
+	assert.Nil(t, err)
+	original.AddDetail(first)
+	enriched := WithDetails(fmt.Errorf("lookup: %w", original), durationpb.New(time.Minute))
+	connectErr, ok := asError(enriched)
+	assert.True(t, ok)
+	assert.Equal(t, connectErr.Code(), CodeNotFound)
+	assert.Equal(t, connectErr.Message(), "no such user")
+	assert.Equal(t, connectErr.Meta().Get("Key"), "value")
+	assert.Equal(t, len(connectErr.Details()), 2)
+	value, err := connectErr.Details()[1].Value()
+	assert.Nil(t, err)
+	assert.Equal(t, value, proto.Message(durationpb.New(time.Minute)))
+	// The original error is unchanged.
+	assert.Equal(t, len(original.Details()), 1)
+	connectErr.Meta().Set("Key", "changed")
+	assert.Equal(t, original.Meta().Get("Key"), "value")
+
+	plain := errors.New("oh no")
+	enriched = WithDetails(plain, durationpb.New(time.Second))
+	assert.Equal(t, CodeOf(enriched), CodeUnknown)
+	assert.True(t, errors.Is(enriched, plain))
+	connectErr, ok = asError(enriched)
+	assert.True(t, ok)
+	assert.Equal(t, len(connectErr.Details()), 1)
+}
+
+func TestErrorStatus(t *testing.T) {
+	t.Parallel()
+	original := NewError(CodeNotFound, errors.New("no such user"))
+	detail, err := NewErrorDetail(durationpb.New(time.Second))
+	assert.Nil(t, err)
+	original.AddDetail(detail)
+	data, err := original.MarshalStatus()
+	assert.Nil(t, err)
+	var status statusv1.Status
+	assert.Nil(t, proto.Unmarshal(data, &status))
+	assert.Equal(t, status.Code, int32(CodeNotFound))
+	assert.Equal(t, status.Message, "no such user")
+	assert.Equal(t, len(status.Details), 1)
+
+	roundTripped, err := ErrorFromStatus(data)
+	assert.Nil(t, err)
+	assert.Equal(t, roundTripped.Code(), CodeNotFound)
+	assert.Equal(t, roundTripped.Message(), "no such user")
+	assert.False(t, IsWireError(roundTripped))
+	assert.Equal(t, len(roundTripped.Details()), 1)
+	value, err := roundTripped.Details()[0].Value()
+	assert.Nil(t, err)
+	assert.Equal(t, value, proto.Message(durationpb.New(time.Second)))
+
+	ok, err := ErrorFromStatus(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ok)
+	_, err = ErrorFromStatus([]byte("invalid"))
+	assert.NotNil(t, err)
+}
+
 func TestErrorIs(t *testing.T) {
 	t.Parallel()
 	// errors.New and fmt.Errorf return *errors.errorString. errors.Is
@@ -106,4 +193,15 @@ func TestErrorIs(t *testing.T) {
 	connectErr := NewError(CodeUnavailable, err)
 	assert.False(t, errors.Is(connectErr, NewError(CodeUnavailable, err)))
 	assert.True(t, errors.Is(connectErr, connectErr))
+	// errors.Is and errors.As traverse the whole chain of causes.
+	errNoUser := errors.New("no such user")
+	wrapped := fmt.Errorf(
+		"handler: %w",
+		NewError(CodeNotFound, fmt.Errorf("user 42: %w", errNoUser)),
+	)
+	assert.True(t, errors.Is(wrapped, errNoUser))
+	assert.True(t, errors.Is(WithDetails(wrapped, durationpb.New(time.Second)), errNoUser))
+	var pathErr *fs.PathError
+	assert.True(t, errors.As(NewError(CodeNotFound, &fs.PathError{Op: "open", Err: fs.ErrNotExist}), &pathErr))
+	assert.True(t, errors.Is(pathErr, fs.ErrNotExist))
 }
@@ -15,10 +15,8 @@
 package connect
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 )
 
 // An ErrorWriter writes errors to an [http.ResponseWriter] in the format
@@ -28,13 +26,8 @@ import (
 //
 // ErrorWriters are safe to use concurrently.
 type ErrorWriter struct {
-	bufferPool                   *bufferPool
-	protobuf                     Codec
-	allContentTypes              map[string]struct{}
-	grpcContentTypes             map[string]struct{}
-	grpcWebContentTypes          map[string]struct{}
-	unaryConnectContentTypes     map[string]struct{}
-	streamingConnectContentTypes map[string]struct{}
+	handlers        []protocolHandler
+	allContentTypes map[string]struct{}
 }
 
 // NewErrorWriter constructs an ErrorWriter. To properly recognize supported
@@ -42,39 +35,19 @@ type ErrorWriter struct {
 // HandlerOptions to NewErrorWriter and any wrapped Connect handlers.
 func NewErrorWriter(opts ...HandlerOption) *ErrorWriter {
 	config := newHandlerConfig("", opts)
+	// Some protocols use different Content-Types for unary and streaming RPCs,
+	// so we need handlers for both.
+	handlers := append(
+		config.newProtocolHandlers(StreamTypeUnary),
+		config.newProtocolHandlers(StreamTypeBidi)...,
+	)
 	writer := &ErrorWriter{
-		bufferPool:                   config.BufferPool,
-		protobuf:                     newReadOnlyCodecs(config.Codecs).Protobuf(),
-		allContentTypes:              make(map[string]struct{}),
-		grpcContentTypes:             make(map[string]struct{}),
-		grpcWebContentTypes:          make(map[string]struct{}),
-		unaryConnectContentTypes:     make(map[string]struct{}),
-		streamingConnectContentTypes: make(map[string]struct{}),
+		handlers:        handlers,
+		allContentTypes: make(map[string]struct{}),
 	}
-	for name := range config.Codecs {
-		unary := connectContentTypeFromCodecName(StreamTypeUnary, name)
-		writer.allContentTypes[unary] = struct{}{}
-		writer.unaryConnectContentTypes[unary] = struct{}{}
-		streaming := connectContentTypeFromCodecName(StreamTypeBidi, name)
-		writer.streamingConnectContentTypes[streaming] = struct{}{}
-		writer.allContentTypes[streaming] = struct{}{}
-	}
-	if config.HandleGRPC {
-		writer.grpcContentTypes[grpcContentTypeDefault] = struct{}{}
-		writer.allContentTypes[grpcContentTypeDefault] = struct{}{}
-		for name := range config.Codecs {
-			ct := grpcContentTypeFromCodecName(false /* web */, name)
-			writer.grpcContentTypes[ct] = struct{}{}
-			writer.allContentTypes[ct] = struct{}{}
-		}
-	}
-	if config.HandleGRPCWeb {
-		writer.grpcWebContentTypes[grpcWebContentTypeDefault] = struct{}{}
-		writer.allContentTypes[grpcWebContentTypeDefault] = struct{}{}
-		for name := range config.Codecs {
-			ct := grpcContentTypeFromCodecName(true /* web */, name)
-			writer.grpcWebContentTypes[ct] = struct{}{}
-			writer.allContentTypes[ct] = struct{}{}
+	for _, handler := range handlers {
+		for contentType := range handler.ContentTypes() {
+			writer.allContentTypes[contentType] = struct{}{}
 		}
 	}
 	return writer
@@ -95,74 +68,10 @@ func (w *ErrorWriter) IsSupported(request *http.Request) bool {
 // Write does not read or close the request body.
 func (w *ErrorWriter) Write(response http.ResponseWriter, request *http.Request, err error) error {
 	ctype := canonicalizeContentType(getHeaderCanonical(request.Header, headerContentType))
-	if _, ok := w.unaryConnectContentTypes[ctype]; ok {
-		// Unary errors are always JSON.
-		setHeaderCanonical(response.Header(), headerContentType, connectUnaryContentTypeJSON)
-		return w.writeConnectUnary(response, err)
-	}
-	if _, ok := w.streamingConnectContentTypes[ctype]; ok {
-		setHeaderCanonical(response.Header(), headerContentType, ctype)
-		return w.writeConnectStreaming(response, err)
-	}
-	if _, ok := w.grpcContentTypes[ctype]; ok {
-		setHeaderCanonical(response.Header(), headerContentType, ctype)
-		return w.writeGRPC(response, err)
-	}
-	if _, ok := w.grpcWebContentTypes[ctype]; ok {
-		setHeaderCanonical(response.Header(), headerContentType, ctype)
-		return w.writeGRPCWeb(response, err)
+	for _, handler := range w.handlers {
+		if _, ok := handler.ContentTypes()[ctype]; ok {
+			return handler.WriteError(response, request, err)
+		}
 	}
 	return fmt.Errorf("unsupported Content-Type %q", ctype)
 }
-
-func (w *ErrorWriter) writeConnectUnary(response http.ResponseWriter, err error) error {
-	if connectErr, ok := asError(err); ok {
-		mergeHeaders(response.Header(), connectErr.meta)
-	}
-	response.WriteHeader(connectCodeToHTTP(CodeOf(err)))
-	data, marshalErr := json.Marshal(newConnectWireError(err))
-	if marshalErr != nil {
-		return fmt.Errorf("marshal error: %w", marshalErr)
-	}
-	_, writeErr := response.Write(data)
-	return writeErr
-}
-
-func (w *ErrorWriter) writeConnectStreaming(response http.ResponseWriter, err error) error {
-	response.WriteHeader(http.StatusOK)
-	marshaler := &connectStreamingMarshaler{
-		envelopeWriter: envelopeWriter{
-			writer:     response,
-			bufferPool: w.bufferPool,
-		},
-	}
-	// MarshalEndStream returns *Error: check return value to avoid typed nils.
-	if marshalErr := marshaler.MarshalEndStream(err, make(http.Header)); marshalErr != nil {
-		return marshalErr
-	}
-	return nil
-}
-
-func (w *ErrorWriter) writeGRPC(response http.ResponseWriter, err error) error {
-	trailers := make(http.Header, 2) // need space for at least code & message
-	grpcErrorToTrailer(w.bufferPool, trailers, w.protobuf, err)
-	// To make net/http reliably send trailers without a body, we must set the
-	// Trailers header rather than using http.TrailerPrefix. See
-	// https://github.com/golang/go/issues/54723.
-	keys := make([]string, 0, len(trailers))
-	for k := range trailers {
-		keys = append(keys, k)
-	}
-	setHeaderCanonical(response.Header(), headerTrailer, strings.Join(keys, ","))
-	response.WriteHeader(http.StatusOK)
-	mergeHeaders(response.Header(), trailers)
-	return nil
-}
-
-func (w *ErrorWriter) writeGRPCWeb(response http.ResponseWriter, err error) error {
-	// This is a trailers-only response. To match the behavior of Envoy and
-	// protocol_grpc.go, put the trailers in the HTTP headers.
-	grpcErrorToTrailer(w.bufferPool, response.Header(), w.protobuf, err)
-	response.WriteHeader(http.StatusOK)
-	return nil
-}
@@ -0,0 +1,461 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	headerTrailer = "Trailer"
+	// Text messages only carry headers, so we can afford to cap their size.
+	maxTextBytes = 1 << 20
+
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+var errClosed = errors.New("websocket closed before end of stream")
+
+// frameConn reads and writes WebSocket frames. Reads must be serialized,
+// but writes are safe to call concurrently with each other and with reads.
+type frameConn struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	isClient bool // clients mask outgoing frames and expect unmasked frames
+
+	writeMu sync.Mutex
+
+	// State of the binary frame being read.
+	remaining int64
+	masked    bool
+	maskKey   [4]byte
+	maskPos   int
+}
+
+type frameHeader struct {
+	fin     bool
+	opcode  byte
+	length  int64
+	masked  bool
+	maskKey [4]byte
+}
+
+func (c *frameConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | opcode // always FIN
+	var maskBit byte
+	if c.isClient {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = maskBit | byte(length)
+	case length <= 0xffff:
+		header[1] = maskBit | 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = maskBit | 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	frame := payload
+	if c.isClient {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return err
+		}
+		header = append(header, maskKey[:]...)
+		frame = make([]byte, len(payload))
+		for i, b := range payload {
+			frame[i] = b ^ maskKey[i%4]
+		}
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.conn.Write(append(header, frame...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *frameConn) readFrameHeader() (frameHeader, error) {
+	var frame frameHeader
+	var prefix [2]byte
+	if _, err := io.ReadFull(c.reader, prefix[:]); err != nil {
+		return frame, err
+	}
+	frame.fin = prefix[0]&0x80 != 0
+	frame.opcode = prefix[0] & 0x0f
+	frame.masked = prefix[1]&0x80 != 0
+	frame.length = int64(prefix[1] & 0x7f)
+	switch frame.length {
+	case 126:
+		var length [2]byte
+		if _, err := io.ReadFull(c.reader, length[:]); err != nil {
+			return frame, err
+		}
+		frame.length = int64(binary.BigEndian.Uint16(length[:]))
+	case 127:
+		var length [8]byte
+		if _, err := io.ReadFull(c.reader, length[:]); err != nil {
+			return frame, err
+		}
+		frame.length = int64(binary.BigEndian.Uint64(length[:]))
+		if frame.length < 0 {
+			return frame, errors.New("websocket tunnel: invalid frame length")
+		}
+	}
+	if frame.masked == c.isClient {
+		return frame, errors.New("websocket tunnel: invalid frame masking")
+	}
+	if frame.masked {
+		if _, err := io.ReadFull(c.reader, frame.maskKey[:]); err != nil {
+			return frame, err
+		}
+	}
+	if frame.opcode >= opClose && (frame.length > 125 || !frame.fin) {
+		return frame, errors.New("websocket tunnel: invalid control frame")
+	}
+	return frame, nil
+}
+
+func (c *frameConn) readPayload(frame frameHeader, limit int64) ([]byte, error) {
+	if frame.length > limit {
+		return nil, fmt.Errorf("websocket tunnel: message larger than %d bytes", limit)
+	}
+	payload := make([]byte, frame.length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return nil, err
+	}
+	if frame.masked {
+		for i := range payload {
+			payload[i] ^= frame.maskKey[i%4]
+		}
+	}
+	return payload, nil
+}
+
+// next reads frames until it finds data. For binary data, it sets up the
+// connection to read the frame's payload with Read and returns a nil slice.
+// For text messages, it returns the whole message.
+func (c *frameConn) next() ([]byte, error) {
+	text := []byte{} // non-nil, even for empty messages
+	inText := false
+	for {
+		frame, err := c.readFrameHeader()
+		if err != nil {
+			return nil, err
+		}
+		switch frame.opcode {
+		case opPing:
+			payload, err := c.readPayload(frame, 125)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+			if _, err := c.readPayload(frame, 125); err != nil {
+				return nil, err
+			}
+		case opClose:
+			return nil, errClosed
+		case opText, opContinuation:
+			if frame.opcode == opContinuation && !inText {
+				// Continuation of a binary message.
+				c.startBinary(frame)
+				return nil, nil
+			}
+			payload, err := c.readPayload(frame, maxTextBytes-int64(len(text)))
+			if err != nil {
+				return nil, err
+			}
+			text = append(text, payload...)
+			if frame.fin {
+				return text, nil
+			}
+			inText = true
+		case opBinary:
+			if inText {
+				return nil, errors.New("websocket tunnel: interleaved messages")
+			}
+			c.startBinary(frame)
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("websocket tunnel: unknown opcode %#x", frame.opcode)
+		}
+	}
+}
+
+func (c *frameConn) startBinary(frame frameHeader) {
+	c.remaining = frame.length
+	c.masked = frame.masked
+	c.maskKey = frame.maskKey
+	c.maskPos = 0
+}
+
+// readBody reads binary data into data. When it reaches a text message, it
+// returns the message and no data.
+func (c *frameConn) readBody(data []byte) (int, []byte, error) {
+	for c.remaining == 0 {
+		text, err := c.next()
+		if err != nil {
+			return 0, nil, err
+		}
+		if text != nil {
+			return 0, text, nil
+		}
+	}
+	if int64(len(data)) > c.remaining {
+		data = data[:c.remaining]
+	}
+	bytesRead, err := c.reader.Read(data)
+	if c.masked {
+		for i := 0; i < bytesRead; i++ {
+			data[i] ^= c.maskKey[c.maskPos%4]
+			c.maskPos++
+		}
+	}
+	c.remaining -= int64(bytesRead)
+	return bytesRead, nil, err
+}
+
+// readText reads the next text message, which must come before any binary
+// data.
+func (c *frameConn) readText() ([]byte, error) {
+	text, err := c.next()
+	if err != nil {
+		return nil, err
+	}
+	if text == nil {
+		return nil, errors.New("websocket tunnel: expected text message")
+	}
+	return text, nil
+}
+
+// sendHeader sends the request headers, which must come before the body.
+func (c *frameConn) sendHeader(header http.Header) error {
+	var buffer bytes.Buffer
+	writeHeaderBlock(&buffer, header)
+	return c.writeFrame(opText, buffer.Bytes())
+}
+
+func (c *frameConn) sendBody(body io.ReadCloser) error {
+	if body == nil || body == http.NoBody {
+		return c.writeFrame(opText, nil)
+	}
+	defer body.Close()
+	buffer := make([]byte, 32*1024)
+	for {
+		bytesRead, err := body.Read(buffer)
+		if bytesRead > 0 {
+			if writeErr := c.writeFrame(opBinary, buffer[:bytesRead]); writeErr != nil {
+				return writeErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return c.writeFrame(opText, nil)
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *frameConn) close() error {
+	// Status code 1000 is a normal closure.
+	_ = c.writeFrame(opClose, []byte{0x03, 0xe8})
+	return c.conn.Close()
+}
+
+func writeHeaderBlock(buffer *bytes.Buffer, header http.Header) {
+	_ = header.Write(buffer)
+	buffer.WriteString("\r\n")
+}
+
+func parseHeaderBlock(block []byte) (string, http.Header, error) {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(block)))
+	firstLine, err := reader.ReadLine()
+	if err != nil {
+		return "", nil, fmt.Errorf("websocket tunnel: invalid header block: %w", err)
+	}
+	mimeHeader, err := reader.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, fmt.Errorf("websocket tunnel: invalid header block: %w", err)
+	}
+	return firstLine, http.Header(mimeHeader), nil
+}
+
+type requestBody struct {
+	conn   *frameConn
+	cancel context.CancelFunc
+	done   bool
+}
+
+func (b *requestBody) Read(data []byte) (int, error) {
+	if b.done {
+		return 0, io.EOF
+	}
+	bytesRead, text, err := b.conn.readBody(data)
+	if err != nil {
+		// The client went away or misbehaved, so stop the RPC.
+		b.cancel()
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return bytesRead, err
+	}
+	if text != nil {
+		b.done = true
+		return 0, io.EOF
+	}
+	return bytesRead, nil
+}
+
+func (b *requestBody) Close() error {
+	return nil
+}
+
+type responseBody struct {
+	conn    *frameConn
+	trailer http.Header
+	close   func()
+	done    bool
+}
+
+func (b *responseBody) Read(data []byte) (int, error) {
+	if b.done {
+		return 0, io.EOF
+	}
+	bytesRead, text, err := b.conn.readBody(data)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return bytesRead, err
+	}
+	if text != nil {
+		b.done = true
+		// The trailer block has no status line, so prepend an empty one.
+		_, trailer, err := parseHeaderBlock(append([]byte("\r\n"), text...))
+		if err != nil {
+			return 0, err
+		}
+		for key, values := range trailer {
+			b.trailer[key] = values
+		}
+		return 0, io.EOF
+	}
+	return bytesRead, nil
+}
+
+func (b *responseBody) Close() error {
+	b.close()
+	return nil
+}
+
+// tunnelWriter sends an http.Handler's response through the
+// tunnel. Each Write is sent immediately, so Flush only needs to make sure the
+// headers are sent.
+type tunnelWriter struct {
+	conn        *frameConn
+	header      http.Header
+	wroteHeader bool
+	err         error
+}
+
+func (w *tunnelWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *tunnelWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := make(http.Header, len(w.header))
+	for key, values := range w.header {
+		if key == headerTrailer || strings.HasPrefix(key, http.TrailerPrefix) {
+			continue
+		}
+		header[key] = values
+	}
+	buffer := bytes.NewBufferString(strconv.Itoa(statusCode) + "\r\n")
+	writeHeaderBlock(buffer, header)
+	w.err = w.conn.writeFrame(opText, buffer.Bytes())
+}
+
+func (w *tunnelWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.err != nil {
+		return 0, w.err
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if err := w.conn.writeFrame(opBinary, data); err != nil {
+		w.err = err
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *tunnelWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (w *tunnelWriter) finish() error {
+	w.WriteHeader(http.StatusOK)
+	trailer := make(http.Header)
+	for _, declared := range w.header.Values(headerTrailer) {
+		for _, key := range strings.Split(declared, ",") {
+			key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+			if values, ok := w.header[key]; ok {
+				trailer[key] = values
+			}
+		}
+	}
+	for key, values := range w.header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			trailer[http.CanonicalHeaderKey(strings.TrimPrefix(key, http.TrailerPrefix))] = values
+		}
+	}
+	if w.err == nil {
+		var buffer bytes.Buffer
+		writeHeaderBlock(&buffer, trailer)
+		w.err = w.conn.writeFrame(opText, buffer.Bytes())
+	}
+	if err := w.conn.close(); err != nil && w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
@@ -0,0 +1,386 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package websocket tunnels Connect, gRPC, and gRPC-Web RPCs over WebSocket
+// connections (RFC 6455), so that bidirectional streams work on networks that
+// block HTTP/2 or buffer streaming bodies but allow WebSockets.
+//
+// EXPERIMENTAL: The tunnel's wire format isn't part of the Connect protocol,
+// and this package may change or be removed in a future release. It's outside
+// the connect package so that it can evolve without affecting the core API.
+//
+// The tunnel carries a single HTTP request and response over each WebSocket
+// connection. Binary messages carry the request and response bodies unchanged,
+// so RPC messages keep the protocol's usual envelope framing. Text messages
+// carry everything else:
+//
+//   - The client's first message is a text message with the request headers
+//     in HTTP/1 format, without a request line. Browsers can't set headers
+//     like Content-Type on the WebSocket handshake, so they must be sent here.
+//   - The client sends an empty text message after the last byte of the
+//     request body.
+//   - The server's first message is a text message with the response status
+//     code on the first line, followed by the response headers in HTTP/1
+//     format.
+//   - The server's last message before closing the connection is a text
+//     message with the response trailers in HTTP/1 format.
+//
+// The request's method is always POST, and its path is the handshake's path.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // required by RFC 6455
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bufbuild/connect-go"
+)
+
+const (
+	// tunnelProto is the Proto of tunneled requests and responses. The connect
+	// package recognizes it as full-duplex, so bidirectional streams are
+	// allowed even though the tunnel usually runs over HTTP/1.1.
+	tunnelProto = "connect-websocket"
+	subprotocol = "connect-tunnel"
+	acceptGUID  = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// A HandlerOption configures a handler constructed with [NewHandler].
+type HandlerOption interface {
+	applyToHandler(*handlerConfig)
+}
+
+// WithAllowedOrigins allows WebSocket handshakes from browsers on the listed
+// origins, like "https://app.example.com". Origins are compared
+// case-insensitively, and must include the scheme and any non-default port.
+//
+// By default, handlers reject handshakes whose Origin header doesn't match the
+// request's Host. Browsers send cookies with cross-origin WebSocket handshakes
+// and don't apply CORS to them, so without this check any web page could make
+// RPCs with a visitor's credentials. Handshakes without an Origin header come
+// from non-browser clients and are always allowed.
+func WithAllowedOrigins(origins ...string) HandlerOption {
+	return &allowedOriginsOption{origins: origins}
+}
+
+type allowedOriginsOption struct {
+	origins []string
+}
+
+func (o *allowedOriginsOption) applyToHandler(config *handlerConfig) {
+	config.AllowedOrigins = append(config.AllowedOrigins, o.origins...)
+}
+
+type handlerConfig struct {
+	AllowedOrigins []string
+}
+
+// allowsOrigin reports whether a handshake is same-origin, allowlisted, or
+// from a client that isn't a browser.
+func (c *handlerConfig) allowsOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, request.Host)
+}
+
+// NewHandler wraps an [http.Handler] so that it also accepts RPCs tunneled
+// over WebSockets by clients using [NewClient] (or browser clients speaking
+// the same wire format). Requests that aren't WebSocket upgrades pass through
+// to the wrapped handler, so both can share a route. Tunneled requests are
+// full-duplex, so they support bidirectional streaming even when proxies
+// between the client and server only speak HTTP/1.1.
+//
+// Most request headers arrive after the handshake, so middleware wrapping the
+// returned handler only sees the handshake's headers (including cookies).
+// Wrap the handler passed to NewHandler to see the tunneled request's headers.
+func NewHandler(handler http.Handler, options ...HandlerOption) http.Handler {
+	var config handlerConfig
+	for _, opt := range options {
+		opt.applyToHandler(&config)
+	}
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if !isUpgrade(request.Header) {
+			handler.ServeHTTP(responseWriter, request)
+			return
+		}
+		key := request.Header.Get("Sec-Websocket-Key")
+		if request.Method != http.MethodGet ||
+			request.Header.Get("Sec-Websocket-Version") != "13" ||
+			key == "" {
+			responseWriter.Header().Set("Sec-Websocket-Version", "13")
+			responseWriter.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !config.allowsOrigin(request) {
+			http.Error(responseWriter, "websocket tunnel: origin not allowed", http.StatusForbidden)
+			return
+		}
+		hijacker, ok := responseWriter.(http.Hijacker)
+		if !ok {
+			responseWriter.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		netConn, buffered, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+		defer netConn.Close()
+		fmt.Fprintf(
+			buffered,
+			"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-Websocket-Accept: %s\r\nSec-Websocket-Protocol: %s\r\n\r\n",
+			acceptKey(key),
+			subprotocol,
+		)
+		if err := buffered.Flush(); err != nil {
+			return
+		}
+		conn := &frameConn{conn: netConn, reader: buffered.Reader}
+		block, err := conn.readText()
+		if err != nil {
+			_ = conn.close()
+			return
+		}
+		// The header block has no request line, so prepend an empty one.
+		_, header, err := parseHeaderBlock(append([]byte("\r\n"), block...))
+		if err != nil {
+			_ = conn.close()
+			return
+		}
+
+		ctx, cancel := context.WithCancel(request.Context())
+		defer cancel()
+		tunneled := request.Clone(ctx)
+		tunneled.Method = http.MethodPost
+		tunneled.Proto = tunnelProto
+		tunneled.ProtoMajor, tunneled.ProtoMinor = 1, 1
+		tunneled.ContentLength = -1
+		for _, key := range []string{
+			"Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version",
+			"Sec-Websocket-Protocol", "Sec-Websocket-Extensions",
+		} {
+			delete(tunneled.Header, key)
+		}
+		for key, values := range header {
+			tunneled.Header[key] = values
+		}
+		tunneled.Body = &requestBody{conn: conn, cancel: cancel}
+		tunneledWriter := &tunnelWriter{conn: conn, header: make(http.Header)}
+		handler.ServeHTTP(tunneledWriter, tunneled)
+		_ = tunneledWriter.finish()
+	})
+}
+
+// NewClient returns a [connect.HTTPClient] that tunnels each request over a
+// new WebSocket connection to a handler wrapped with [NewHandler]. Since the
+// tunnel is full-duplex, clients can use it for bidirectional streaming over
+// HTTP/1.1. Tunneled connections aren't pooled, so the WebSocket handshake
+// adds a round trip to every RPC.
+//
+// If dial is nil, the client dials with a [net.Dialer] and uses TLS for https
+// URLs. Otherwise, dial is responsible for establishing TLS.
+func NewClient(dial func(ctx context.Context, network, address string) (net.Conn, error)) connect.HTTPClient {
+	return &client{dial: dial}
+}
+
+type client struct {
+	dial func(context.Context, string, string) (net.Conn, error)
+}
+
+func (c *client) Do(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	netConn, err := c.dialContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	// net.Conn doesn't respect contexts, so we close the connection to unblock
+	// reads and writes if the context is canceled.
+	done := make(chan struct{})
+	var closeOnce sync.Once
+	closeConn := func() {
+		closeOnce.Do(func() {
+			close(done)
+			netConn.Close()
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeConn()
+		case <-done:
+		}
+	}()
+	conn, err := handshake(netConn, request)
+	if err != nil {
+		closeConn()
+		return nil, contextErrorOr(ctx, err)
+	}
+	if err := conn.sendHeader(request.Header); err != nil {
+		closeConn()
+		return nil, contextErrorOr(ctx, err)
+	}
+	go func() {
+		if err := conn.sendBody(request.Body); err != nil {
+			closeConn()
+		}
+	}()
+	header, err := conn.readText()
+	if err != nil {
+		closeConn()
+		return nil, contextErrorOr(ctx, err)
+	}
+	statusLine, responseHeader, err := parseHeaderBlock(header)
+	if err != nil {
+		closeConn()
+		return nil, err
+	}
+	statusCode, err := strconv.Atoi(statusLine)
+	if err != nil {
+		closeConn()
+		return nil, fmt.Errorf("websocket tunnel: invalid status %q", statusLine)
+	}
+	response := &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         tunnelProto,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        responseHeader,
+		Trailer:       make(http.Header),
+		ContentLength: -1,
+		Request:       request,
+	}
+	response.Body = &responseBody{conn: conn, trailer: response.Trailer, close: closeConn}
+	return response, nil
+}
+
+func (c *client) dialContext(ctx context.Context, request *http.Request) (net.Conn, error) {
+	port := request.URL.Port()
+	if port == "" {
+		port = "80"
+		if request.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	address := net.JoinHostPort(request.URL.Hostname(), port)
+	if c.dial != nil {
+		return c.dial(ctx, "tcp", address)
+	}
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil || request.URL.Scheme != "https" {
+		return netConn, err
+	}
+	tlsConn := tls.Client(netConn, &tls.Config{
+		ServerName: request.URL.Hostname(),
+		MinVersion: tls.VersionTLS12,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// handshake upgrades the connection. Like a browser, it only sends the
+// headers required by RFC 6455: the request's headers follow in the first
+// text message.
+func handshake(netConn net.Conn, request *http.Request) (*frameConn, error) {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	upgrade := &http.Request{
+		Method:     http.MethodGet,
+		URL:        request.URL,
+		Host:       request.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+	if userAgent := request.Header.Get("User-Agent"); userAgent != "" {
+		upgrade.Header.Set("User-Agent", userAgent)
+	}
+	upgrade.Header.Set("Upgrade", "websocket")
+	upgrade.Header.Set("Connection", "Upgrade")
+	upgrade.Header.Set("Sec-Websocket-Key", key)
+	upgrade.Header.Set("Sec-Websocket-Version", "13")
+	upgrade.Header.Set("Sec-Websocket-Protocol", subprotocol)
+	if err := upgrade.Write(netConn); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(netConn)
+	response, err := http.ReadResponse(reader, upgrade)
+	if err != nil {
+		return nil, err
+	}
+	discardHandshakeBody(response)
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("websocket tunnel: handshake failed with HTTP status %v", response.Status)
+	}
+	if response.Header.Get("Sec-Websocket-Accept") != acceptKey(key) {
+		return nil, errors.New("websocket tunnel: handshake failed with invalid Sec-WebSocket-Accept")
+	}
+	return &frameConn{conn: netConn, reader: reader, isClient: true}, nil
+}
+
+// discardHandshakeBody closes the body of a handshake response. A 101
+// response has no body, so this doesn't consume tunneled data.
+func discardHandshakeBody(response *http.Response) {
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxTextBytes))
+	}
+	response.Body.Close()
+}
+
+func contextErrorOr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func isUpgrade(header http.Header) bool {
+	return strings.EqualFold(header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(header.Get("Connection")), "upgrade")
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID)) //nolint:gosec // required by RFC 6455
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,160 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/experimental/websocket"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+type pingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (pingServer) Ping(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+	if request.Msg.Number < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("negative"))
+	}
+	response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number})
+	response.Header().Set("Tunneled", request.Peer().Protocol)
+	response.Trailer().Set("Checksum", "abc")
+	return response, nil
+}
+
+func (pingServer) CumSum(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+	var sum int64
+	for {
+		request, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		sum += request.Number
+		if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestTunnel(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	// A plain HTTP/1.1 server: without the tunnel, bidi streams would fail.
+	server := httptest.NewServer(websocket.NewHandler(mux))
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(websocket.NewClient(nil), server.URL, opts...)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 42)
+		assert.Equal(t, response.Trailer().Get("Checksum"), "abc")
+
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+
+		stream := client.CumSum(context.Background())
+		for i, number := range []int64{1, 2, 3} {
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: number}))
+			msg, err := stream.Receive()
+			assert.Nil(t, err)
+			assert.Equal(t, msg.Sum, []int64{1, 3, 6}[i])
+		}
+		assert.Nil(t, stream.CloseRequest())
+		_, err = stream.Receive()
+		assert.True(t, errors.Is(err, io.EOF))
+		assert.Nil(t, stream.CloseResponse())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+	t.Run("passthrough", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 1)
+		assert.Equal(t, response.Header().Get("Tunneled"), "connect")
+
+		// Without the tunnel, bidi streams need HTTP/2.
+		stream := client.CumSum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		_, err = stream.Receive()
+		assert.NotNil(t, err)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+		assert.True(t, strings.Contains(err.Error(), "bidi streams require at least HTTP/2"))
+		assert.Nil(t, stream.CloseResponse())
+	})
+}
+
+func TestHandlerOrigin(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(websocket.NewHandler(
+		mux,
+		websocket.WithAllowedOrigins("https://app.example.com"),
+	))
+	t.Cleanup(server.Close)
+	handshake := func(t *testing.T, origin string) int {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodGet,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+			http.NoBody,
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Upgrade", "websocket")
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Sec-Websocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		request.Header.Set("Sec-Websocket-Version", "13")
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		assert.Nil(t, response.Body.Close())
+		return response.StatusCode
+	}
+	assert.Equal(t, handshake(t, ""), http.StatusSwitchingProtocols)
+	assert.Equal(t, handshake(t, server.URL), http.StatusSwitchingProtocols)
+	assert.Equal(t, handshake(t, "https://APP.example.com"), http.StatusSwitchingProtocols)
+	assert.Equal(t, handshake(t, "https://evil.example.com"), http.StatusForbidden)
+	assert.Equal(t, handshake(t, "null"), http.StatusForbidden)
+}
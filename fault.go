@@ -0,0 +1,131 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// A FaultPolicy describes the faults injected by the interceptor returned from
+// [NewFaultInjectionInterceptor].
+type FaultPolicy struct {
+	// Procedures restricts injection to the listed procedures (for example,
+	// "/acme.foo.v1.FooService/Bar"). If empty, faults may be injected into any
+	// RPC.
+	Procedures []string
+	// Probability is the chance that an RPC is faulted, from 0 to 1.
+	Probability float64
+	// Delay is added before faulted RPCs proceed or fail. Delays end early if
+	// the context is done.
+	Delay time.Duration
+	// Code is the code of the error returned from faulted RPCs. If zero,
+	// faulted RPCs are only delayed.
+	Code Code
+	// Rand returns pseudo-random numbers in [0, 1). Tests may supply their own
+	// source to make injection deterministic. It must be safe to call
+	// concurrently. If nil, the math/rand package's global source is used.
+	Rand func() float64
+}
+
+// NewFaultInjectionInterceptor returns an interceptor that delays or fails
+// RPCs according to the supplied policy. It works in both clients and
+// handlers, so it's useful for exercising retries, timeouts, and circuit
+// breakers in tests.
+//
+// Fault injection is intended for testing only: errors are returned before
+// the real client or handler runs, and their messages clearly state that
+// they were injected. Don't use it in production.
+func NewFaultInjectionInterceptor(policy FaultPolicy) Interceptor {
+	interceptor := &faultInterceptor{
+		probability: policy.Probability,
+		delay:       policy.Delay,
+		code:        policy.Code,
+		random:      policy.Rand,
+	}
+	if interceptor.random == nil {
+		interceptor.random = rand.Float64 //nolint:gosec // not used for security
+	}
+	if len(policy.Procedures) > 0 {
+		interceptor.procedures = make(map[string]struct{}, len(policy.Procedures))
+		for _, procedure := range policy.Procedures {
+			interceptor.procedures[procedure] = struct{}{}
+		}
+	}
+	return interceptor
+}
+
+type faultInterceptor struct {
+	procedures  map[string]struct{}
+	probability float64
+	delay       time.Duration
+	code        Code
+	random      func() float64
+}
+
+func (i *faultInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if err := i.inject(ctx, request.Spec()); err != nil {
+			return nil, err
+		}
+		return next(ctx, request)
+	}
+}
+
+func (i *faultInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		conn := next(ctx, spec)
+		if err := i.inject(ctx, spec); err != nil {
+			return &erroredStreamingClientConn{StreamingClientConn: conn, err: err}
+		}
+		return conn
+	}
+}
+
+func (i *faultInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		if err := i.inject(ctx, conn.Spec()); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+// inject decides whether to fault the RPC, waits for any configured delay, and
+// returns the injected error (if any).
+func (i *faultInterceptor) inject(ctx context.Context, spec Spec) error {
+	if i.procedures != nil {
+		if _, ok := i.procedures[spec.Procedure]; !ok {
+			return nil
+		}
+	}
+	if i.random() >= i.probability {
+		return nil
+	}
+	if i.delay > 0 {
+		timer := time.NewTimer(i.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return wrapIfContextError(ctx.Err())
+		}
+	}
+	if i.code == 0 {
+		return nil
+	}
+	return errorf(i.code, "injected fault in %s", spec.Procedure)
+}
@@ -0,0 +1,133 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestFaultInjectionInterceptor(t *testing.T) {
+	t.Parallel()
+	const pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	newServer := func(t *testing.T, calls *int32, opts ...connect.HandlerOption) *httptest.Server {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+			ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				atomic.AddInt32(calls, 1)
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+			countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				atomic.AddInt32(calls, 1)
+				return stream.Send(&pingv1.CountUpResponse{})
+			},
+		}, opts...))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server
+	}
+	// sequence returns a deterministic source of "random" numbers.
+	sequence := func(values ...float64) func() float64 {
+		var i int32
+		return func() float64 {
+			return values[int(atomic.AddInt32(&i, 1)-1)%len(values)]
+		}
+	}
+
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		var calls int32
+		server := newServer(t, &calls)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithInterceptors(connect.NewFaultInjectionInterceptor(connect.FaultPolicy{
+				Probability: 0.5,
+				Code:        connect.CodeUnavailable,
+				Rand:        sequence(0.1, 0.9),
+			})),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, atomic.LoadInt32(&calls), 0)
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, atomic.LoadInt32(&calls), 1)
+	})
+	t.Run("client_streaming", func(t *testing.T) {
+		t.Parallel()
+		var calls int32
+		server := newServer(t, &calls)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithInterceptors(connect.NewFaultInjectionInterceptor(connect.FaultPolicy{
+				Probability: 1,
+				Code:        connect.CodeUnavailable,
+			})),
+		)
+		_, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.Equal(t, atomic.LoadInt32(&calls), 0)
+	})
+	t.Run("handler_procedures", func(t *testing.T) {
+		t.Parallel()
+		var calls int32
+		server := newServer(t, &calls, connect.WithInterceptors(
+			connect.NewFaultInjectionInterceptor(connect.FaultPolicy{
+				Procedures:  []string{pingProcedure},
+				Probability: 1,
+				Code:        connect.CodeResourceExhausted,
+			}),
+		))
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		assert.Equal(t, atomic.LoadInt32(&calls), 0)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Nil(t, stream.Close())
+		assert.Equal(t, atomic.LoadInt32(&calls), 1)
+	})
+	t.Run("delay", func(t *testing.T) {
+		t.Parallel()
+		var calls int32
+		server := newServer(t, &calls)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithInterceptors(connect.NewFaultInjectionInterceptor(connect.FaultPolicy{
+				Probability: 1,
+				Delay:       time.Minute,
+			})),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		assert.Equal(t, atomic.LoadInt32(&calls), 0)
+	})
+}
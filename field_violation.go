@@ -0,0 +1,171 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const badRequestTypeName = "google.rpc.BadRequest"
+
+// A FieldViolation describes one invalid field in a request, like the
+// FieldViolation message in the google.rpc.BadRequest error detail.
+type FieldViolation struct {
+	// Field is a path to the invalid field, like "items[2].sku".
+	Field string
+	// Description explains why the field is invalid.
+	Description string
+}
+
+// FieldViolations accumulates field violations, so that handlers can report
+// every problem with a request at once rather than failing on the first. It's
+// especially useful in client streaming handlers that validate each uploaded
+// message. The zero value is ready to use.
+type FieldViolations struct {
+	violations []FieldViolation
+}
+
+// Add records a violation.
+func (v *FieldViolations) Add(field, description string) {
+	v.violations = append(v.violations, FieldViolation{Field: field, Description: description})
+}
+
+// Len returns the number of violations recorded.
+func (v *FieldViolations) Len() int {
+	return len(v.violations)
+}
+
+// Err returns nil if there are no violations. Otherwise, it returns an error
+// with CodeInvalidArgument and a single google.rpc.BadRequest detail listing
+// every violation (see [NewBadRequestErrorDetail]). The error's message
+// describes the first violation.
+func (v *FieldViolations) Err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	first := v.violations[0]
+	var err *Error
+	if more := len(v.violations) - 1; more > 0 {
+		err = errorf(CodeInvalidArgument, "%s: %s (and %d more violations)", first.Field, first.Description, more)
+	} else {
+		err = errorf(CodeInvalidArgument, "%s: %s", first.Field, first.Description)
+	}
+	err.AddDetail(NewBadRequestErrorDetail(v.violations...))
+	return err
+}
+
+// NewBadRequestErrorDetail constructs a google.rpc.BadRequest error detail
+// listing the violations. It's sent like any other Protobuf detail by all
+// three protocols, and clients can unmarshal it with the BadRequest type from
+// [google.golang.org/genproto/googleapis/rpc/errdetails].
+func NewBadRequestErrorDetail(violations ...FieldViolation) *ErrorDetail {
+	// Encode the message by hand, so that we don't need to depend on genproto.
+	//
+	//	message BadRequest {
+	//	  message FieldViolation {
+	//	    string field = 1;
+	//	    string description = 2;
+	//	  }
+	//	  repeated FieldViolation field_violations = 1;
+	//	}
+	var value []byte
+	for _, violation := range violations {
+		var encoded []byte
+		if violation.Field != "" {
+			encoded = protowire.AppendTag(encoded, 1, protowire.BytesType)
+			encoded = protowire.AppendString(encoded, violation.Field)
+		}
+		if violation.Description != "" {
+			encoded = protowire.AppendTag(encoded, 2, protowire.BytesType)
+			encoded = protowire.AppendString(encoded, violation.Description)
+		}
+		value = protowire.AppendTag(value, 1, protowire.BytesType)
+		value = protowire.AppendBytes(value, encoded)
+	}
+	return &ErrorDetail{pb: &anypb.Any{
+		TypeUrl: defaultAnyResolverPrefix + badRequestTypeName,
+		Value:   value,
+	}}
+}
+
+// FieldViolationsFromDetail decodes a google.rpc.BadRequest error detail, so
+// clients can read the violations without depending on genproto. It returns an
+// error if the detail has a different type or is malformed.
+func FieldViolationsFromDetail(detail *ErrorDetail) ([]FieldViolation, error) {
+	if detail.Type() != badRequestTypeName {
+		return nil, fmt.Errorf("detail has type %s, not %s", detail.Type(), badRequestTypeName)
+	}
+	var violations []FieldViolation
+	data := detail.Bytes()
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num != 1 || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		encoded, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		violation, err := decodeFieldViolation(encoded)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, violation)
+	}
+	return violations, nil
+}
+
+func decodeFieldViolation(data []byte) (FieldViolation, error) {
+	var violation FieldViolation
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return violation, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if (num == 1 || num == 2) && typ == protowire.BytesType {
+			value, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return violation, protowire.ParseError(n)
+			}
+			data = data[n:]
+			if num == 1 {
+				violation.Field = value
+			} else {
+				violation.Description = value
+			}
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return violation, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return violation, nil
+}
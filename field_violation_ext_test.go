@@ -0,0 +1,93 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestFieldViolations(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		sum: func(_ context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			var violations connect.FieldViolations
+			var sum int64
+			for i := 0; stream.Receive(); i++ {
+				if number := stream.Msg().Number; number < 0 {
+					violations.Add(fmt.Sprintf("messages[%d].number", i), "must not be negative")
+				} else {
+					sum += number
+				}
+			}
+			if err := stream.Err(); err != nil {
+				return nil, err
+			}
+			if err := violations.Err(); err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(&pingv1.SumResponse{Sum: sum}), nil
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	protocols := map[string]connect.ClientOption{
+		"connect": connect.WithProtoJSON(),
+		"grpc":    connect.WithGRPC(),
+		"grpcweb": connect.WithGRPCWeb(),
+	}
+	for name, opt := range protocols {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			stream := client.Sum(context.Background())
+			for _, number := range []int64{1, -2, 3, -4} {
+				assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: number}))
+			}
+			_, err := stream.CloseAndReceive()
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeInvalidArgument)
+			assert.Equal(t, connectErr.Message(), "messages[1].number: must not be negative (and 1 more violations)")
+			assert.Equal(t, len(connectErr.Details()), 1)
+			assert.Equal(t, connectErr.Details()[0].Type(), "google.rpc.BadRequest")
+			violations, err := connect.FieldViolationsFromDetail(connectErr.Details()[0])
+			assert.Nil(t, err)
+			assert.Equal(t, violations, []connect.FieldViolation{
+				{Field: "messages[1].number", Description: "must not be negative"},
+				{Field: "messages[3].number", Description: "must not be negative"},
+			})
+		})
+	}
+
+	var violations connect.FieldViolations
+	assert.Nil(t, violations.Err())
+	detail, err := connect.NewErrorDetail(&pingv1.PingRequest{})
+	assert.Nil(t, err)
+	_, err = connect.FieldViolationsFromDetail(detail)
+	assert.NotNil(t, err)
+}
@@ -16,8 +16,18 @@ package connect
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 // A Handler is the server-side implementation of a single RPC defined by a
@@ -25,12 +35,38 @@ import (
 //
 // By default, Handlers support the Connect, gRPC, and gRPC-Web protocols with
 // the binary Protobuf and JSON codecs. They support gzip compression using the
-// standard library's [compress/gzip].
+// standard library's [compress/gzip]. Unary Connect requests may ask for the
+// response in a different registered codec with the Accept header (for
+// example, sending binary Protobuf but accepting JSON); otherwise, responses
+// use the request's codec.
+//
+// The context passed to an implementation is canceled as soon as the
+// implementation returns, before the Handler writes the end of the response.
+// Goroutines started by a streaming implementation should watch the context
+// and stop using the stream once it's done: the stream must not be used after
+// the implementation returns.
 type Handler struct {
 	spec             Spec
 	implementation   StreamingHandlerFunc
 	protocolHandlers []protocolHandler
 	acceptPost       string // Accept-Post header
+	sendTimeout      time.Duration
+	errorHooks       []func(context.Context, Spec, error) error
+	rawBodyMaxBytes  int
+	// Replaces the message of server-side errors, if set.
+	redactedErrorMessage string
+	// From WithServerErrorClassifier, if set.
+	serverErrorClassifier func(Code) bool
+	requireHTTP2ForGRPC   bool
+	maxHeaderBytes        int
+	// Whether to report the remaining deadline in a response header.
+	deadlineHeader bool
+	// HTTP methods accepted for RPCs, starting with POST.
+	allowedMethods []string
+	// From WithAccessLog, if set.
+	accessLog func(context.Context, *AccessLogEntry)
+	// Sorted names of the registered codecs, for errors.
+	codecNames []string
 }
 
 // NewUnaryHandler constructs a [Handler] for a request-response procedure.
@@ -60,14 +96,23 @@ func NewUnaryHandler[Req, Res any](
 	if interceptor := config.Interceptor; interceptor != nil {
 		untyped = interceptor.WrapUnary(untyped)
 	}
+	if _, isEmpty := any(new(Req)).(*emptypb.Empty); !isEmpty {
+		config.AllowEmptyRequestBody = false
+	}
+	allowEmpty := config.AllowEmptyRequestBody
+	requestPool := config.RequestPool
 	// Given a stream, how should we call the unary function?
 	implementation := func(ctx context.Context, conn StreamingHandlerConn) error {
-		var msg Req
-		if err := conn.Receive(&msg); err != nil {
+		msg := getPooledRequest[Req](requestPool)
+		if requestPool != nil {
+			defer putPooledRequest(requestPool, msg)
+		}
+		// The gRPC protocols report a request without any messages as io.EOF.
+		if err := conn.Receive(msg); err != nil && !(allowEmpty && errors.Is(err, io.EOF)) {
 			return err
 		}
 		request := &Request[Req]{
-			Msg:    &msg,
+			Msg:    msg,
 			spec:   conn.Spec(),
 			peer:   conn.Peer(),
 			header: conn.RequestHeader(),
@@ -78,16 +123,11 @@ func NewUnaryHandler[Req, Res any](
 		}
 		mergeHeaders(conn.ResponseHeader(), response.Header())
 		mergeHeaders(conn.ResponseTrailer(), response.Trailer())
+		setSuccessHTTPStatus(conn, response)
 		return conn.Send(response.Any())
 	}
 
-	protocolHandlers := config.newProtocolHandlers(StreamTypeUnary)
-	return &Handler{
-		spec:             config.newSpec(StreamTypeUnary),
-		implementation:   implementation,
-		protocolHandlers: protocolHandlers,
-		acceptPost:       sortedAcceptPostValue(protocolHandlers),
-	}
+	return newHandler(config, StreamTypeUnary, implementation)
 }
 
 // NewClientStreamHandler constructs a [Handler] for a client streaming procedure.
@@ -100,7 +140,7 @@ func NewClientStreamHandler[Req, Res any](
 		procedure,
 		StreamTypeClient,
 		func(ctx context.Context, conn StreamingHandlerConn) error {
-			stream := &ClientStream[Req]{conn: conn}
+			stream := &ClientStream[Req]{ctx: ctx, conn: conn}
 			res, err := implementation(ctx, stream)
 			if err != nil {
 				return err
@@ -140,7 +180,7 @@ func NewServerStreamHandler[Req, Res any](
 					peer:   conn.Peer(),
 					header: conn.RequestHeader(),
 				},
-				&ServerStream[Res]{conn: conn},
+				&ServerStream[Res]{ctx: ctx, conn: conn},
 			)
 		},
 		options...,
@@ -159,33 +199,65 @@ func NewBidiStreamHandler[Req, Res any](
 		func(ctx context.Context, conn StreamingHandlerConn) error {
 			return implementation(
 				ctx,
-				&BidiStream[Req, Res]{conn: conn},
+				&BidiStream[Req, Res]{ctx: ctx, conn: conn},
 			)
 		},
 		options...,
 	)
 }
 
-// ServeHTTP implements [http.Handler].
+// ServeHTTP implements [http.Handler]. Since it doesn't need a network
+// connection, it's also a convenient way to unit test a Handler's protocol
+// behavior: pass it an [net/http/httptest.ResponseRecorder] and a request
+// constructed with [net/http/httptest.NewRequest], then check the recorded
+// status, headers, and body. Bidirectional streaming Handlers require
+// HTTP/2, so tests should set the request's ProtoMajor to 2.
 func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	if h.sendTimeout > 0 {
+		responseWriter = newDeadlineResponseWriter(responseWriter, h.sendTimeout)
+	}
+	if h.accessLog == nil {
+		h.serveHTTP(responseWriter, request, nil)
+		return
+	}
+	start := time.Now()
+	counter := &countingResponseWriter{ResponseWriter: responseWriter}
+	entry := &AccessLogEntry{Spec: h.spec}
+	h.serveHTTP(counter, request, entry)
+	entry.HTTPStatus = counter.Status()
+	entry.ResponseBytes = counter.bytes
+	entry.Duration = time.Since(start)
+	h.accessLog(request.Context(), entry)
+}
+
+// serveHTTP serves the RPC, recording its spec, peer, and error in the entry
+// if it's non-nil.
+func (h *Handler) serveHTTP(responseWriter http.ResponseWriter, request *http.Request, entry *AccessLogEntry) {
 	// We don't need to defer functions  to close the request body or read to
 	// EOF: the stream we construct later on already does that, and we only
 	// return early when dealing with misbehaving clients. In those cases, it's
 	// okay if we can't re-use the connection.
 	isBidi := (h.spec.StreamType & StreamTypeBidi) == StreamTypeBidi
-	if isBidi && request.ProtoMajor < 2 {
+	if isBidi && !isFullDuplex(request.Proto, request.ProtoMajor) {
 		// Clients coded to expect full-duplex connections may hang if they've
 		// mistakenly negotiated HTTP/1.1. To unblock them, we must close the
 		// underlying TCP connection.
 		responseWriter.Header().Set("Connection", "close")
 		responseWriter.WriteHeader(http.StatusHTTPVersionNotSupported)
+		if entry != nil {
+			entry.Err = errorf(CodeUnimplemented, "bidi streams require at least HTTP/2, but the request used %s", request.Proto)
+		}
 		return
 	}
 
-	// The gRPC-HTTP2, gRPC-Web, and Connect protocols are all POST-only.
-	if request.Method != http.MethodPost {
-		responseWriter.Header().Set("Allow", http.MethodPost)
+	// The gRPC-HTTP2, gRPC-Web, and Connect protocols are all POST-only, but
+	// WithAdditionalHTTPMethods may allow other methods.
+	if !h.allowsMethod(request.Method) {
+		responseWriter.Header().Set("Allow", strings.Join(h.allowedMethods, ", "))
 		responseWriter.WriteHeader(http.StatusMethodNotAllowed)
+		if entry != nil {
+			entry.Err = errorf(CodeUnimplemented, "HTTP method %s isn't allowed", request.Method)
+		}
 		return
 	}
 
@@ -199,10 +271,30 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 		}
 	}
 	if protocolHandler == nil {
+		// Never guess at the codec: decoding with the wrong one may silently
+		// produce garbage.
 		responseWriter.Header().Set("Accept-Post", h.acceptPost)
-		responseWriter.WriteHeader(http.StatusUnsupportedMediaType)
+		message := h.unsupportedMediaTypeMessage(contentType)
+		http.Error(responseWriter, message, http.StatusUnsupportedMediaType)
+		if entry != nil {
+			entry.Err = NewError(CodeUnimplemented, errors.New(message))
+		}
 		return
 	}
+	if h.requireHTTP2ForGRPC && !isFullDuplex(request.Proto, request.ProtoMajor) {
+		if grpc, ok := protocolHandler.(*grpcHandler); ok && !grpc.web {
+			err := h.handleError(
+				request.Context(),
+				h.spec,
+				errorf(CodeUnimplemented, "gRPC requires HTTP/2, but the request used %s", request.Proto),
+			)
+			if entry != nil {
+				entry.Err = err
+			}
+			grpc.writeRequiresHTTP2(responseWriter, err)
+			return
+		}
+	}
 
 	// Establish a stream and serve the RPC.
 	setHeaderCanonical(request.Header, headerContentType, contentType)
@@ -213,20 +305,134 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	if cancel != nil {
 		defer cancel()
 	}
-	connCloser, ok := protocolHandler.NewConn(
+	if h.deadlineHeader {
+		setEffectiveDeadlineHeader(ctx, responseWriter.Header())
+	}
+	var headerErr *Error
+	if h.maxHeaderBytes > 0 {
+		headerErr = checkHeaderBytes(request.Header, h.maxHeaderBytes)
+	}
+	call := &handlerCall{
+		contentLength: request.ContentLength,
+		classifier:    h.serverErrorClassifier,
+	}
+	var bufferErr *Error
+	if h.rawBodyMaxBytes > 0 && headerErr == nil {
+		call.rawBody, bufferErr = bufferRequestBody(request, h.rawBodyMaxBytes)
+	}
+	call.requestBody = request.Body
+	connCloser, failed := protocolHandler.NewConn(
 		responseWriter,
 		request.WithContext(ctx),
 	)
-	if !ok {
+	call.conn = connCloser
+	// Error hooks see the call too, even if we fail before the implementation
+	// runs.
+	ctx = context.WithValue(ctx, handlerCallKey{}, call)
+	if entry != nil {
+		entry.Spec, entry.Peer = connCloser.Spec(), connCloser.Peer()
+	}
+	if failed != nil {
 		// Failed to create stream, usually because client used an unknown
-		// compression algorithm. Nothing further to do.
+		// compression algorithm.
+		h.closeConn(ctx, connCloser, failed, entry)
 		return
 	}
 	if timeoutErr != nil {
-		_ = connCloser.Close(timeoutErr)
+		h.closeConn(ctx, connCloser, timeoutErr, entry)
 		return
 	}
-	_ = connCloser.Close(h.implementation(ctx, connCloser))
+	if headerErr != nil {
+		h.closeConn(ctx, connCloser, headerErr, entry)
+		return
+	}
+	if bufferErr != nil {
+		h.closeConn(ctx, connCloser, bufferErr, entry)
+		return
+	}
+	// Signal any goroutines started by the implementation that the stream is
+	// about to close.
+	ctx, cancelImplementation := context.WithCancel(ctx)
+	err := h.implementation(ctx, connCloser)
+	cancelImplementation()
+	h.closeConn(ctx, connCloser, err, entry)
+}
+
+// closeConn closes the stream with the handled error, recording the error in
+// the entry if it's non-nil.
+func (h *Handler) closeConn(ctx context.Context, conn handlerConnCloser, err error, entry *AccessLogEntry) {
+	err = h.handleError(ctx, conn.Spec(), err)
+	if entry != nil {
+		entry.Err = err
+	}
+	_ = conn.Close(err)
+}
+
+// unsupportedMediaTypeMessage explains why no protocol accepted the content
+// type, naming the requested codec (if we can tell) and the registered ones.
+func (h *Handler) unsupportedMediaTypeMessage(contentType string) string {
+	supported := strings.Join(h.codecNames, ", ")
+	if contentType == "" {
+		return "missing Content-Type; supported codecs: " + supported
+	}
+	requested := codecNameFromContentType(contentType)
+	if requested != "" && !containsString(h.codecNames, requested) {
+		return fmt.Sprintf("unsupported Content-Type %q: codec %q isn't registered; supported codecs: %s", contentType, requested, supported)
+	}
+	return fmt.Sprintf("unsupported Content-Type %q; supported codecs: %s", contentType, supported)
+}
+
+func (h *Handler) allowsMethod(method string) bool {
+	return containsString(h.allowedMethods, method)
+}
+
+// webSocketTunnelProto is the Proto of requests and responses tunneled by the
+// experimental/websocket package, which are full-duplex even though they
+// usually run over HTTP/1.1.
+const webSocketTunnelProto = "connect-websocket"
+
+// isFullDuplex reports whether a request or response's protocol lets both
+// sides stream at once. Handlers and clients use it to reject bidi streams.
+func isFullDuplex(proto string, protoMajor int) bool {
+	return protoMajor >= 2 || proto == webSocketTunnelProto
+}
+
+// handleError runs the hooks configured with WithErrorHook, then redacts the
+// error if configured with WithRedactedServerErrors.
+func (h *Handler) handleError(ctx context.Context, spec Spec, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, hook := range h.errorHooks {
+		if hooked := hook(ctx, spec, err); hooked != nil {
+			err = hooked
+		}
+	}
+	if h.redactedErrorMessage != "" {
+		err = redactServerError(ctx, err, h.redactedErrorMessage)
+	}
+	return err
+}
+
+// PrefixHandler mounts the path and handler returned from a generated
+// service constructor under a path prefix, which is useful when serving RPCs
+// from a sub-path of a larger HTTP application:
+//
+//	path, handler := pingv1connect.NewPingServiceHandler(&pingServer{})
+//	mux.Handle(connect.PrefixHandler("/api/rpc", path, handler))
+//
+// Clients must include the same prefix in their base URL (for example,
+// "https://acme.com/api/rpc"). Procedure names, including those in [Spec],
+// don't include the prefix.
+func PrefixHandler(prefix, path string, handler http.Handler) (string, http.Handler) {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix == "" {
+		return path, handler
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix + path, http.StripPrefix(prefix, handler)
 }
 
 type handlerConfig struct {
@@ -242,6 +448,21 @@ type handlerConfig struct {
 	BufferPool                   *bufferPool
 	ReadMaxBytes                 int
 	SendMaxBytes                 int
+	StreamSendTimeout            time.Duration
+	PayloadTransformer           *payloadTransformer
+	StrictUTF8                   bool
+	AllowEmptyRequestBody        bool
+	RequestPool                  MessagePool
+	ErrorHooks                   []func(context.Context, Spec, error) error
+	RawRequestBodyMaxBytes       int
+	RedactedErrorMessage         string
+	RequireHTTP2ForGRPC          bool
+	MaxHeaderBytes               int
+	EffectiveDeadlineHeader      bool
+	AdditionalHTTPMethods        []string
+	ServerErrorClassifier        func(Code) bool
+	OmitGRPCAcceptEncoding       bool
+	AccessLog                    func(context.Context, *AccessLogEntry)
 }
 
 func newHandlerConfig(procedure string, options []HandlerOption) *handlerConfig {
@@ -270,22 +491,45 @@ func (c *handlerConfig) newSpec(streamType StreamType) Spec {
 	}
 }
 
-func (c *handlerConfig) newProtocolHandlers(streamType StreamType) []protocolHandler {
-	protocols := []protocol{&protocolConnect{}}
-	if c.HandleGRPC {
-		protocols = append(protocols, &protocolGRPC{web: false})
+// allowedHTTPMethods returns POST followed by any additional methods, without
+// duplicates.
+func (c *handlerConfig) allowedHTTPMethods() []string {
+	methods := []string{http.MethodPost}
+	for _, method := range c.AdditionalHTTPMethods {
+		if !containsString(methods, method) {
+			methods = append(methods, method)
+		}
 	}
-	if c.HandleGRPCWeb {
-		protocols = append(protocols, &protocolGRPC{web: true})
+	return methods
+}
+
+func (c *handlerConfig) sortedCodecNames() []string {
+	names := make([]string, 0, len(c.Codecs))
+	for name := range c.Codecs {
+		names = append(names, name)
 	}
-	handlers := make([]protocolHandler, 0, len(protocols))
+	sort.Strings(names)
+	return names
+}
+
+func (c *handlerConfig) newProtocolHandlers(streamType StreamType) []protocolHandler {
+	handlers := make([]protocolHandler, 0, len(handlerProtocols))
 	codecs := newReadOnlyCodecs(c.Codecs)
+	if c.PayloadTransformer != nil {
+		codecs = c.PayloadTransformer.wrapCodecs(codecs)
+	}
+	if c.StrictUTF8 {
+		codecs = wrapCodecs(codecs, newUTF8ValidatingCodec)
+	}
 	compressors := newReadOnlyCompressionPools(
 		c.CompressionPools,
 		c.CompressionNames,
 	)
-	for _, protocol := range protocols {
-		handlers = append(handlers, protocol.NewHandler(&protocolHandlerParams{
+	for _, registered := range handlerProtocols {
+		if !registered.enabled(c) {
+			continue
+		}
+		handlers = append(handlers, registered.protocol.NewHandler(&protocolHandlerParams{
 			Spec:                         c.newSpec(streamType),
 			Codecs:                       codecs,
 			CompressionPools:             compressors,
@@ -294,11 +538,48 @@ func (c *handlerConfig) newProtocolHandlers(streamType StreamType) []protocolHan
 			ReadMaxBytes:                 c.ReadMaxBytes,
 			SendMaxBytes:                 c.SendMaxBytes,
 			RequireConnectProtocolHeader: c.RequireConnectProtocolHeader,
+			AllowEmptyRequestBody:        c.AllowEmptyRequestBody,
+			OmitGRPCAcceptEncoding:       c.OmitGRPCAcceptEncoding,
 		}))
 	}
 	return handlers
 }
 
+// NewDynamicHandler constructs a [Handler] for the procedure described by a
+// Protobuf method descriptor, without generated code. It's useful for proxies,
+// gateways, and other generic tools that load schemas at runtime.
+//
+// The implementation receives and sends messages through the
+// [StreamingHandlerConn] for every stream type, including unary. Receive into
+// messages constructed with [dynamicpb.NewMessage] (or any other
+// [proto.Message] with the appropriate descriptor), since the connection has
+// no way to construct them itself. Because unary RPCs are handled as streams,
+// interceptors' WrapStreamingHandler method applies to all dynamic RPCs.
+//
+// Options are applied by stream type, as they are for generated handlers:
+// [WithRawRequestBody] applies to dynamic unary RPCs, and
+// [WithStreamSendTimeout] applies to the others. Since the implementation
+// receives request messages itself, [WithRequestPool] and
+// [WithAllowEmptyRequestBody] have no effect.
+//
+// [dynamicpb.NewMessage]: https://pkg.go.dev/google.golang.org/protobuf/types/dynamicpb#NewMessage
+// [proto.Message]: https://pkg.go.dev/google.golang.org/protobuf/proto#Message
+func NewDynamicHandler(
+	method protoreflect.MethodDescriptor,
+	implementation StreamingHandlerFunc,
+	options ...HandlerOption,
+) *Handler {
+	procedure := "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+	streamType := StreamTypeUnary
+	if method.IsStreamingClient() {
+		streamType |= StreamTypeClient
+	}
+	if method.IsStreamingServer() {
+		streamType |= StreamTypeServer
+	}
+	return newStreamHandler(procedure, streamType, implementation, options...)
+}
+
 func newStreamHandler(
 	procedure string,
 	streamType StreamType,
@@ -306,14 +587,172 @@ func newStreamHandler(
 	options ...HandlerOption,
 ) *Handler {
 	config := newHandlerConfig(procedure, options)
+	config.AllowEmptyRequestBody = false // only for unary handlers
 	if ic := config.Interceptor; ic != nil {
 		implementation = ic.WrapStreamingHandler(implementation)
 	}
+	return newHandler(config, streamType, implementation)
+}
+
+// newHandler constructs a Handler, applying the options that only make sense
+// for unary or streaming RPCs based on the stream type.
+func newHandler(config *handlerConfig, streamType StreamType, implementation StreamingHandlerFunc) *Handler {
 	protocolHandlers := config.newProtocolHandlers(streamType)
-	return &Handler{
-		spec:             config.newSpec(streamType),
-		implementation:   implementation,
-		protocolHandlers: protocolHandlers,
-		acceptPost:       sortedAcceptPostValue(protocolHandlers),
+	handler := &Handler{
+		spec:                  config.newSpec(streamType),
+		implementation:        implementation,
+		protocolHandlers:      protocolHandlers,
+		acceptPost:            sortedAcceptPostValue(protocolHandlers),
+		errorHooks:            config.ErrorHooks,
+		redactedErrorMessage:  config.RedactedErrorMessage,
+		serverErrorClassifier: config.ServerErrorClassifier,
+		requireHTTP2ForGRPC:   config.RequireHTTP2ForGRPC,
+		maxHeaderBytes:        config.MaxHeaderBytes,
+		deadlineHeader:        config.EffectiveDeadlineHeader,
+		allowedMethods:        config.allowedHTTPMethods(),
+		accessLog:             config.AccessLog,
+		codecNames:            config.sortedCodecNames(),
+	}
+	if streamType == StreamTypeUnary {
+		handler.rawBodyMaxBytes = config.RawRequestBodyMaxBytes
+	} else {
+		handler.sendTimeout = config.StreamSendTimeout
+	}
+	return handler
+}
+
+// MessagePool is a pool of messages, like a [sync.Pool]. See
+// [WithRequestPool].
+type MessagePool interface {
+	Get() any
+	Put(any)
+}
+
+// getPooledRequest returns a request message from the pool, or a new message
+// if there's no pool or the pool returns an unexpected type.
+func getPooledRequest[Req any](pool MessagePool) *Req {
+	if pool != nil {
+		if msg, ok := pool.Get().(*Req); ok && msg != nil {
+			return msg
+		}
+	}
+	return new(Req)
+}
+
+// putPooledRequest resets a request message and returns it to the pool.
+func putPooledRequest[Req any](pool MessagePool, msg *Req) {
+	if protoMsg, ok := any(msg).(proto.Message); ok {
+		proto.Reset(protoMsg)
+	} else {
+		var zero Req
+		*msg = zero
+	}
+	pool.Put(msg)
+}
+
+// DisableResponseCompression turns off compression of the response for the
+// RPC associated with the context, overriding the algorithm negotiated with the
+// client. It's useful when a response is already compressed or a proxy will
+// compress it. Call it from a handler implementation or interceptor using the
+// context passed to it.
+//
+// It reports whether compression was disabled. For unary Connect RPCs, it
+// must be called before the response is sent; the streaming protocols mark
+// each message as compressed or not, so compression may be disabled at any
+// time. It always returns false for contexts that didn't come from a
+// [Handler].
+func DisableResponseCompression(ctx context.Context) bool {
+	call, ok := handlerCallFromContext(ctx)
+	if !ok {
+		return false
+	}
+	disabler, ok := call.conn.(responseCompressionDisabler)
+	if !ok {
+		return false
+	}
+	return disabler.disableResponseCompression()
+}
+
+// setSuccessHTTPStatus passes any status set with Response.SetHTTPStatus to
+// connections for protocols that support custom success statuses.
+func setSuccessHTTPStatus(conn StreamingHandlerConn, response AnyResponse) {
+	withStatus, ok := response.(interface{ successHTTPStatus() int })
+	if !ok {
+		return
+	}
+	status := withStatus.successHTTPStatus()
+	if status == 0 {
+		return
+	}
+	if setter, ok := conn.(successHTTPStatusSetter); ok {
+		setter.setSuccessHTTPStatus(status)
+	}
+}
+
+// checkHeaderBytes returns an error if the request headers are larger than
+// max, counting the length of each header's name and value.
+func checkHeaderBytes(header http.Header, max int) *Error {
+	size := headerBytes(header)
+	if size <= max {
+		return nil
+	}
+	return errorf(CodeResourceExhausted, "request headers are %d bytes, exceeding the %d byte limit", size, max)
+}
+
+// codecNameFromContentType guesses the codec name requested by a content type
+// that no protocol accepted, like "yaml" for "application/grpc+yaml". It
+// returns an empty string if the content type doesn't look like it names a
+// codec.
+func codecNameFromContentType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	for _, prefix := range []string{
+		grpcWebContentTypePrefix,
+		grpcContentTypePrefix,
+		connectStreamingContentTypePrefix,
+		connectUnaryContentTypePrefix,
+	} {
+		if name := strings.TrimPrefix(contentType, prefix); name != contentType {
+			if name == "" || strings.ContainsAny(name, "/+") {
+				return ""
+			}
+			return name
+		}
+	}
+	return ""
+}
+
+// headerBytes sums the length of each header's name and value.
+func headerBytes(header http.Header) int {
+	size := 0
+	for key, values := range header {
+		for _, value := range values {
+			size += len(key) + len(value)
+		}
+	}
+	return size
+}
+
+// setEffectiveDeadlineHeader reports how many milliseconds remain until the
+// context's deadline, if it has one.
+func setEffectiveDeadlineHeader(ctx context.Context, header http.Header) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 0 {
+		remaining = 0
+	}
+	header.Set(EffectiveDeadlineHeader, strconv.FormatInt(remaining, 10))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
 }
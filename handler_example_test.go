@@ -16,7 +16,12 @@ package connect_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 
 	"github.com/bufbuild/connect-go"
 	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
@@ -69,3 +74,88 @@ func Example_handler() {
 	// 	h2c.NewHandler(mux, &http2.Server{}),
 	// )
 }
+
+func ExampleHandler_ServeHTTP() {
+	// Handlers don't need a network connection, so we can test their protocol
+	// behavior with the standard library's httptest package and no generated
+	// code.
+	const procedure = "/connect.ping.v1.PingService/Ping"
+	handler := connect.NewUnaryHandler(procedure, (&ExamplePingServer{}).Ping)
+	serve := func(method, contentType, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, procedure, strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "application/json", "")
+	fmt.Println(recorder.Code, recorder.Header().Get("Allow"))
+	recorder = serve(http.MethodPost, "text/plain", "")
+	fmt.Println(recorder.Code, strings.Contains(recorder.Header().Get("Accept-Post"), "application/json"))
+	recorder = serve(http.MethodPost, "application/json", `{"number": 42}`)
+	fmt.Println(recorder.Code, recorder.Header().Get("Content-Type"))
+	// Output:
+	// 405 POST
+	// 415 true
+	// 200 application/json
+}
+
+func ExampleServerStream_Send() {
+	// Server streams send and flush each message as it's produced, so handlers
+	// can stream large files in chunks without reading them into memory. Here,
+	// we reuse the ping messages to hold each chunk.
+	const procedure = "/example.v1.FileService/Download"
+	const chunkSize = 8
+	download := func(
+		_ context.Context,
+		_ *connect.Request[pingv1.PingRequest],
+		stream *connect.ServerStream[pingv1.PingResponse],
+	) error {
+		file := strings.NewReader("a file that's too large to fit in memory")
+		chunk := make([]byte, chunkSize)
+		for {
+			n, err := file.Read(chunk)
+			if n > 0 {
+				if err := stream.Send(&pingv1.PingResponse{Text: string(chunk[:n])}); err != nil {
+					return err
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewServerStreamHandler(procedure, download))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+procedure,
+	)
+	stream, err := client.CallServerStream(
+		context.Background(),
+		connect.NewRequest(&pingv1.PingRequest{}),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer stream.Close()
+	for stream.Receive() {
+		fmt.Printf("%q\n", stream.Msg().Text)
+	}
+	if err := stream.Err(); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// "a file t"
+	// "hat's to"
+	// "o large "
+	// "to fit i"
+	// "n memory"
+}
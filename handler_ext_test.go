@@ -15,17 +15,29 @@
 package connect_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/bufbuild/connect-go/internal/assert"
 	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
 	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestHandler_ServeHTTP(t *testing.T) {
@@ -71,6 +83,13 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		assert.Nil(t, err)
 		defer resp.Body.Close()
 		assert.Equal(t, resp.StatusCode, http.StatusUnsupportedMediaType)
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Equal(
+			t,
+			string(body),
+			`unsupported Content-Type "application/x-custom-json": codec "x-custom-json" isn't registered; supported codecs: json, json; charset=utf-8, proto`+"\n",
+		)
 		assert.Equal(t, resp.Header.Get("Accept-Post"), strings.Join([]string{
 			"application/grpc",
 			"application/grpc+json",
@@ -146,6 +165,374 @@ func TestHandler_ServeHTTP(t *testing.T) {
 	})
 }
 
+func TestHandlerUnregisteredCodec(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(successPingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	for _, opt := range []connect.ClientOption{connect.WithGRPC(), connect.WithGRPCWeb(), nil} {
+		options := []connect.ClientOption{connect.WithCodec(pingOnlyCodec{})}
+		if opt != nil {
+			options = append(options, opt)
+		}
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, options...)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.NotNil(t, err)
+		// Clients quote the body of the 415 response.
+		assert.True(t, strings.Contains(err.Error(), `codec \"ping-only\" isn't registered; supported codecs: json, json; charset=utf-8, proto`))
+	}
+}
+
+func TestHandlerStreamTrailersOnSuccess(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			// Trailers may be set before, during, and after sending messages.
+			stream.ResponseTrailer().Set("Started", "true")
+			var sum int64
+			for i := int64(1); i <= request.Msg.Number; i++ {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+				sum += i
+				stream.ResponseTrailer().Add("Sent", strconv.FormatInt(i, 10))
+			}
+			stream.ResponseTrailer().Set("Total-Count", strconv.FormatInt(request.Msg.Number, 10))
+			stream.ResponseTrailer().Set("Checksum", strconv.FormatInt(sum, 10))
+			return nil
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	protocols := map[string]connect.ClientOption{
+		connect.ProtocolConnect: connect.WithProtoJSON(),
+		connect.ProtocolGRPC:    connect.WithGRPC(),
+		connect.ProtocolGRPCWeb: connect.WithGRPCWeb(),
+	}
+	for name, protocol := range protocols {
+		protocol := protocol
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, protocol)
+			for _, number := range []int64{0, 3} {
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: number}))
+				assert.Nil(t, err)
+				var received int64
+				for stream.Receive() {
+					received++
+				}
+				assert.Nil(t, stream.Err())
+				assert.Equal(t, received, number)
+				trailer := stream.ResponseTrailer()
+				assert.Equal(t, trailer.Get("Started"), "true")
+				assert.Equal(t, trailer.Get("Total-Count"), strconv.FormatInt(number, 10))
+				assert.Equal(t, trailer.Get("Checksum"), strconv.FormatInt(number*(number+1)/2, 10))
+				if number > 0 {
+					assert.Equal(t, trailer.Values("Sent"), []string{"1", "2", "3"})
+				}
+				assert.Nil(t, stream.Close())
+			}
+		})
+	}
+}
+
+func TestHandlerAcceptNegotiation(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number}), nil
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	const pingProcedure = "/" + pingv1connect.PingServiceName + "/Ping"
+	requestBody, err := proto.Marshal(&pingv1.PingRequest{Number: 42})
+	assert.Nil(t, err)
+
+	ping := func(t *testing.T, accept string) (string, []byte) {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+pingProcedure,
+			bytes.NewReader(requestBody),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/proto")
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		return response.Header.Get("Content-Type"), body
+	}
+	assertProto := func(t *testing.T, accept string) {
+		t.Helper()
+		contentType, body := ping(t, accept)
+		assert.Equal(t, contentType, "application/proto")
+		var response pingv1.PingResponse
+		assert.Nil(t, proto.Unmarshal(body, &response))
+		assert.Equal(t, response.Number, 42)
+	}
+
+	assertJSON := func(t *testing.T, accept string) {
+		t.Helper()
+		contentType, body := ping(t, accept)
+		assert.Equal(t, contentType, "application/json")
+		var response pingv1.PingResponse
+		assert.Nil(t, protojson.Unmarshal(body, &response))
+		assert.Equal(t, response.Number, 42)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		assertJSON(t, "application/json")
+	})
+	t.Run("quality", func(t *testing.T) {
+		t.Parallel()
+		assertProto(t, "application/json;q=0.5, application/proto")
+		assertJSON(t, "application/proto;q=0.1, application/json;q=0.9, text/html")
+	})
+	t.Run("not_acceptable", func(t *testing.T) {
+		t.Parallel()
+		assertProto(t, "application/json;q=0, application/proto;q=0.1")
+	})
+	t.Run("vendor", func(t *testing.T) {
+		t.Parallel()
+		assertJSON(t, "application/vnd.acme.v1+json")
+		assertJSON(t, "application/proto;q=0.5, application/vnd.acme.v1+json")
+	})
+	t.Run("no_accept", func(t *testing.T) {
+		t.Parallel()
+		assertProto(t, "")
+	})
+	t.Run("wildcard", func(t *testing.T) {
+		t.Parallel()
+		assertProto(t, "*/*")
+	})
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+		assertProto(t, "application/xml, text/html")
+	})
+}
+
+func TestHandlerCancelsContextOnReturn(t *testing.T) {
+	t.Parallel()
+	producerDone := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			// A detached producer should learn that the stream is closing.
+			go func() {
+				<-ctx.Done()
+				close(producerDone)
+			}()
+			return stream.Send(&pingv1.CountUpResponse{Number: 1})
+		},
+	}))
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.ServeHTTP(writer, request)
+		// net/http cancels the request context only after we return, so the
+		// producer must have been signaled by the Handler itself.
+		select {
+		case <-producerDone:
+		case <-time.After(time.Second):
+			t.Error("handler context wasn't canceled when the implementation returned")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+	assert.Nil(t, err)
+	assert.True(t, stream.Receive())
+	assert.False(t, stream.Receive())
+	assert.Nil(t, stream.Err())
+	assert.Nil(t, stream.Close())
+}
+
+func TestHandlerStreamContext(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			assert.True(t, stream.Context() == ctx)
+			var sum int64
+			for {
+				request, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				// Give each message its own deadline, and cancel it when done.
+				msgCtx, cancel := context.WithTimeout(stream.Context(), time.Millisecond)
+				<-msgCtx.Done()
+				cancel()
+				assert.True(t, errors.Is(msgCtx.Err(), context.DeadlineExceeded))
+				if err := stream.Context().Err(); err != nil {
+					return err
+				}
+				sum += request.Number
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	stream := client.CumSum(context.Background())
+	for _, number := range []int64{1, 2} {
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: number}))
+		_, err := stream.Receive()
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, stream.CloseRequest())
+	_, err := stream.Receive()
+	assert.True(t, errors.Is(err, io.EOF))
+	assert.Nil(t, stream.CloseResponse())
+}
+
+func TestPrefixHandler(t *testing.T) {
+	t.Parallel()
+	path, handler := pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{Text: request.Spec().Procedure}), nil
+		},
+	})
+	mux := http.NewServeMux()
+	mux.Handle(connect.PrefixHandler("/api/rpc/", path, handler))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL+"/api/rpc/")
+	response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Text, "/"+pingv1connect.PingServiceName+"/Ping")
+
+	unprefixed := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	_, err = unprefixed.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+
+	prefixedPath, prefixedHandler := connect.PrefixHandler("", path, handler)
+	assert.Equal(t, prefixedPath, path)
+	assert.True(t, prefixedHandler == handler)
+}
+
+func TestDynamicHandler(t *testing.T) {
+	t.Parallel()
+	service := pingv1.File_connect_ping_v1_ping_proto.Services().ByName("PingService")
+	echo := func(method protoreflect.MethodDescriptor) *connect.Handler {
+		return connect.NewDynamicHandler(method, func(_ context.Context, conn connect.StreamingHandlerConn) error {
+			request := dynamicpb.NewMessage(method.Input())
+			if err := conn.Receive(request); err != nil {
+				return err
+			}
+			number := request.Get(method.Input().Fields().ByName("number"))
+			for i := 0; i < 2; i++ {
+				response := dynamicpb.NewMessage(method.Output())
+				response.Set(method.Output().Fields().ByName("number"), number)
+				if err := conn.Send(response); err != nil {
+					return err
+				}
+				if !method.IsStreamingServer() {
+					break
+				}
+			}
+			return nil
+		})
+	}
+	mux := http.NewServeMux()
+	for _, name := range []protoreflect.Name{"Ping", "CountUp"} {
+		method := service.Methods().ByName(name)
+		mux.Handle("/"+pingv1connect.PingServiceName+"/"+string(name), echo(method))
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Number, 42)
+	})
+	t.Run("server_stream", func(t *testing.T) {
+		t.Parallel()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 7}))
+		assert.Nil(t, err)
+		var numbers []int64
+		for stream.Receive() {
+			numbers = append(numbers, stream.Msg().Number)
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, numbers, []int64{7, 7})
+		assert.Nil(t, stream.Close())
+	})
+	t.Run("unary_options", func(t *testing.T) {
+		t.Parallel()
+		// Unary-only options apply to dynamic unary handlers.
+		method := service.Methods().ByName("Ping")
+		handler := connect.NewDynamicHandler(
+			method,
+			func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+				request := dynamicpb.NewMessage(method.Input())
+				if err := conn.Receive(request); err != nil {
+					return err
+				}
+				body, ok := connect.RawRequestBody(ctx)
+				if !ok {
+					return connect.NewError(connect.CodeInternal, errors.New("no raw body"))
+				}
+				response := dynamicpb.NewMessage(method.Output())
+				response.Set(method.Output().Fields().ByName("number"), protoreflect.ValueOfInt64(int64(len(body))))
+				return conn.Send(response)
+			},
+			connect.WithRawRequestBody(1024),
+		)
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.True(t, response.Msg.Number > 0)
+	})
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := connect.NewHTTPServer("127.0.0.1:0", mux)
+	assert.NotZero(t, server.ReadHeaderTimeout)
+	assert.NotZero(t, server.IdleTimeout)
+	// Whole-request timeouts would cut off long-lived streams.
+	assert.Zero(t, server.ReadTimeout)
+	assert.Zero(t, server.WriteTimeout)
+
+	testServer := httptest.NewUnstartedServer(server.Handler)
+	testServer.Config = server
+	testServer.Start()
+	t.Cleanup(testServer.Close)
+	client := pingv1connect.NewPingServiceClient(testServer.Client(), testServer.URL)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+}
+
 type successPingServer struct {
 	pingv1connect.UnimplementedPingServiceHandler
 }
@@ -153,3 +540,529 @@ type successPingServer struct {
 func (successPingServer) Ping(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
 	return &connect.Response[pingv1.PingResponse]{}, nil
 }
+
+func TestHandlerAllowEmptyRequestBody(t *testing.T) {
+	t.Parallel()
+	const procedure = "/connect.ping.v1.PingService/Ping"
+	emptyHandler := func(options ...connect.HandlerOption) http.Handler {
+		return connect.NewUnaryHandler(
+			procedure,
+			func(context.Context, *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error) {
+				return connect.NewResponse(&emptypb.Empty{}), nil
+			},
+			options...,
+		)
+	}
+	// serve sends a zero-length body and returns the RPC's error code, if any.
+	serve := func(t *testing.T, handler http.Handler, contentType string) string {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, procedure, strings.NewReader(""))
+		request.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if strings.HasPrefix(contentType, "application/grpc") {
+			assert.Equal(t, recorder.Code, http.StatusOK)
+			if status := recorder.Result().Trailer.Get("Grpc-Status"); status != "" {
+				return status
+			}
+			if status := recorder.Header().Get("Grpc-Status"); status != "" {
+				return status
+			}
+			// gRPC-Web sends trailers at the end of the body.
+			_, status, _ := strings.Cut(recorder.Body.String(), "grpc-status: ")
+			return strings.TrimSpace(strings.SplitN(status, "\r\n", 2)[0])
+		}
+		if recorder.Code == http.StatusOK {
+			return ""
+		}
+		var wire struct {
+			Code string `json:"code"`
+		}
+		assert.Nil(t, json.NewDecoder(recorder.Body).Decode(&wire))
+		return wire.Code
+	}
+
+	allowed := emptyHandler(connect.WithAllowEmptyRequestBody())
+	assert.Equal(t, serve(t, allowed, "application/proto"), "")
+	assert.Equal(t, serve(t, allowed, "application/json"), "")
+	assert.Equal(t, serve(t, allowed, "application/grpc"), "0")
+	assert.Equal(t, serve(t, allowed, "application/grpc-web"), "0")
+
+	strict := emptyHandler()
+	assert.Equal(t, serve(t, strict, "application/json"), connect.CodeInvalidArgument.String())
+	assert.Equal(t, serve(t, strict, "application/grpc"), "2")
+
+	// The option doesn't apply to other request types.
+	ping := connect.NewUnaryHandler(
+		procedure,
+		pingServer{}.Ping,
+		connect.WithAllowEmptyRequestBody(),
+	)
+	assert.Equal(t, serve(t, ping, "application/json"), connect.CodeInvalidArgument.String())
+	assert.Equal(t, serve(t, ping, "application/grpc"), "2")
+}
+
+func TestHandlerRequestPool(t *testing.T) {
+	t.Parallel()
+	pool := &countingPool{}
+	var received []*pingv1.PingRequest
+	const procedure = "/connect.ping.v1.PingService/Ping"
+	handler := connect.NewUnaryHandler(
+		procedure,
+		func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			received = append(received, request.Msg)
+			return connect.NewResponse(&pingv1.PingResponse{
+				Number: request.Msg.Number,
+				Text:   request.Msg.Text,
+			}), nil
+		},
+		connect.WithRequestPool(pool),
+	)
+	// ServeHTTP returns after the message is back in the pool, so we can
+	// inspect the pool between calls.
+	ping := func(body string) *pingv1.PingResponse {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, procedure, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, recorder.Code, http.StatusOK)
+		var response pingv1.PingResponse
+		assert.Nil(t, protojson.Unmarshal(recorder.Body.Bytes(), &response))
+		return &response
+	}
+
+	response := ping(`{"number": 1, "text": "first"}`)
+	assert.Equal(t, response.Number, int64(1))
+	assert.Equal(t, response.Text, "first")
+	// Earlier requests don't leak into later ones.
+	response = ping(`{"number": 2}`)
+	assert.Equal(t, response.Number, int64(2))
+	assert.Zero(t, response.Text)
+
+	assert.Equal(t, pool.gets, 2)
+	assert.Equal(t, pool.puts, 2)
+	assert.Equal(t, len(received), 2)
+	assert.True(t, received[0] == received[1])
+	// Messages are reset before being returned to the pool.
+	assert.Zero(t, received[1].Number)
+}
+
+// countingPool is a MessagePool of PingRequests that counts calls. It's not
+// safe for concurrent use.
+type countingPool struct {
+	free []*pingv1.PingRequest
+	gets int
+	puts int
+}
+
+func (p *countingPool) Get() any {
+	p.gets++
+	if len(p.free) == 0 {
+		return &pingv1.PingRequest{}
+	}
+	msg := p.free[len(p.free)-1]
+	p.free = p.free[:len(p.free)-1]
+	return msg
+}
+
+func (p *countingPool) Put(msg any) {
+	p.puts++
+	if request, ok := msg.(*pingv1.PingRequest); ok {
+		p.free = append(p.free, request)
+	}
+}
+
+func TestHandlerErrorHook(t *testing.T) {
+	t.Parallel()
+	errNotFound := errors.New("user not found")
+	var (
+		mu          sync.Mutex
+		hookedSpecs []connect.Spec
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				return nil, fmt.Errorf("lookup: %w", errNotFound)
+			},
+			countUp: func(context.Context, *connect.Request[pingv1.CountUpRequest], *connect.ServerStream[pingv1.CountUpResponse]) error {
+				return fmt.Errorf("lookup: %w", errNotFound)
+			},
+		},
+		connect.WithErrorHook(func(_ context.Context, spec connect.Spec, err error) error {
+			mu.Lock()
+			hookedSpecs = append(hookedSpecs, spec)
+			mu.Unlock()
+			if errors.Is(err, errNotFound) {
+				return connect.NewError(connect.CodeNotFound, errNotFound)
+			}
+			return nil
+		}),
+		connect.WithErrorHook(func(ctx context.Context, _ connect.Spec, err error) error {
+			if connectErr, ok := err.(*connect.Error); ok { //nolint:errorlint
+				connectErr.Meta().Set("Hooked", "true")
+			}
+			if header, ok := connect.ResponseHeaderFromContext(ctx); ok {
+				header.Set("Hooked-Context", "true")
+			}
+			return nil
+		}),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	assertHooked := func(t *testing.T, err error, code connect.Code) {
+		t.Helper()
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Code(), code)
+		assert.Equal(t, connectErr.Meta().Get("Hooked"), "true")
+	}
+
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assertHooked(t, err, connect.CodeNotFound)
+	assert.Equal(t, err.(*connect.Error).Message(), errNotFound.Error()) //nolint:errorlint
+
+	stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+	assert.Nil(t, err)
+	assert.False(t, stream.Receive())
+	assertHooked(t, stream.Err(), connect.CodeNotFound)
+	assert.Nil(t, stream.Close())
+
+	// Errors from the Handler itself also run through the hooks.
+	request, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+		strings.NewReader("{}"),
+	)
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Content-Encoding", "bogus")
+	response, err := server.Client().Do(request)
+	assert.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
+	assert.Equal(t, response.StatusCode, http.StatusNotFound) // CodeUnimplemented
+	assert.Equal(t, response.Header.Get("Hooked"), "true")
+	assert.Equal(t, response.Header.Get("Hooked-Context"), "true")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, len(hookedSpecs), 3)
+	assert.Equal(t, hookedSpecs[0].Procedure, "/"+pingv1connect.PingServiceName+"/Ping")
+	assert.Equal(t, hookedSpecs[1].StreamType, connect.StreamTypeServer)
+}
+
+func TestHandlerRedactedServerErrors(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				switch request.Msg.Number {
+				case 1:
+					return nil, errors.New("dial tcp 10.0.0.1:5432: connection refused")
+				case 2:
+					err := connect.NewError(connect.CodeInternal, errors.New("invariant violated"))
+					err.Meta().Set("Request-Id", "abc")
+					detail, detailErr := connect.NewErrorDetail(&pingv1.PingResponse{Text: "stack trace"})
+					if detailErr != nil {
+						return nil, detailErr
+					}
+					err.AddDetail(detail)
+					return nil, err
+				default:
+					return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("number too large"))
+				}
+			},
+		},
+		connect.WithRedactedServerErrors(""),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	testRedaction := func(t *testing.T, client pingv1connect.PingServiceClient) { //nolint:thelper
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+		assert.Equal(t, err.(*connect.Error).Message(), "internal error") //nolint:errorlint
+
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 2}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+		assert.Equal(t, err.(*connect.Error).Message(), "internal error")     //nolint:errorlint
+		assert.Equal(t, err.(*connect.Error).Meta().Get("Request-Id"), "abc") //nolint:errorlint
+		assert.Zero(t, err.(*connect.Error).Details())                        //nolint:errorlint
+
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 3}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		assert.Equal(t, err.(*connect.Error).Message(), "number too large") //nolint:errorlint
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		testRedaction(t, pingv1connect.NewPingServiceClient(server.Client(), server.URL))
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		testRedaction(t, pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPC()))
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		testRedaction(t, pingv1connect.NewPingServiceClient(server.Client(), server.URL, connect.WithGRPCWeb()))
+	})
+}
+
+func TestHandlerServerErrorClassifier(t *testing.T) {
+	t.Parallel()
+	var (
+		mu     sync.Mutex
+		hooked []bool
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				if request.Msg.Number == 1 {
+					return nil, connect.NewError(connect.CodeResourceExhausted, errors.New("connection pool exhausted"))
+				}
+				return nil, connect.NewError(connect.CodeInternal, errors.New("invariant violated"))
+			},
+		},
+		connect.WithServerErrorClassifier(func(code connect.Code) bool {
+			return code == connect.CodeResourceExhausted
+		}),
+		connect.WithErrorHook(func(ctx context.Context, _ connect.Spec, err error) error {
+			mu.Lock()
+			defer mu.Unlock()
+			hooked = append(hooked, connect.IsServerError(ctx, err))
+			return nil
+		}),
+		connect.WithRedactedServerErrors(""),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	// The classifier decides what's redacted, and hooks see the same decision.
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	assert.Equal(t, err.(*connect.Error).Message(), "internal error") //nolint:errorlint
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 2}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+	assert.Equal(t, err.(*connect.Error).Message(), "invariant violated") //nolint:errorlint
+	mu.Lock()
+	assert.Equal(t, hooked, []bool{true, false})
+	mu.Unlock()
+
+	// Outside a Handler, IsServerError uses the default classification.
+	ctx := context.Background()
+	assert.False(t, connect.IsServerError(ctx, nil))
+	assert.True(t, connect.IsServerError(ctx, errors.New("oh no")))
+	assert.True(t, connect.IsServerError(ctx, connect.NewError(connect.CodeDataLoss, nil)))
+	assert.False(t, connect.IsServerError(ctx, connect.NewError(connect.CodeResourceExhausted, nil)))
+	assert.False(t, connect.IsServerError(ctx, context.Canceled))
+}
+
+func TestHandlerRequireHTTP2ForGRPC(t *testing.T) {
+	t.Parallel()
+	const procedure = "/connect.ping.v1.PingService/Ping"
+	serve := func(handler http.Handler, contentType string, protoMajor int) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, procedure, strings.NewReader(""))
+		request.Header.Set("Content-Type", contentType)
+		request.ProtoMajor = protoMajor
+		request.Proto = fmt.Sprintf("HTTP/%d.%d", protoMajor, request.ProtoMinor)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	handler := connect.NewUnaryHandler(procedure, pingServer{}.Ping, connect.WithRequireHTTP2ForGRPC())
+
+	recorder := serve(handler, "application/grpc", 1)
+	assert.Equal(t, recorder.Code, http.StatusHTTPVersionNotSupported)
+	assert.Zero(t, recorder.Header().Get("Upgrade"))
+	assert.Equal(t, recorder.Header().Get("Grpc-Status"), strconv.Itoa(int(connect.CodeUnimplemented)))
+	assert.Equal(t, recorder.Header().Get("Grpc-Message"), "gRPC requires HTTP/2, but the request used HTTP/1.1")
+	assert.Equal(t, recorder.Body.String(), "gRPC requires HTTP/2, but the request used HTTP/1.1")
+
+	assert.Equal(t, serve(handler, "application/grpc", 2).Code, http.StatusOK)
+	assert.Equal(t, serve(handler, "application/grpc-web", 1).Code, http.StatusOK)
+	assert.Equal(t, serve(handler, "application/proto", 1).Code, http.StatusOK)
+
+	// Without the option, gRPC works over HTTP/1.1.
+	lenient := connect.NewUnaryHandler(procedure, pingServer{}.Ping)
+	assert.Equal(t, serve(lenient, "application/grpc", 1).Code, http.StatusOK)
+
+	// The rejection goes through error hooks and the access log.
+	var logged error
+	hooked := connect.NewUnaryHandler(
+		procedure,
+		pingServer{}.Ping,
+		connect.WithRequireHTTP2ForGRPC(),
+		connect.WithErrorHook(func(_ context.Context, _ connect.Spec, err error) error {
+			return connect.NewError(connect.CodeOf(err), errors.New("check the proxy"))
+		}),
+		connect.WithAccessLog(func(_ context.Context, entry *connect.AccessLogEntry) {
+			logged = entry.Err
+		}),
+	)
+	recorder = serve(hooked, "application/grpc", 1)
+	assert.Equal(t, recorder.Code, http.StatusHTTPVersionNotSupported)
+	assert.Equal(t, recorder.Header().Get("Grpc-Message"), "check the proxy")
+	assert.Equal(t, recorder.Body.String(), "check the proxy")
+	assert.Equal(t, connect.CodeOf(logged), connect.CodeUnimplemented)
+}
+
+func TestHandlerAdditionalHTTPMethods(t *testing.T) {
+	t.Parallel()
+	const procedure = "/connect.ping.v1.PingService/Ping"
+	serve := func(handler http.Handler, method string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, procedure, strings.NewReader(`{"number": 42}`))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	handler := connect.NewUnaryHandler(
+		procedure,
+		pingServer{}.Ping,
+		connect.WithAdditionalHTTPMethods(http.MethodPut),
+		connect.WithAdditionalHTTPMethods(http.MethodPost, http.MethodPatch),
+	)
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch} {
+		recorder := serve(handler, method)
+		assert.Equal(t, recorder.Code, http.StatusOK, assert.Sprintf("method %s", method))
+		assert.Equal(t, recorder.Body.String(), `{"number":"42"}`, assert.Sprintf("method %s", method))
+	}
+	recorder := serve(handler, http.MethodDelete)
+	assert.Equal(t, recorder.Code, http.StatusMethodNotAllowed)
+	assert.Equal(t, recorder.Header().Get("Allow"), "POST, PUT, PATCH")
+
+	// By default, only POST is allowed.
+	strict := connect.NewUnaryHandler(procedure, pingServer{}.Ping)
+	recorder = serve(strict, http.MethodPut)
+	assert.Equal(t, recorder.Code, http.StatusMethodNotAllowed)
+	assert.Equal(t, recorder.Header().Get("Allow"), http.MethodPost)
+}
+
+func TestHandlerMaxHeaderBytes(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithMaxHeaderBytes(1024)))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	protocols := map[string]connect.ClientOption{
+		"connect": connect.WithProtoJSON(),
+		"grpc":    connect.WithGRPC(),
+		"grpcweb": connect.WithGRPCWeb(),
+	}
+	for name, opt := range protocols {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			request := connect.NewRequest(&pingv1.PingRequest{Number: 42})
+			request.Header().Set("Small", "value")
+			response, err := client.Ping(context.Background(), request)
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, 42)
+
+			request = connect.NewRequest(&pingv1.PingRequest{Number: 42})
+			request.Header().Set("Large", strings.Repeat("a", 1024))
+			_, err = client.Ping(context.Background(), request)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+			assert.True(t, strings.Contains(err.Error(), "1024 byte limit"))
+
+			streamRequest := connect.NewRequest(&pingv1.CountUpRequest{Number: 1})
+			streamRequest.Header().Set("Large", strings.Repeat("a", 1024))
+			stream, err := client.CountUp(context.Background(), streamRequest)
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeResourceExhausted)
+			assert.Nil(t, stream.Close())
+		})
+	}
+}
+
+func TestHandlerEffectiveDeadlineHeader(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithEffectiveDeadlineHeader()))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	protocols := map[string]connect.ClientOption{
+		"connect": connect.WithProtoJSON(),
+		"grpc":    connect.WithGRPC(),
+		"grpcweb": connect.WithGRPCWeb(),
+	}
+	for name, opt := range protocols {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			response, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			millis, err := strconv.ParseInt(response.Header().Get(connect.EffectiveDeadlineHeader), 10, 64)
+			assert.Nil(t, err)
+			assert.True(t, millis > 0 && millis <= time.Minute.Milliseconds(), assert.Sprintf("got %dms", millis))
+
+			// Without a deadline, there's no header.
+			response, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			assert.Zero(t, response.Header().Get(connect.EffectiveDeadlineHeader))
+		})
+	}
+}
+
+func TestHandlerObservesClientCancellation(t *testing.T) {
+	t.Parallel()
+	type result struct {
+		err      error
+		canceled bool
+	}
+	results := make(chan result, 1)
+	received := make(chan struct{}, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		cumSum: func(ctx context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			if _, err := stream.Receive(); err != nil {
+				return err
+			}
+			received <- struct{}{}
+			_, err := stream.Receive()
+			select {
+			case <-ctx.Done():
+				results <- result{err: err, canceled: true}
+			case <-time.After(5 * time.Second):
+				results <- result{err: err}
+			}
+			return err
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	protocols := map[string]connect.ClientOption{
+		"connect": connect.WithProtoJSON(),
+		"grpc":    connect.WithGRPC(),
+		"grpcweb": connect.WithGRPCWeb(),
+	}
+	for name, opt := range protocols {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt)
+		t.Run(name, func(t *testing.T) {
+			// Not parallel: subtests share the handler's channels.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream := client.CumSum(ctx)
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+			<-received
+			cancel()
+			got := <-results
+			assert.True(t, got.canceled)
+			assert.Equal(t, connect.CodeOf(got.err), connect.CodeCanceled)
+		})
+	}
+}
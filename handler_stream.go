@@ -15,6 +15,7 @@
 package connect
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
@@ -25,11 +26,17 @@ import (
 // It's constructed as part of [Handler] invocation, but doesn't currently have
 // an exported constructor.
 type ClientStream[Req any] struct {
+	ctx  context.Context
 	conn StreamingHandlerConn
 	msg  *Req
 	err  error
 }
 
+// Context returns the stream's context. See [BidiStream.Context].
+func (c *ClientStream[_]) Context() context.Context {
+	return c.ctx
+}
+
 // Spec returns the specification for the RPC.
 func (c *ClientStream[_]) Spec() Spec {
 	return c.conn.Spec()
@@ -86,9 +93,15 @@ func (c *ClientStream[Req]) Conn() StreamingHandlerConn {
 // It's constructed as part of [Handler] invocation, but doesn't currently have
 // an exported constructor.
 type ServerStream[Res any] struct {
+	ctx  context.Context
 	conn StreamingHandlerConn
 }
 
+// Context returns the stream's context. See [BidiStream.Context].
+func (s *ServerStream[Res]) Context() context.Context {
+	return s.ctx
+}
+
 // ResponseHeader returns the response headers. Headers are sent with the first
 // call to Send.
 //
@@ -99,7 +112,10 @@ func (s *ServerStream[Res]) ResponseHeader() http.Header {
 }
 
 // ResponseTrailer returns the response trailers. Handlers may write to the
-// response trailers at any time before returning.
+// response trailers at any time before returning, including after the final
+// call to Send. Trailers are sent after the last message, so they're a good
+// place for data that's only known once the stream is complete, like row
+// counts or pagination tokens.
 //
 // Trailers beginning with "Connect-" and "Grpc-" are reserved for use by the
 // Connect and gRPC protocols. Applications shouldn't write them.
@@ -108,7 +124,14 @@ func (s *ServerStream[Res]) ResponseTrailer() http.Header {
 }
 
 // Send a message to the client. The first call to Send also sends the response
-// headers.
+// headers. To send just the response headers, without a message, call Send
+// with a nil pointer. This lets clients act on the headers before the first
+// message is ready.
+//
+// Each message is marshaled in full before it's written, because all the
+// protocols prefix messages with their length. To send a large payload, like
+// a file, without holding it in memory, read it in chunks and send each chunk
+// as a separate message.
 func (s *ServerStream[Res]) Send(msg *Res) error {
 	if msg == nil {
 		return s.conn.Send(nil)
@@ -127,9 +150,25 @@ func (s *ServerStream[Res]) Conn() StreamingHandlerConn {
 // It's constructed as part of [Handler] invocation, but doesn't currently have
 // an exported constructor.
 type BidiStream[Req, Res any] struct {
+	ctx  context.Context
 	conn StreamingHandlerConn
 }
 
+// Context returns the stream's context, which is the context passed to the
+// handler implementation. It's canceled when the client cancels the RPC, when
+// the deadline propagated from the client passes, or when the handler returns.
+//
+// To limit the time spent processing each message without limiting the whole
+// stream, derive a per-message context from it with [context.WithTimeout] and
+// cancel it once the message is handled. Canceling a derived context doesn't
+// affect the stream, and a derived context can't outlive the stream's
+// deadline. Receive and Send don't take a context: they're bounded only by the
+// stream's context, so per-message contexts apply to the work done between
+// them.
+func (b *BidiStream[_, _]) Context() context.Context {
+	return b.ctx
+}
+
 // Spec returns the specification for the RPC.
 func (b *BidiStream[_, _]) Spec() Spec {
 	return b.conn.Spec()
@@ -146,7 +185,14 @@ func (b *BidiStream[Req, Res]) RequestHeader() http.Header {
 }
 
 // Receive a message. When the client is done sending messages, Receive will
-// return an error that wraps [io.EOF].
+// return an error that wraps [io.EOF]. Handlers may continue to send messages
+// after the client has finished sending, so it's safe to flush any remaining
+// responses before returning.
+//
+// If the stream breaks before the client finishes sending (for example,
+// because the client cancels the RPC or the connection is reset), Receive
+// returns a coded error that doesn't wrap [io.EOF]. Use errors.Is(err, io.EOF)
+// to distinguish between the two.
 func (b *BidiStream[Req, Res]) Receive() (*Req, error) {
 	var req Req
 	if err := b.conn.Receive(&req); err != nil {
@@ -174,7 +220,8 @@ func (b *BidiStream[Req, Res]) ResponseTrailer() http.Header {
 }
 
 // Send a message to the client. The first call to Send also sends the response
-// headers.
+// headers. To send just the response headers, without a message, call Send
+// with a nil pointer.
 func (b *BidiStream[Req, Res]) Send(msg *Res) error {
 	if msg == nil {
 		return b.conn.Send(nil)
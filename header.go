@@ -51,6 +51,18 @@ func mergeHeaders(into, from http.Header) {
 	}
 }
 
+// addDefaultHeaders copies headers that aren't already present. Unlike
+// mergeHeaders, it copies the value slices, since the defaults are shared by
+// every request.
+func addDefaultHeaders(into, defaults http.Header) {
+	for key, values := range defaults {
+		if _, ok := into[key]; ok {
+			continue
+		}
+		into[key] = append([]string(nil), values...)
+	}
+}
+
 // getCanonicalHeader is a shortcut for Header.Get() which
 // bypasses the CanonicalMIMEHeaderKey operation when we
 // know the key is already in canonical form.
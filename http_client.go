@@ -0,0 +1,66 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	clientDialTimeout         = 10 * time.Second
+	clientKeepAlive           = 30 * time.Second
+	clientTLSHandshakeTimeout = 10 * time.Second
+	clientIdleConnTimeout     = 90 * time.Second
+	clientMaxIdleConnsPerHost = 100
+)
+
+// NewHTTPClient returns an [http.Client] suitable for making RPCs, for use
+// with [NewClient] and generated client constructors. It's the client-side
+// counterpart to [NewHTTPServer]. The obvious ways to configure an
+// http.Client are often wrong for RPCs: http.Client.Timeout limits the entire
+// response, so it cuts off long-lived streams, and the default transport keeps
+// only two idle connections per host, so busy clients repeatedly open new
+// connections.
+//
+// If transport is nil, the returned client uses a new [http.Transport] that
+// negotiates HTTP/2 over TLS, limits the time to dial (10 seconds) and to
+// complete TLS handshakes (10 seconds), and keeps up to 100 idle connections
+// per host for 90 seconds. Otherwise, it uses the supplied transport
+// unchanged. Either way, the client has no overall timeout: use context
+// deadlines or [WithTimeout] to limit the duration of RPCs. Callers may adjust
+// any of the fields before using the client.
+//
+// The standard library only supports HTTP/2 over TLS. To make gRPC or
+// bidirectional streaming calls to servers that use HTTP/2 without TLS,
+// supply a transport from golang.org/x/net/http2 configured for h2c.
+func NewHTTPClient(transport http.RoundTripper) *http.Client {
+	if transport == nil {
+		dialer := &net.Dialer{
+			Timeout:   clientDialTimeout,
+			KeepAlive: clientKeepAlive,
+		}
+		transport = &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: clientTLSHandshakeTimeout,
+			IdleConnTimeout:     clientIdleConnTimeout,
+			MaxIdleConnsPerHost: clientMaxIdleConnsPerHost,
+		}
+	}
+	return &http.Client{Transport: transport}
+}
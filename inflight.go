@@ -0,0 +1,149 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync"
+)
+
+// An InFlightTracker tracks the RPCs a server is handling, so that it can
+// drain them during a graceful shutdown without hanging forever on a stuck
+// long-lived stream. It's an [Interceptor]: apply it to handlers with
+// [WithInterceptors].
+//
+// To shut down, first stop routing new RPCs to the server (for example, by
+// closing a [ReadinessGate]), then call Drain with a deadline. Drain waits for
+// in-flight RPCs to finish; when the deadline passes, it cancels the
+// contexts of the remaining RPCs. If they then fail, their errors are replaced
+// with CodeUnavailable so that clients can retry them elsewhere; RPCs that
+// still succeed keep their results. Finally, shut down the [http.Server].
+//
+// The tracker has no effect on clients. It's safe to use concurrently.
+type InFlightTracker struct {
+	mu     sync.Mutex
+	nextID uint64
+	calls  map[uint64]*inFlightCall
+	// Closed when the last in-flight RPC finishes.
+	idle chan struct{}
+}
+
+// NewInFlightTracker constructs an InFlightTracker.
+func NewInFlightTracker() *InFlightTracker {
+	return &InFlightTracker{calls: make(map[uint64]*inFlightCall)}
+}
+
+// Len returns the number of RPCs in flight.
+func (t *InFlightTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.calls)
+}
+
+// Drain waits until no RPCs are in flight or the context is done, whichever
+// comes first. If the context is done first, Drain cancels the contexts of
+// the RPCs still in flight and returns how many it canceled. It doesn't wait
+// for their handlers to return, since a stuck handler may never observe the
+// cancellation.
+func (t *InFlightTracker) Drain(ctx context.Context) int {
+	t.mu.Lock()
+	if len(t.calls) == 0 {
+		t.mu.Unlock()
+		return 0
+	}
+	idle := t.idle
+	t.mu.Unlock()
+	select {
+	case <-idle:
+		return 0
+	case <-ctx.Done():
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, call := range t.calls {
+		call.forced = true
+		call.cancel()
+	}
+	return len(t.calls)
+}
+
+// WrapUnary implements [Interceptor].
+func (t *InFlightTracker) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			return next(ctx, request)
+		}
+		ctx, id := t.start(ctx)
+		response, err := next(ctx, request)
+		if t.finish(id) && err != nil {
+			return nil, errDrained(request.Spec())
+		}
+		return response, err
+	}
+}
+
+// WrapStreamingClient implements [Interceptor] with a no-op.
+func (t *InFlightTracker) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements [Interceptor].
+func (t *InFlightTracker) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		ctx, id := t.start(ctx)
+		err := next(ctx, conn)
+		if t.finish(id) && err != nil {
+			return errDrained(conn.Spec())
+		}
+		return err
+	}
+}
+
+func (t *InFlightTracker) start(ctx context.Context) (context.Context, uint64) {
+	ctx, cancel := context.WithCancel(ctx)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.calls) == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.nextID++
+	t.calls[t.nextID] = &inFlightCall{cancel: cancel}
+	return ctx, t.nextID
+}
+
+// finish stops tracking the RPC and reports whether Drain canceled it.
+// Callers only replace errors: an RPC that finished successfully despite the
+// cancellation keeps its result.
+func (t *InFlightTracker) finish(id uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	call := t.calls[id]
+	delete(t.calls, id)
+	call.cancel()
+	if len(t.calls) == 0 {
+		close(t.idle)
+	}
+	return call.forced
+}
+
+type inFlightCall struct {
+	cancel context.CancelFunc
+	// Set if Drain canceled the RPC.
+	forced bool
+}
+
+func errDrained(spec Spec) *Error {
+	return errorf(CodeUnavailable, "server is shutting down: canceled %s", spec.Procedure)
+}
@@ -0,0 +1,115 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestInFlightTrackerDrain(t *testing.T) {
+	t.Parallel()
+	tracker := connect.NewInFlightTracker()
+	started := make(chan struct{}, 1)
+	finish := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				started <- struct{}{}
+				if request.Msg.Text == "stubborn" {
+					// Finishes the RPC successfully even after cancellation.
+					<-ctx.Done()
+					return connect.NewResponse(&pingv1.PingResponse{Text: "done"}), nil
+				}
+				select {
+				case <-finish:
+					return connect.NewResponse(&pingv1.PingResponse{}), nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+			countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				started <- struct{}{}
+				// A long-lived stream that only stops when canceled.
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+		connect.WithInterceptors(tracker),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	t.Run("idle", func(t *testing.T) {
+		assert.Equal(t, tracker.Drain(context.Background()), 0)
+	})
+	t.Run("finished", func(t *testing.T) {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			errs <- err
+		}()
+		<-started
+		assert.Equal(t, tracker.Len(), 1)
+		close(finish)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.Equal(t, tracker.Drain(ctx), 0)
+		assert.Nil(t, <-errs)
+	})
+	t.Run("forced", func(t *testing.T) {
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		<-started
+		assert.Equal(t, tracker.Len(), 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, tracker.Drain(ctx), 1)
+		for stream.Receive() {
+		}
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeUnavailable)
+		assert.Nil(t, stream.Close())
+		assert.Equal(t, tracker.Len(), 0)
+	})
+	t.Run("forced_success", func(t *testing.T) {
+		type result struct {
+			response *connect.Response[pingv1.PingResponse]
+			err      error
+		}
+		results := make(chan result, 1)
+		go func() {
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "stubborn"}))
+			results <- result{response, err}
+		}()
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, tracker.Drain(ctx), 1)
+		// The handler succeeded despite the cancellation, so the result stands.
+		res := <-results
+		assert.Nil(t, res.err)
+		assert.Equal(t, res.response.Msg.Text, "done")
+	})
+}
@@ -16,6 +16,8 @@ package connect
 
 import (
 	"context"
+	"net/http"
+	"sync"
 )
 
 // UnaryFunc is the generic signature of a unary RPC. Interceptors may wrap
@@ -64,6 +66,127 @@ func (f UnaryInterceptorFunc) WrapStreamingHandler(next StreamingHandlerFunc) St
 	return next
 }
 
+// StreamingHandlerInterceptor is an Interceptor that observes each message
+// received and sent by streaming handlers, so it can log, validate, or
+// transform messages without wrapping the stream types. It has no effect on
+// unary RPCs or clients. Either hook may be nil.
+//
+// OnReceive runs after each message is received, and OnSend runs before each
+// message is sent, including the single request of server streaming RPCs and
+// the single response of client streaming RPCs. Hooks may modify the message
+// in place. If a hook returns an error, the message isn't delivered: Receive
+// or Send returns the error, and the handler sends it to the client when the
+// implementation returns, even if the implementation returns a different
+// error or nil. To choose the code the stream ends with, return an [*Error]
+// from [NewError]; other errors have CodeUnknown.
+//
+// Streams don't support concurrent calls to Receive or to Send, so each hook
+// runs serially for a stream. On bidirectional streams, OnReceive and OnSend
+// may run concurrently with each other.
+type StreamingHandlerInterceptor struct {
+	OnReceive func(ctx context.Context, spec Spec, msg any) error
+	OnSend    func(ctx context.Context, spec Spec, msg any) error
+}
+
+// WrapUnary implements [Interceptor] with a no-op.
+func (i *StreamingHandlerInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return next
+}
+
+// WrapStreamingClient implements [Interceptor] with a no-op.
+func (i *StreamingHandlerInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements [Interceptor] by calling the hooks for each
+// message.
+func (i *StreamingHandlerInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	if i.OnReceive == nil && i.OnSend == nil {
+		return next
+	}
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		observed := &messageObservingHandlerConn{
+			StreamingHandlerConn: conn,
+			ctx:                  ctx,
+			interceptor:          i,
+		}
+		err := next(ctx, observed)
+		if hookErr := observed.err(); hookErr != nil {
+			return hookErr
+		}
+		return err
+	}
+}
+
+// messageObservingHandlerConn calls a StreamingHandlerInterceptor's hooks for
+// each message, and remembers the first error they return.
+type messageObservingHandlerConn struct {
+	StreamingHandlerConn
+
+	ctx         context.Context
+	interceptor *StreamingHandlerInterceptor
+
+	mu      sync.Mutex // Send and Receive may be called concurrently
+	hookErr error
+}
+
+func (c *messageObservingHandlerConn) Receive(msg any) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+	if err := c.StreamingHandlerConn.Receive(msg); err != nil {
+		return err
+	}
+	if c.interceptor.OnReceive == nil {
+		return nil
+	}
+	return c.fail(c.interceptor.OnReceive(c.ctx, c.Spec(), msg))
+}
+
+func (c *messageObservingHandlerConn) Send(msg any) error {
+	if err := c.err(); err != nil {
+		return err
+	}
+	if c.interceptor.OnSend != nil {
+		if err := c.fail(c.interceptor.OnSend(c.ctx, c.Spec(), msg)); err != nil {
+			return err
+		}
+	}
+	return c.StreamingHandlerConn.Send(msg)
+}
+
+func (c *messageObservingHandlerConn) fail(err error) error {
+	if err == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hookErr == nil {
+		c.hookErr = err
+	}
+	return err
+}
+
+func (c *messageObservingHandlerConn) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hookErr
+}
+
+// Interceptors composes multiple interceptors into one. The first interceptor
+// is the outermost layer of the onion, just as with [WithInterceptors]. Nil
+// interceptors are ignored, and interceptors returned from Interceptors are
+// flattened into the new chain, so
+//
+//	Interceptors(Interceptors(A, B), C) == Interceptors(A, B, C)
+//
+// This makes it easy to define a shared stack (for example, logging and
+// authentication) once and combine it predictably with interceptors specific
+// to a single client or handler.
+func Interceptors(interceptors ...Interceptor) Interceptor {
+	return newChain(interceptors)
+}
+
 // A chain composes multiple interceptors into one.
 type chain struct {
 	interceptors []Interceptor
@@ -74,13 +197,18 @@ func newChain(interceptors []Interceptor) *chain {
 	// We usually wrap in reverse order to have the first interceptor from
 	// the slice act first. Rather than doing this dance repeatedly, reverse the
 	// interceptor order now.
-	var chain chain
+	var reversed []Interceptor
 	for i := len(interceptors) - 1; i >= 0; i-- {
-		if interceptor := interceptors[i]; interceptor != nil {
-			chain.interceptors = append(chain.interceptors, interceptor)
+		switch interceptor := interceptors[i].(type) {
+		case nil:
+		case *chain:
+			// Nested chains are already reversed.
+			reversed = append(reversed, interceptor.interceptors...)
+		default:
+			reversed = append(reversed, interceptor)
 		}
 	}
-	return &chain
+	return &chain{interceptors: reversed}
 }
 
 func (c *chain) WrapUnary(next UnaryFunc) UnaryFunc {
@@ -103,3 +231,36 @@ func (c *chain) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandler
 	}
 	return next
 }
+
+// erroredStreamingClientConn fails every operation with the same error. The
+// underlying connection is never used to send data, so no HTTP request is
+// made and there are no response headers or trailers.
+type erroredStreamingClientConn struct {
+	StreamingClientConn
+
+	err error
+}
+
+func (c *erroredStreamingClientConn) Send(any) error {
+	return c.err
+}
+
+func (c *erroredStreamingClientConn) Receive(any) error {
+	return c.err
+}
+
+func (c *erroredStreamingClientConn) CloseRequest() error {
+	return nil
+}
+
+func (c *erroredStreamingClientConn) CloseResponse() error {
+	return nil
+}
+
+func (c *erroredStreamingClientConn) ResponseHeader() http.Header {
+	return make(http.Header)
+}
+
+func (c *erroredStreamingClientConn) ResponseTrailer() http.Header {
+	return make(http.Header)
+}
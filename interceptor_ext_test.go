@@ -16,6 +16,7 @@ package connect_test
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -166,6 +167,50 @@ func TestEmptyUnaryInterceptorFunc(t *testing.T) {
 	assert.Nil(t, countUpStream.Close())
 }
 
+func TestInterceptors(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	var calls []string
+	record := func(name string) connect.Interceptor {
+		return connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+			return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+				calls = append(calls, name)
+				return next(ctx, request)
+			}
+		})
+	}
+	ping := func(t *testing.T, opts ...connect.ClientOption) []string {
+		t.Helper()
+		calls = nil
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		return calls
+	}
+
+	shared := connect.Interceptors(record("a"), nil, connect.Interceptors(record("b"), record("c")))
+	assert.Equal(
+		t,
+		ping(t, connect.WithInterceptors(shared, record("d"))),
+		[]string{"a", "b", "c", "d"},
+	)
+	assert.Equal(
+		t,
+		ping(t, connect.WithInterceptors(record("z")), connect.WithInterceptors(shared)),
+		[]string{"z", "a", "b", "c"},
+	)
+	// Interceptors supplied twice run twice.
+	assert.Equal(
+		t,
+		ping(t, connect.WithInterceptors(shared), connect.WithInterceptors(shared)),
+		[]string{"a", "b", "c", "a", "b", "c"},
+	)
+}
+
 // headerInterceptor makes it easier to write interceptors that inspect or
 // mutate HTTP headers. It applies the same logic to unary and streaming
 // procedures, wrapping the send or receive side of the stream as appropriate.
@@ -268,3 +313,151 @@ func (cc *headerInspectingClientConn) Receive(msg any) error {
 	}
 	return err
 }
+
+func TestSpecCodec(t *testing.T) {
+	t.Parallel()
+	const codecHeader = "Handler-Codec"
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			response.Header().Set(codecHeader, request.Spec().Codec)
+			return response, nil
+		},
+		countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			stream.ResponseHeader().Set(codecHeader, stream.Conn().Spec().Codec)
+			return stream.Send(&pingv1.CountUpResponse{})
+		},
+	}))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	testCodec := func(t *testing.T, codec string, options ...connect.ClientOption) {
+		t.Helper()
+		var clientCodec string
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			append(options, connect.WithInterceptors(connect.UnaryInterceptorFunc(
+				func(next connect.UnaryFunc) connect.UnaryFunc {
+					return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+						clientCodec = request.Spec().Codec
+						return next(ctx, request)
+					}
+				},
+			)))...,
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, clientCodec, codec)
+		assert.Equal(t, response.Header().Get(codecHeader), codec)
+
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		for stream.Receive() {
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, stream.ResponseHeader().Get(codecHeader), codec)
+		assert.Nil(t, stream.Close())
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		testCodec(t, "proto")
+	})
+	t.Run("connect_json", func(t *testing.T) {
+		t.Parallel()
+		testCodec(t, "json", connect.WithProtoJSON())
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		testCodec(t, "proto", connect.WithGRPC())
+	})
+	t.Run("grpcweb_json", func(t *testing.T) {
+		t.Parallel()
+		testCodec(t, "json", connect.WithGRPCWeb(), connect.WithProtoJSON())
+	})
+}
+
+func TestStreamingHandlerInterceptor(t *testing.T) {
+	t.Parallel()
+	interceptor := &connect.StreamingHandlerInterceptor{
+		OnReceive: func(_ context.Context, _ connect.Spec, msg any) error {
+			request, ok := msg.(*pingv1.SumRequest)
+			if !ok {
+				return nil
+			}
+			if request.Number < 0 {
+				return connect.NewError(connect.CodeInvalidArgument, errors.New("negative number"))
+			}
+			request.Number *= 10
+			return nil
+		},
+		OnSend: func(_ context.Context, _ connect.Spec, msg any) error {
+			response, ok := msg.(*pingv1.CountUpResponse)
+			if !ok {
+				return nil
+			}
+			if response.Number > 2 {
+				return connect.NewError(connect.CodeResourceExhausted, errors.New("too many numbers"))
+			}
+			response.Number *= 100
+			return nil
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			sum: func(_ context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+				// Ignore errors: the interceptor ends the stream regardless.
+				var sum int64
+				for stream.Receive() {
+					sum += stream.Msg().Number
+				}
+				return connect.NewResponse(&pingv1.SumResponse{Sum: sum}), nil
+			},
+			countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				for i := int64(1); i <= request.Msg.Number; i++ {
+					if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		connect.WithInterceptors(interceptor),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+
+	sum := func(numbers ...int64) (*connect.Response[pingv1.SumResponse], error) {
+		stream := client.Sum(context.Background())
+		for _, number := range numbers {
+			assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: number}))
+		}
+		return stream.CloseAndReceive()
+	}
+	response, err := sum(1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.Sum, 30)
+	_, err = sum(1, -2, 3)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+
+	countUp := func(number int64) ([]int64, error) {
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: number}))
+		assert.Nil(t, err)
+		var got []int64
+		for stream.Receive() {
+			got = append(got, stream.Msg().Number)
+		}
+		assert.Nil(t, stream.Close())
+		return got, stream.Err()
+	}
+	got, err := countUp(2)
+	assert.Nil(t, err)
+	assert.Equal(t, got, []int64{100, 200})
+	got, err = countUp(5)
+	assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	assert.Equal(t, got, []int64{100, 200})
+}
@@ -19,6 +19,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 )
 
 // A ClientOption configures a [Client].
@@ -62,6 +63,71 @@ func WithClientOptions(options ...ClientOption) ClientOption {
 	return &clientOptionsOption{options}
 }
 
+// WithProcedureOptions composes multiple ClientOptions into one that applies
+// only to the client for the given procedure (for example,
+// "/acme.foo.v1.FooService/Bar"). Generated constructors pass the same options
+// to the client for every method in a service, so this is how to configure a
+// single method:
+//
+//	client := foov1connect.NewFooServiceClient(
+//	  http.DefaultClient,
+//	  "https://api.acme.com",
+//	  connect.WithProcedureOptions(
+//	    "/acme.foo.v1.FooService/Bar",
+//	    connect.WithRequestHeader("Acme-Feature", "new-bar"),
+//	  ),
+//	)
+func WithProcedureOptions(procedure string, options ...ClientOption) ClientOption {
+	return &procedureOptionsOption{procedure: procedure, options: options}
+}
+
+// WithRequestHeader configures a client to send a header with every request.
+// Headers set on an individual request take precedence: if the request
+// already has a value for the key, the configured value isn't added. To send a
+// header with only some of a service's methods, combine this option with
+// [WithProcedureOptions].
+func WithRequestHeader(key, value string) ClientOption {
+	return &requestHeaderOption{key: key, value: value}
+}
+
+// WithMaxStreamMessages limits the number of messages a client accepts from a
+// server stream. If the server sends more than max messages, Receive returns
+// false and Err returns an error with [CodeResourceExhausted]. This bounds the
+// time and memory spent consuming a stream that's expected to be finite. To
+// stop the server from sending more messages, cancel the RPC's context before
+// closing the stream.
+//
+// Setting this option to zero (the default) allows any number of messages.
+func WithMaxStreamMessages(max int) ClientOption {
+	return &maxStreamMessagesOption{Max: max}
+}
+
+// WithSendDeadlinePropagation controls whether clients send the context's
+// deadline to the server. By default, clients send the time remaining before
+// the deadline in the Connect-Timeout-Ms or Grpc-Timeout header, so servers
+// can stop working on RPCs that the client has abandoned.
+//
+// Pass false only to work around servers or proxies that mishandle the
+// timeout headers. Disabling propagation doesn't change the client's behavior:
+// the RPC is still canceled when the context's deadline passes.
+func WithSendDeadlinePropagation(propagate bool) ClientOption {
+	return &sendDeadlinePropagationOption{propagate: propagate}
+}
+
+// WithTimeout configures clients to apply a default timeout to calls whose
+// context doesn't have a deadline, as a safety net against calls that would
+// otherwise hang forever. Calls whose context already has a deadline are
+// unaffected, whether it's shorter or longer than the timeout. Interceptors
+// see the deadline, and it's sent to the server like any other deadline.
+//
+// The timeout covers the entire call: for streaming RPCs, that's the life of
+// the stream, so use [WithProcedureOptions] to exclude long-lived streams or
+// give them a longer timeout. Setting WithTimeout to zero, the default,
+// disables the default timeout.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return &timeoutOption{timeout: timeout}
+}
+
 // WithGRPC configures clients to use the HTTP/2 gRPC protocol.
 func WithGRPC() ClientOption {
 	return &grpcOption{web: false}
@@ -85,15 +151,21 @@ func WithProtoJSON() ClientOption {
 // compress request messages. If the algorithm has not been registered using
 // [WithAcceptCompression], the client will return errors at runtime.
 //
+// Request and response compression are negotiated independently, so the
+// algorithm used for requests doesn't limit the algorithms the client accepts
+// in responses. For example, a client can send uncompressed requests while
+// still accepting gzipped responses, which is the default behavior.
+//
 // Because some servers don't support compression, clients default to sending
-// uncompressed requests.
+// uncompressed requests. Use [WithSendCompression] with "identity" to restore
+// this default after another option has enabled request compression.
 func WithSendCompression(name string) ClientOption {
 	return &sendCompressionOption{Name: name}
 }
 
 // WithSendGzip configures the client to gzip requests. Since clients have
 // access to a gzip compressor by default, WithSendGzip doesn't require
-// [WithSendCompresion].
+// [WithSendCompression].
 //
 // Some servers don't support gzip, so clients default to sending uncompressed
 // requests.
@@ -165,6 +237,142 @@ func WithRequireConnectProtocolHeader() HandlerOption {
 	return &requireConnectProtocolHeaderOption{}
 }
 
+// WithRequireHTTP2ForGRPC configures the Handler to reject gRPC requests that
+// arrive over HTTP/1.1. The gRPC protocol sends every RPC's status in HTTP
+// trailers, which proxies that downgrade connections to HTTP/1.1 often drop,
+// so clients see responses without a status. With this option, the Handler
+// responds to those requests with HTTP status 505 HTTP Version Not Supported
+// and a gRPC status of CodeUnimplemented, both explaining that gRPC requires
+// HTTP/2. (In the absence of a status trailer, most gRPC clients report the
+// HTTP status.) The error passes through any hooks configured with
+// [WithErrorHook] and is recorded by [WithAccessLog], like other RPC errors.
+//
+// This option has no effect if the client uses the Connect or gRPC-Web
+// protocols, which work over any version of HTTP.
+func WithRequireHTTP2ForGRPC() HandlerOption {
+	return &requireHTTP2ForGRPCOption{}
+}
+
+// WithAdditionalHTTPMethods configures the Handler to accept RPCs sent with
+// the given HTTP methods, in addition to POST. Requests with these methods are
+// handled exactly like POST requests. This is useful behind API gateways that
+// insist on other verbs, like PUT, and forward them unchanged. By default,
+// Handlers only accept POST and respond to other methods with HTTP status 405
+// Method Not Allowed; they continue to do so for methods not listed here.
+//
+// HTTP methods are case-sensitive, so methods should usually be upper-case
+// constants like [http.MethodPut]. Calling WithAdditionalHTTPMethods more than
+// once accepts the union of the methods.
+func WithAdditionalHTTPMethods(methods ...string) HandlerOption {
+	return &additionalHTTPMethodsOption{Methods: methods}
+}
+
+// WithAllowEmptyRequestBody configures unary Handlers for procedures that take
+// google.protobuf.Empty to accept requests without a message, rather than
+// failing to unmarshal them. Some clients send zero-length bodies (or, with
+// gRPC, no messages) for these procedures, since an empty message carries no
+// data. The implementation receives an empty request message.
+//
+// Handlers for other request types ignore this option, so it doesn't mask
+// malformed requests that should carry data.
+func WithAllowEmptyRequestBody() HandlerOption {
+	return &allowEmptyRequestBodyOption{}
+}
+
+// WithErrorHook configures Handlers to pass every error they send to clients
+// through hook, which may return a different error: for example, to
+// translate domain errors into coded errors, rewrite codes, or add details.
+// It runs after all interceptors, just before the error is written, and it
+// also sees errors produced by the Handler itself, like failures to negotiate
+// compression or parse a timeout. Returning nil leaves the error unchanged.
+//
+// If this option is used multiple times, the hooks run in order, each
+// receiving the previous hook's result.
+func WithErrorHook(hook func(ctx context.Context, spec Spec, err error) error) HandlerOption {
+	return &errorHookOption{hook: hook}
+}
+
+// WithRedactedServerErrors configures Handlers to replace the message sent to
+// clients for errors coded [CodeUnknown], [CodeInternal], or [CodeDataLoss],
+// which usually indicate a server-side failure whose message may describe
+// internal details. Errors that aren't an [*Error] are coded [CodeUnknown], so
+// they're redacted too. Errors with other codes are sent unchanged. To redact
+// a different set of codes, use [WithServerErrorClassifier].
+//
+// Redaction happens just before the error is written, after interceptors and
+// any hooks configured with [WithErrorHook], so they can still log the
+// original message. The redacted error keeps the original code and metadata,
+// but not its details, since details like debug info can leak the same
+// internals as the message. If message is empty, it defaults to "internal
+// error".
+func WithRedactedServerErrors(message string) HandlerOption {
+	if message == "" {
+		message = "internal error"
+	}
+	return &redactedServerErrorsOption{message: message}
+}
+
+// WithServerErrorClassifier configures the Handler's classification of codes
+// that indicate a server-side failure, rather than a problem with the request.
+// Teams often disagree about codes like [CodeResourceExhausted] or
+// [CodeFailedPrecondition]; configuring the decision once keeps redaction
+// with [WithRedactedServerErrors], error hooks, and logging and metrics
+// interceptors consistent. The latter two should classify errors with
+// [IsServerError], which uses this classifier. By default, Handlers use
+// [IsServerErrorCode].
+func WithServerErrorClassifier(isServerError func(Code) bool) HandlerOption {
+	return &serverErrorClassifierOption{isServerError: isServerError}
+}
+
+// WithRequestPool configures unary Handlers to take request messages from a
+// pool instead of allocating a new message for each call, which reduces
+// allocations in servers handling many requests per second. The pool must
+// return pointers to the handler's request type (for example,
+// *pingv1.PingRequest) or nil; other values are ignored. After each call,
+// the Handler resets the message with proto.Reset (or sets non-Protobuf
+// messages to their zero value) and puts it back in the pool.
+//
+// Because the message is reused as soon as the call finishes, neither the
+// implementation nor any interceptor may retain the request message, or any
+// field of it, after returning: copy anything that outlives the call, and
+// don't use the message from other goroutines afterwards. Streaming handlers
+// ignore this option.
+func WithRequestPool(pool MessagePool) HandlerOption {
+	return &requestPoolOption{pool: pool}
+}
+
+// WithStreamSendTimeout limits how long a streaming handler may wait for the
+// client to accept each outgoing message. If the client stops reading (for
+// example, a stalled subscriber to a server stream), the pending Send fails
+// with CodeDeadlineExceeded and the stream is reset, so the handler can return
+// and release its resources. The timeout applies to each write separately, not
+// to the stream as a whole.
+//
+// Write deadlines replace any WriteTimeout configured on the [http.Server]
+// for the duration of the stream. Setting them requires Go 1.20 or later: on
+// earlier versions, this option has no effect. It also has no effect on unary
+// RPCs, or if the [http.ResponseWriter] doesn't support write deadlines (see
+// [http.ResponseController]). By default, handlers wait indefinitely.
+func WithStreamSendTimeout(timeout time.Duration) HandlerOption {
+	return &streamSendTimeoutOption{timeout: timeout}
+}
+
+// EffectiveDeadlineHeader is the response header set by Handlers configured
+// with [WithEffectiveDeadlineHeader].
+const EffectiveDeadlineHeader = "X-Effective-Deadline-Ms"
+
+// WithEffectiveDeadlineHeader configures the Handler to report the deadline
+// it enforces for each RPC in the X-Effective-Deadline-Ms response header, as
+// the number of milliseconds remaining when the Handler started processing
+// the request. The deadline combines the timeout sent by the client with any
+// deadline already set on the request's context (for example, by net/http
+// middleware), so comparing the header to the client's timeout helps debug
+// RPCs that time out sooner than expected. Handlers don't set the header for
+// RPCs without a deadline.
+func WithEffectiveDeadlineHeader() HandlerOption {
+	return &effectiveDeadlineHeaderOption{}
+}
+
 // Option implements both [ClientOption] and [HandlerOption], so it can be
 // applied both client-side and server-side.
 type Option interface {
@@ -218,6 +426,62 @@ func WithReadMaxBytes(max int) Option {
 	return &readMaxBytesOption{Max: max}
 }
 
+// WithMaxTrailerBytes configures the client to reject responses whose
+// trailers are larger than max bytes, so that a misbehaving or hostile server
+// can't exhaust the client's memory with an enormous trailer block. The limit
+// applies to the trailers block of gRPC-Web responses and the end-of-stream
+// message of Connect streaming responses, which are read into memory. It also
+// applies to trailers sent as HTTP headers or trailers: gRPC trailers,
+// trailers-only gRPC and gRPC-Web responses, and the Trailer- headers of
+// Connect unary responses, counting the length of each trailer's name and
+// value. Clients reject oversized trailers with CodeResourceExhausted. When
+// the trailers arrive as HTTP headers or trailers, the gRPC protocols' error
+// message includes the status the server sent.
+//
+// Trailers read into memory are also subject to [WithReadMaxBytes], and the
+// smaller of the two limits applies.
+//
+// Clients default to a limit of 1 MiB. Setting WithMaxTrailerBytes to zero
+// removes the limit. The HTTP/1 and HTTP/2 transports in net/http limit the
+// size of HTTP headers and trailers separately.
+func WithMaxTrailerBytes(max int) ClientOption {
+	return &maxTrailerBytesOption{Max: max}
+}
+
+// WithRejectProtocolMismatch configures the client to check whether each
+// response came from a server speaking a different protocol, which usually
+// means the client and server are misconfigured: for example, a gRPC client
+// pointed at a server that only supports Connect. If the response's
+// Content-Type belongs to another protocol, the client fails the RPC with
+// CodeInternal and an error that names both protocols and suggests the option
+// to use.
+//
+// Error statuses count as a mismatch only if they look like errors from the
+// other protocol: a Connect error body with a valid code, or a Grpc-Status
+// header. Other error responses, like JSON error pages from proxies and
+// gateways, keep the code derived from their HTTP status.
+//
+// By default, clients don't check, and mismatched responses fail with
+// whatever error the client's own protocol produces for them.
+func WithRejectProtocolMismatch() ClientOption {
+	return &rejectProtocolMismatchOption{}
+}
+
+// WithMaxHeaderBytes configures the Handler to reject requests whose headers
+// are larger than max bytes, counting the length of each header's name and
+// value. The Handler rejects them with CodeResourceExhausted, and the error
+// message includes the limit, before any interceptors or the implementation
+// run. This lets clients that misuse metadata see a diagnosable error, rather
+// than a transport-level failure.
+//
+// The limit applies to headers that reach the Handler, so it should be lower
+// than the limits enforced by the HTTP server (for example,
+// [http.Server.MaxHeaderBytes]). Setting WithMaxHeaderBytes to zero, the
+// default, allows headers of any size.
+func WithMaxHeaderBytes(max int) HandlerOption {
+	return &maxHeaderBytesOption{Max: max}
+}
+
 // WithSendMaxBytes prevents sending messages too large for the client/handler
 // to handle without significant performance overhead. For handlers, WithSendMaxBytes
 // limits the size of a message that the handler can respond with. For clients,
@@ -235,6 +499,11 @@ func WithSendMaxBytes(max int) Option {
 //
 //	WithInterceptors(A) + WithInterceptors(B, C) == WithInterceptors(A, B, C)
 //
+// Interceptors aren't deduplicated: an interceptor supplied more than once
+// (for example, in both a shared set of options and a client-specific one) runs
+// once for each time it was supplied. Use [Interceptors] to build shared
+// stacks that combine predictably.
+//
 // Unary interceptors compose like an onion. The first interceptor provided is
 // the outermost layer of the onion: it acts first on the context and request,
 // and last on the response and error.
@@ -281,6 +550,58 @@ func WithInterceptors(interceptors ...Interceptor) Option {
 	return &interceptorsOption{interceptors}
 }
 
+// WithStrictUTF8 configures a client or handler to check that every string
+// field of the messages it receives is valid UTF-8. Messages with invalid
+// strings fail to unmarshal with CodeInvalidArgument, and the error names the
+// offending field.
+//
+// The default Protobuf codec already rejects invalid UTF-8 in proto3 string
+// fields, but it accepts it in proto2 string fields, and custom codecs may not
+// check at all. This option applies the same rule to every string
+// field and codec, so invalid data can't propagate into storage. It only
+// checks Protobuf messages, and it walks every received message, which adds
+// some overhead.
+func WithStrictUTF8() Option {
+	return &strictUTF8Option{}
+}
+
+// WithoutGRPCAcceptEncoding configures a client or handler using the gRPC or
+// gRPC-Web protocols not to send the Grpc-Accept-Encoding header, which
+// advertises the compression algorithms it supports. It's an escape hatch
+// for strict or buggy peers that reject unexpected headers; most applications
+// shouldn't use it.
+//
+// Without the header, peers can't tell which algorithms are supported. Per
+// the gRPC specification, servers then shouldn't compress responses, so
+// clients using this option usually receive uncompressed responses even if
+// they configured compression. Requests are still compressed as configured
+// with [WithSendCompression]. This option has no effect on the Connect
+// protocol.
+func WithoutGRPCAcceptEncoding() Option {
+	return &omitGRPCAcceptEncodingOption{}
+}
+
+// WithPayloadTransformer configures a client or handler to transform the
+// bytes of each message after it's marshaled and before it's unmarshaled. It's
+// useful for encrypting or signing messages without changing the codec. The
+// transformation is applied before compression when sending and reversed after
+// decompression when receiving, and it works with all stream types and
+// protocols.
+//
+// The transform and untransform functions must be inverses of each other and
+// safe to call concurrently. Clients and handlers must use compatible
+// transformers. As with codec errors, errors from transform are reported as
+// CodeInternal and errors from untransform as CodeInvalidArgument.
+//
+// Only messages are transformed: errors and their details are sent unchanged,
+// so that clients can read them even when they can't untransform messages.
+func WithPayloadTransformer(transform, untransform func([]byte) ([]byte, error)) Option {
+	return &payloadTransformerOption{transformer: &payloadTransformer{
+		transform:   transform,
+		untransform: untransform,
+	}}
+}
+
 // WithOptions composes multiple Options into one.
 func WithOptions(options ...Option) Option {
 	return &optionsOption{options}
@@ -296,6 +617,56 @@ func (o *clientOptionsOption) applyToClient(config *clientConfig) {
 	}
 }
 
+type maxStreamMessagesOption struct {
+	Max int
+}
+
+func (o *maxStreamMessagesOption) applyToClient(config *clientConfig) {
+	config.MaxStreamMessages = o.Max
+}
+
+type sendDeadlinePropagationOption struct {
+	propagate bool
+}
+
+func (o *sendDeadlinePropagationOption) applyToClient(config *clientConfig) {
+	config.DisableDeadlinePropagation = !o.propagate
+}
+
+type timeoutOption struct {
+	timeout time.Duration
+}
+
+func (o *timeoutOption) applyToClient(config *clientConfig) {
+	config.Timeout = o.timeout
+}
+
+type procedureOptionsOption struct {
+	procedure string
+	options   []ClientOption
+}
+
+func (o *procedureOptionsOption) applyToClient(config *clientConfig) {
+	if config.Procedure != o.procedure {
+		return
+	}
+	for _, option := range o.options {
+		option.applyToClient(config)
+	}
+}
+
+type requestHeaderOption struct {
+	key   string
+	value string
+}
+
+func (o *requestHeaderOption) applyToClient(config *clientConfig) {
+	if config.RequestHeader == nil {
+		config.RequestHeader = make(http.Header)
+	}
+	config.RequestHeader.Add(o.key, o.value)
+}
+
 type codecOption struct {
 	Codec Codec
 }
@@ -371,6 +742,28 @@ func (o *readMaxBytesOption) applyToHandler(config *handlerConfig) {
 	config.ReadMaxBytes = o.Max
 }
 
+type maxHeaderBytesOption struct {
+	Max int
+}
+
+func (o *maxHeaderBytesOption) applyToHandler(config *handlerConfig) {
+	config.MaxHeaderBytes = o.Max
+}
+
+type maxTrailerBytesOption struct {
+	Max int
+}
+
+func (o *maxTrailerBytesOption) applyToClient(config *clientConfig) {
+	config.MaxTrailerBytes = o.Max
+}
+
+type rejectProtocolMismatchOption struct{}
+
+func (o *rejectProtocolMismatchOption) applyToClient(config *clientConfig) {
+	config.RejectProtocolMismatch = true
+}
+
 type sendMaxBytesOption struct {
 	Max int
 }
@@ -393,12 +786,110 @@ func (o *handlerOptionsOption) applyToHandler(config *handlerConfig) {
 	}
 }
 
+type strictUTF8Option struct{}
+
+func (o *strictUTF8Option) applyToClient(config *clientConfig) {
+	config.StrictUTF8 = true
+}
+
+func (o *strictUTF8Option) applyToHandler(config *handlerConfig) {
+	config.StrictUTF8 = true
+}
+
+type omitGRPCAcceptEncodingOption struct{}
+
+func (o *omitGRPCAcceptEncodingOption) applyToClient(config *clientConfig) {
+	config.OmitGRPCAcceptEncoding = true
+}
+
+func (o *omitGRPCAcceptEncodingOption) applyToHandler(config *handlerConfig) {
+	config.OmitGRPCAcceptEncoding = true
+}
+
+type payloadTransformerOption struct {
+	transformer *payloadTransformer
+}
+
+func (o *payloadTransformerOption) applyToClient(config *clientConfig) {
+	config.PayloadTransformer = o.transformer
+}
+
+func (o *payloadTransformerOption) applyToHandler(config *handlerConfig) {
+	config.PayloadTransformer = o.transformer
+}
+
+type streamSendTimeoutOption struct {
+	timeout time.Duration
+}
+
+func (o *streamSendTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.StreamSendTimeout = o.timeout
+}
+
+type errorHookOption struct {
+	hook func(context.Context, Spec, error) error
+}
+
+func (o *errorHookOption) applyToHandler(config *handlerConfig) {
+	config.ErrorHooks = append(config.ErrorHooks, o.hook)
+}
+
+type serverErrorClassifierOption struct {
+	isServerError func(Code) bool
+}
+
+func (o *serverErrorClassifierOption) applyToHandler(config *handlerConfig) {
+	config.ServerErrorClassifier = o.isServerError
+}
+
+type redactedServerErrorsOption struct {
+	message string
+}
+
+func (o *redactedServerErrorsOption) applyToHandler(config *handlerConfig) {
+	config.RedactedErrorMessage = o.message
+}
+
+type requestPoolOption struct {
+	pool MessagePool
+}
+
+func (o *requestPoolOption) applyToHandler(config *handlerConfig) {
+	config.RequestPool = o.pool
+}
+
+type allowEmptyRequestBodyOption struct{}
+
+func (o *allowEmptyRequestBodyOption) applyToHandler(config *handlerConfig) {
+	config.AllowEmptyRequestBody = true
+}
+
 type requireConnectProtocolHeaderOption struct{}
 
 func (o *requireConnectProtocolHeaderOption) applyToHandler(config *handlerConfig) {
 	config.RequireConnectProtocolHeader = true
 }
 
+type requireHTTP2ForGRPCOption struct{}
+
+func (o *requireHTTP2ForGRPCOption) applyToHandler(config *handlerConfig) {
+	config.RequireHTTP2ForGRPC = true
+}
+
+type additionalHTTPMethodsOption struct {
+	Methods []string
+}
+
+func (o *additionalHTTPMethodsOption) applyToHandler(config *handlerConfig) {
+	config.AdditionalHTTPMethods = append(config.AdditionalHTTPMethods, o.Methods...)
+}
+
+type effectiveDeadlineHeaderOption struct{}
+
+func (o *effectiveDeadlineHeaderOption) applyToHandler(config *handlerConfig) {
+	config.EffectiveDeadlineHeader = true
+}
+
 type grpcOption struct {
 	web bool
 }
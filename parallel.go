@@ -0,0 +1,67 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync"
+)
+
+// Parallel calls call once for each input, with at most concurrency calls in
+// flight at once. It's intended for batch jobs that issue many unary RPCs:
+// call usually wraps a generated client method.
+//
+// Parallel waits for all calls to finish, then returns their results and
+// errors in the same order as inputs. A failed call doesn't stop the others,
+// so callers can decide how to handle partial failure. If ctx is canceled,
+// calls that haven't started yet fail with an error coded [CodeCanceled] or
+// [CodeDeadlineExceeded]; calls already in flight see the canceled context.
+// A concurrency less than one is treated as one.
+func Parallel[In, Out any](
+	ctx context.Context,
+	concurrency int,
+	inputs []In,
+	call func(context.Context, In) (Out, error),
+) ([]Out, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(inputs) {
+		concurrency = len(inputs)
+	}
+	results := make([]Out, len(inputs))
+	errs := make([]error, len(inputs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				if err := ctx.Err(); err != nil {
+					errs[index] = wrapIfContextError(err)
+					continue
+				}
+				results[index], errs[index] = call(ctx, inputs[index])
+			}
+		}()
+	}
+	for i := range inputs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, errs
+}
@@ -0,0 +1,92 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestParallel(t *testing.T) {
+	t.Parallel()
+	const concurrency = 4
+	var inFlight, maxInFlight int32
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+					break
+				}
+			}
+			if request.Msg.Number%10 == 0 {
+				return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("multiple of ten"))
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number}), nil
+		},
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	ping := func(ctx context.Context, number int64) (*connect.Response[pingv1.PingResponse], error) {
+		return client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: number}))
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		inputs := make([]int64, 100)
+		for i := range inputs {
+			inputs[i] = int64(i + 1)
+		}
+		results, errs := connect.Parallel(context.Background(), concurrency, inputs, ping)
+		assert.Equal(t, len(results), len(inputs))
+		assert.Equal(t, len(errs), len(inputs))
+		for i, number := range inputs {
+			if number%10 == 0 {
+				assert.Equal(t, connect.CodeOf(errs[i]), connect.CodeInvalidArgument)
+				assert.Nil(t, results[i])
+				continue
+			}
+			assert.Nil(t, errs[i])
+			assert.Equal(t, results[i].Msg.Number, number)
+		}
+		assert.True(t, atomic.LoadInt32(&maxInFlight) <= concurrency)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		results, errs := connect.Parallel(ctx, concurrency, []int64{1, 2, 3}, ping)
+		for i := range results {
+			assert.Nil(t, results[i])
+			assert.Equal(t, connect.CodeOf(errs[i]), connect.CodeCanceled)
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		results, errs := connect.Parallel(context.Background(), concurrency, nil, ping)
+		assert.Zero(t, len(results))
+		assert.Zero(t, len(errs))
+	})
+}
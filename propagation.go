@@ -0,0 +1,191 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+)
+
+// A Propagator moves request-scoped metadata, like trace identifiers or
+// baggage, between HTTP headers and Go contexts. Handlers use Extract to
+// populate the context from the headers of incoming requests, and clients use
+// Inject to write any metadata in the context to the headers of outgoing
+// requests.
+//
+// Propagators must be safe to use concurrently.
+type Propagator interface {
+	// Extract returns a copy of the context populated with any metadata found
+	// in the headers. If the headers don't contain any relevant metadata,
+	// Extract should return the context unchanged.
+	Extract(context.Context, http.Header) context.Context
+	// Inject writes any metadata in the context to the headers.
+	Inject(context.Context, http.Header)
+}
+
+// NewPropagationInterceptor returns an interceptor that propagates metadata
+// using each of the supplied Propagators. In handlers, it extracts metadata
+// from the request headers before calling the handler implementation. In
+// clients, it injects metadata from the context into the request headers. A
+// service that uses the same propagators for its handlers and its outbound
+// clients passes metadata along to its own dependencies.
+//
+// Propagators run in the order supplied, so later propagators see any context
+// values set by earlier ones. This makes it easy to support multiple tracing
+// formats at once, for example while migrating from B3 headers to W3C Trace
+// Context.
+func NewPropagationInterceptor(propagators ...Propagator) Interceptor {
+	return &propagationInterceptor{propagators: propagators}
+}
+
+// NewHeaderPropagator returns a Propagator that copies the named headers
+// verbatim. It's useful for simple correlation headers (like X-Request-Id)
+// and for tracing formats without dedicated support.
+//
+// Explicitly-set request headers take precedence: Inject doesn't overwrite
+// headers that are already present.
+func NewHeaderPropagator(keys ...string) Propagator {
+	canonical := make([]string, len(keys))
+	for i, key := range keys {
+		canonical[i] = http.CanonicalHeaderKey(key)
+	}
+	return &headerPropagator{keys: canonical}
+}
+
+// WithClientTracePropagation configures clients to copy the named headers,
+// like X-Request-Id or X-Tenant, from the request being handled to outgoing
+// requests. The incoming headers come from [RequestHeaderFromContext], so
+// calls made with a context derived from a [Handler]'s context forward them
+// transparently, without configuring the handler. This is a lightweight
+// alternative to full distributed tracing for gateways that only need basic
+// correlation. For more control, use [NewPropagationInterceptor].
+//
+// Explicitly-set request headers take precedence: headers that are already
+// present aren't overwritten.
+func WithClientTracePropagation(keys ...string) ClientOption {
+	canonical := make([]string, len(keys))
+	for i, key := range keys {
+		canonical[i] = http.CanonicalHeaderKey(key)
+	}
+	return WithInterceptors(NewPropagationInterceptor(&incomingHeaderPropagator{keys: canonical}))
+}
+
+type propagationInterceptor struct {
+	propagators []Propagator
+}
+
+func (i *propagationInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			i.inject(ctx, request.Header())
+		} else {
+			ctx = i.extract(ctx, request.Header())
+		}
+		return next(ctx, request)
+	}
+}
+
+func (i *propagationInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		conn := next(ctx, spec)
+		i.inject(ctx, conn.RequestHeader())
+		return conn
+	}
+}
+
+func (i *propagationInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return next(i.extract(ctx, conn.RequestHeader()), conn)
+	}
+}
+
+func (i *propagationInterceptor) extract(ctx context.Context, header http.Header) context.Context {
+	for _, propagator := range i.propagators {
+		ctx = propagator.Extract(ctx, header)
+	}
+	return ctx
+}
+
+func (i *propagationInterceptor) inject(ctx context.Context, header http.Header) {
+	for _, propagator := range i.propagators {
+		propagator.Inject(ctx, header)
+	}
+}
+
+type headerPropagator struct {
+	keys []string
+}
+
+type headerPropagatorContextKey struct {
+	propagator *headerPropagator
+}
+
+func (p *headerPropagator) Extract(ctx context.Context, header http.Header) context.Context {
+	var found http.Header
+	for _, key := range p.keys {
+		values := header[key]
+		if len(values) == 0 {
+			continue
+		}
+		if found == nil {
+			found = make(http.Header, len(p.keys))
+		}
+		found[key] = append([]string(nil), values...)
+	}
+	if found == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, headerPropagatorContextKey{p}, found)
+}
+
+func (p *headerPropagator) Inject(ctx context.Context, header http.Header) {
+	found, ok := ctx.Value(headerPropagatorContextKey{p}).(http.Header)
+	if !ok {
+		return
+	}
+	for key, values := range found {
+		if _, ok := header[key]; ok {
+			continue
+		}
+		header[key] = append([]string(nil), values...)
+	}
+}
+
+// incomingHeaderPropagator injects headers from the request being handled,
+// rather than from headers previously extracted into the context.
+type incomingHeaderPropagator struct {
+	keys []string
+}
+
+func (p *incomingHeaderPropagator) Extract(ctx context.Context, _ http.Header) context.Context {
+	return ctx
+}
+
+func (p *incomingHeaderPropagator) Inject(ctx context.Context, header http.Header) {
+	incoming, ok := RequestHeaderFromContext(ctx)
+	if !ok {
+		return
+	}
+	for _, key := range p.keys {
+		values := incoming[key]
+		if len(values) == 0 {
+			continue
+		}
+		if _, ok := header[key]; ok {
+			continue
+		}
+		header[key] = append([]string(nil), values...)
+	}
+}
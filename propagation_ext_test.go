@@ -0,0 +1,183 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestPropagationInterceptor(t *testing.T) {
+	t.Parallel()
+	const (
+		traceHeader   = "X-B3-Traceid"
+		requestHeader = "X-Request-Id"
+		traceID       = "463ac35c9f6413ad48485a3953bb6124"
+		requestID     = "some request"
+	)
+	propagation := connect.WithInterceptors(connect.NewPropagationInterceptor(
+		connect.NewHeaderPropagator(traceHeader),
+		connect.NewHeaderPropagator(requestHeader),
+	))
+
+	// The backend echoes the propagated headers back to the caller.
+	backendMux := http.NewServeMux()
+	backendMux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			response.Header().Set(traceHeader, request.Header().Get(traceHeader))
+			response.Header().Set(requestHeader, request.Header().Get(requestHeader))
+			return response, nil
+		},
+	}))
+	backend := httptest.NewServer(backendMux)
+	t.Cleanup(backend.Close)
+	backendClient := pingv1connect.NewPingServiceClient(backend.Client(), backend.URL, propagation)
+
+	// The frontend calls the backend without explicitly copying any headers.
+	frontendMux := http.NewServeMux()
+	frontendMux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			backendResponse, err := backendClient.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			if err != nil {
+				return nil, err
+			}
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			mergeHeader(response.Header(), backendResponse.Header(), traceHeader, requestHeader)
+			return response, nil
+		},
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			backendResponse, err := backendClient.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			if err != nil {
+				return err
+			}
+			mergeHeader(stream.ResponseHeader(), backendResponse.Header(), traceHeader, requestHeader)
+			return stream.Send(&pingv1.CountUpResponse{})
+		},
+	}, propagation))
+	frontend := httptest.NewServer(frontendMux)
+	t.Cleanup(frontend.Close)
+	frontendClient := pingv1connect.NewPingServiceClient(frontend.Client(), frontend.URL)
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		request := connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set(traceHeader, traceID)
+		request.Header().Set(requestHeader, requestID)
+		response, err := frontendClient.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Header().Get(traceHeader), traceID)
+		assert.Equal(t, response.Header().Get(requestHeader), requestID)
+	})
+	t.Run("streaming", func(t *testing.T) {
+		t.Parallel()
+		request := connect.NewRequest(&pingv1.CountUpRequest{})
+		request.Header().Set(traceHeader, traceID)
+		stream, err := frontendClient.CountUp(context.Background(), request)
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		assert.Equal(t, stream.ResponseHeader().Get(traceHeader), traceID)
+		assert.Zero(t, stream.ResponseHeader().Get(requestHeader))
+		assert.Nil(t, stream.Close())
+	})
+	t.Run("explicit_header_wins", func(t *testing.T) {
+		t.Parallel()
+		propagator := connect.NewHeaderPropagator(traceHeader)
+		ctx := propagator.Extract(
+			context.Background(),
+			http.Header{traceHeader: []string{"propagated"}},
+		)
+		header := make(http.Header)
+		propagator.Inject(ctx, header)
+		assert.Equal(t, header.Values(traceHeader), []string{"propagated"})
+		header = http.Header{traceHeader: []string{traceID}}
+		propagator.Inject(ctx, header)
+		assert.Equal(t, header.Values(traceHeader), []string{traceID})
+	})
+}
+
+func TestClientTracePropagation(t *testing.T) {
+	t.Parallel()
+	forwarded := []string{"X-Request-Id", "X-Tenant", "X-Secret"}
+
+	// The backend echoes the headers it received back to the caller.
+	backendMux := http.NewServeMux()
+	backendMux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			mergeHeader(response.Header(), request.Header(), forwarded...)
+			return response, nil
+		},
+	}))
+	backend := httptest.NewServer(backendMux)
+	t.Cleanup(backend.Close)
+	backendClient := pingv1connect.NewPingServiceClient(
+		backend.Client(),
+		backend.URL,
+		connect.WithClientTracePropagation("x-request-id", "x-tenant"),
+	)
+
+	// The frontend handler isn't configured to propagate anything.
+	frontendMux := http.NewServeMux()
+	frontendMux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			incoming, ok := connect.RequestHeaderFromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, incoming.Get("X-Secret"), "hunter2")
+			backendRequest := connect.NewRequest(&pingv1.PingRequest{})
+			backendRequest.Header().Set("X-Tenant", "explicit")
+			backendResponse, err := backendClient.Ping(ctx, backendRequest)
+			if err != nil {
+				return nil, err
+			}
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			mergeHeader(response.Header(), backendResponse.Header(), forwarded...)
+			return response, nil
+		},
+	}))
+	frontend := httptest.NewServer(frontendMux)
+	t.Cleanup(frontend.Close)
+	frontendClient := pingv1connect.NewPingServiceClient(frontend.Client(), frontend.URL)
+
+	request := connect.NewRequest(&pingv1.PingRequest{})
+	request.Header().Set("X-Request-Id", "some request")
+	request.Header().Set("X-Tenant", "acme")
+	request.Header().Set("X-Secret", "hunter2")
+	response, err := frontendClient.Ping(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, response.Header().Get("X-Request-Id"), "some request")
+	// Explicitly-set headers win, and headers not in the allowlist aren't
+	// forwarded.
+	assert.Equal(t, response.Header().Get("X-Tenant"), "explicit")
+	assert.Zero(t, response.Header().Get("X-Secret"))
+
+	_, ok := connect.RequestHeaderFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func mergeHeader(into, from http.Header, keys ...string) {
+	for _, key := range keys {
+		if value := from.Get(key); value != "" {
+			into.Set(key, value)
+		}
+	}
+}
@@ -40,3 +40,24 @@ func extractProtoPath(url string) string {
 	}
 	return "/" + pkg + "/" + method
 }
+
+// ProcedureParts splits a procedure, like the Procedure field of a [Spec],
+// into its Protobuf package, service, and method names. For example, the
+// procedure "/acme.foo.v1.FooService/Bar" has package "acme.foo.v1", service
+// "FooService", and method "Bar". It's useful for labeling metrics and logs:
+// labeling by service and method (or by method alone) rather than by the
+// full procedure keeps the number of distinct labels small.
+//
+// Services in the root package have an empty package name. If the procedure
+// doesn't have both a service and a method, ProcedureParts returns empty
+// strings.
+func ProcedureParts(procedure string) (pkg, service, method string) { //nolint:nonamedreturns
+	fullService, method, ok := strings.Cut(strings.TrimPrefix(procedure, "/"), "/")
+	if !ok || fullService == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", ""
+	}
+	if dot := strings.LastIndexByte(fullService, '.'); dot >= 0 {
+		return fullService[:dot], fullService[dot+1:], method
+	}
+	return "", fullService, method
+}
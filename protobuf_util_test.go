@@ -51,6 +51,28 @@ func TestParseProtobufURL(t *testing.T) {
 	assertExtractedProtoPath(t, "//", "/")
 }
 
+func TestProcedureParts(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		procedure            string
+		pkg, service, method string
+	}{
+		{"/acme.foo.v1.FooService/Bar", "acme.foo.v1", "FooService", "Bar"},
+		{"acme.foo.v1.FooService/Bar", "acme.foo.v1", "FooService", "Bar"},
+		{"/FooService/Bar", "", "FooService", "Bar"},
+		{"/acme.foo.v1.FooService", "", "", ""},
+		{"/acme.foo.v1.FooService/", "", "", ""},
+		{"/a/b/c", "", "", ""},
+		{"", "", "", ""},
+	}
+	for _, test := range tests {
+		pkg, service, method := ProcedureParts(test.procedure)
+		assert.Equal(t, pkg, test.pkg, assert.Sprintf("package of %q", test.procedure))
+		assert.Equal(t, service, test.service, assert.Sprintf("service of %q", test.procedure))
+		assert.Equal(t, method, test.method, assert.Sprintf("method of %q", test.procedure))
+	}
+}
+
 func assertExtractedProtoPath(tb testing.TB, inputURL, expectPath string) {
 	tb.Helper()
 	assert.Equal(
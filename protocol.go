@@ -15,7 +15,9 @@
 package connect
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -36,10 +38,19 @@ const (
 
 const (
 	headerContentType = "Content-Type"
+	headerAccept      = "Accept"
 	headerUserAgent   = "User-Agent"
 	headerTrailer     = "Trailer"
 
 	discardLimit = 1024 * 1024 * 4 // 4MiB
+	// How much of a response body to include in errors for responses that
+	// aren't valid RPC responses.
+	errorBodySnippetBytes = 512
+	// How much of an error response body clients configured with
+	// WithRejectProtocolMismatch read to look for a Connect error code.
+	protocolErrorPeekBytes = 64 * 1024 // 64KiB
+	// Clients' default limit on the size of response trailers.
+	defaultMaxTrailerBytes = 1024 * 1024 // 1MiB
 )
 
 var errNoTimeout = errors.New("no timeout")
@@ -78,6 +89,8 @@ type protocolHandlerParams struct {
 	ReadMaxBytes                 int
 	SendMaxBytes                 int
 	RequireConnectProtocolHeader bool
+	AllowEmptyRequestBody        bool
+	OmitGRPCAcceptEncoding       bool
 }
 
 // Handler is the server side of a protocol. HTTP handlers typically support
@@ -95,8 +108,44 @@ type protocolHandler interface {
 	// request's context, a nil cancellation function, and a nil error.
 	SetTimeout(*http.Request) (context.Context, context.CancelFunc, error)
 
-	// NewConn constructs a HandlerConn for the message exchange.
-	NewConn(http.ResponseWriter, *http.Request) (handlerConnCloser, bool)
+	// NewConn constructs a HandlerConn for the message exchange. If the
+	// request can't be served (for example, because the client asked for an
+	// unsupported compression algorithm), it also returns an error: the caller
+	// must close the connection with that error rather than serving the RPC.
+	NewConn(http.ResponseWriter, *http.Request) (handlerConnCloser, *Error)
+
+	// WriteError writes an error response to a request with one of the
+	// protocol's Content-Types, without establishing a connection: it must not
+	// read or close the request body. ErrorWriter uses it to write errors from
+	// net/http middleware.
+	WriteError(http.ResponseWriter, *http.Request, error) error
+}
+
+// A handlerProtocol is a protocol that Handlers can serve. Handlers serve
+// every enabled protocol in handlerProtocols, matching requests to protocols
+// by Content-Type, so adding a protocol to Handlers only requires implementing
+// the protocol interface and registering it here: ServeHTTP, the Accept-Post
+// header, and ErrorWriter all work from the registered protocols.
+type handlerProtocol struct {
+	protocol protocol
+	// enabled reports whether Handlers with the config serve the protocol.
+	enabled func(*handlerConfig) bool
+}
+
+//nolint:gochecknoglobals
+var handlerProtocols = []handlerProtocol{
+	{
+		protocol: &protocolConnect{},
+		enabled:  func(*handlerConfig) bool { return true },
+	},
+	{
+		protocol: &protocolGRPC{web: false},
+		enabled:  func(config *handlerConfig) bool { return config.HandleGRPC },
+	},
+	{
+		protocol: &protocolGRPC{web: true},
+		enabled:  func(config *handlerConfig) bool { return config.HandleGRPCWeb },
+	},
 }
 
 // ClientParams are the arguments provided to a Protocol's NewClient method,
@@ -104,15 +153,19 @@ type protocolHandler interface {
 // Protocol implementations should take care to use the supplied Spec rather
 // than constructing their own, since new fields may have been added.
 type protocolClientParams struct {
-	CompressionName  string
-	CompressionPools readOnlyCompressionPools
-	Codec            Codec
-	CompressMinBytes int
-	HTTPClient       HTTPClient
-	URL              string
-	BufferPool       *bufferPool
-	ReadMaxBytes     int
-	SendMaxBytes     int
+	CompressionName            string
+	CompressionPools           readOnlyCompressionPools
+	Codec                      Codec
+	CompressMinBytes           int
+	HTTPClient                 HTTPClient
+	URL                        string
+	BufferPool                 *bufferPool
+	ReadMaxBytes               int
+	SendMaxBytes               int
+	MaxTrailerBytes            int
+	DisableDeadlinePropagation bool // don't send the deadline in a timeout header
+	OmitGRPCAcceptEncoding     bool // gRPC clients don't send Grpc-Accept-Encoding
+	RejectProtocolMismatch     bool // see checkResponseProtocol
 	// The gRPC family of protocols always needs access to a Protobuf codec to
 	// marshal and unmarshal errors.
 	Protobuf Codec
@@ -136,6 +189,20 @@ type protocolClient interface {
 	NewConn(context.Context, Spec, http.Header) StreamingClientConn
 }
 
+// successHTTPStatusSetter is implemented by handler connections whose protocol
+// lets handlers choose the HTTP status of successful responses. Currently,
+// only the Connect protocol's unary connections implement it.
+type successHTTPStatusSetter interface {
+	setSuccessHTTPStatus(int)
+}
+
+// responseCompressionDisabler is implemented by handler connections that can
+// stop compressing responses partway through an RPC. It reports whether
+// compression was disabled in time to affect the response.
+type responseCompressionDisabler interface {
+	disableResponseCompression() bool
+}
+
 // errorTranslatingHandlerConnCloser wraps a handlerConnCloser to ensure that
 // we always return coded errors to users and write coded errors to the
 // network.
@@ -161,6 +228,19 @@ func (hc *errorTranslatingHandlerConnCloser) Close(err error) error {
 	return hc.fromWire(closeErr)
 }
 
+func (hc *errorTranslatingHandlerConnCloser) setSuccessHTTPStatus(status int) {
+	if setter, ok := hc.handlerConnCloser.(successHTTPStatusSetter); ok {
+		setter.setSuccessHTTPStatus(status)
+	}
+}
+
+func (hc *errorTranslatingHandlerConnCloser) disableResponseCompression() bool {
+	if disabler, ok := hc.handlerConnCloser.(responseCompressionDisabler); ok {
+		return disabler.disableResponseCompression()
+	}
+	return false
+}
+
 // errorTranslatingClientConn wraps a StreamingClientConn to make sure that we always
 // return coded errors from clients.
 //
@@ -238,6 +318,157 @@ func discard(reader io.Reader) error {
 	return err
 }
 
+// httpStatusError returns an error for a response whose HTTP status shows
+// that it isn't a valid RPC response. Responses like these often come from
+// proxies, so the error includes the start of the body (usually an HTML or
+// plain text error page) to make the failure diagnosable.
+func httpStatusError(code Code, message string, body []byte) *Error {
+	truncated := len(body) > errorBodySnippetBytes
+	if truncated {
+		body = body[:errorBodySnippetBytes]
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return NewError(code, errors.New(message))
+	}
+	if truncated {
+		return errorf(code, "%s: body %q (truncated)", message, body)
+	}
+	return errorf(code, "%s: body %q", message, body)
+}
+
+// checkResponseProtocol returns an error if the response's Content-Type shows
+// that the server answered with a different protocol than the client's. This
+// usually means that the client and server were configured for different
+// protocols: for example, a gRPC client pointed at a server that only
+// supports Connect. Clients only call it if configured with
+// WithRejectProtocolMismatch.
+//
+// Responses with other content types, like error pages from proxies, are left
+// to protocol-specific validation. So are error statuses that don't look like
+// they came from a server using the other protocol, since proxies and
+// gateways often send JSON error pages.
+func checkResponseProtocol(client string, response *http.Response) *Error {
+	contentType := getHeaderCanonical(response.Header, headerContentType)
+	server := protocolFromContentType(contentType)
+	if server == "" || server == client {
+		return nil
+	}
+	if response.StatusCode != http.StatusOK && !isProtocolError(server, response) {
+		return nil
+	}
+	var hint string
+	switch server {
+	case ProtocolGRPC:
+		hint = "use connect.WithGRPC() to talk to gRPC servers"
+	case ProtocolGRPCWeb:
+		hint = "use connect.WithGRPCWeb() to talk to gRPC-Web servers"
+	default:
+		hint = "the server may not support " + protocolDisplayName(client) +
+			"; remove connect.WithGRPC() and connect.WithGRPCWeb() to use the Connect protocol"
+	}
+	return errorf(
+		CodeInternal,
+		"protocol mismatch: %s client received a %s response (HTTP status %d, Content-Type %q): %s",
+		protocolDisplayName(client), protocolDisplayName(server), response.StatusCode, contentType, hint,
+	)
+}
+
+// isProtocolError reports whether a non-200 response is an error from a
+// server using the given protocol. gRPC servers always send a status header,
+// and Connect servers send a JSON body with a valid code.
+func isProtocolError(server string, response *http.Response) bool {
+	if server != ProtocolConnect {
+		return getHeaderCanonical(response.Header, grpcHeaderStatus) != ""
+	}
+	return isConnectErrorBody(response)
+}
+
+// isConnectErrorBody reports whether the response body is a JSON object with
+// a valid Connect code. Servers usually write the code first, so it typically
+// reads only the start of the body. It reads at most
+// protocolErrorPeekBytes, and it leaves the body intact for the caller.
+func isConnectErrorBody(response *http.Response) bool {
+	var peeked bytes.Buffer
+	decoder := json.NewDecoder(io.TeeReader(
+		io.LimitReader(response.Body, protocolErrorPeekBytes),
+		&peeked,
+	))
+	defer func() {
+		response.Body = &peekedBody{
+			Reader: io.MultiReader(&peeked, response.Body),
+			Closer: response.Body,
+		}
+	}()
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return false
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if key != "code" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return false
+			}
+			continue
+		}
+		var code Code
+		if err := decoder.Decode(&code); err != nil {
+			return false
+		}
+		return code >= minCode && code <= maxCode
+	}
+	return false
+}
+
+// peekedBody is a response body with some data already read into memory.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// protocolFromContentType guesses which protocol produced a response from its
+// content type. It returns an empty string if it can't tell.
+func protocolFromContentType(contentType string) string {
+	base := strings.ToLower(contentType)
+	if i := strings.IndexByte(base, ';'); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	switch {
+	case strings.HasPrefix(base, grpcWebContentTypeDefault):
+		return ProtocolGRPCWeb
+	case strings.HasPrefix(base, grpcContentTypeDefault):
+		return ProtocolGRPC
+	case strings.HasPrefix(base, connectStreamingContentTypePrefix),
+		base == connectUnaryContentTypePrefix+codecNameJSON,
+		base == connectUnaryContentTypePrefix+codecNameProto:
+		return ProtocolConnect
+	default:
+		return ""
+	}
+}
+
+func protocolDisplayName(protocol string) string {
+	switch protocol {
+	case ProtocolGRPC:
+		return "gRPC"
+	case ProtocolGRPCWeb:
+		return "gRPC-Web"
+	default:
+		return "Connect"
+	}
+}
+
+// readBodySnippet reads enough of a response body for httpStatusError.
+func readBodySnippet(body io.Reader) []byte {
+	snippet := make([]byte, errorBodySnippetBytes+1)
+	n, _ := io.ReadFull(body, snippet)
+	return snippet[:n]
+}
+
 func validateRequestURL(rawURL string) (*url.URL, *Error) {
 	url, err := url.ParseRequestURI(rawURL)
 	if err == nil {
@@ -262,11 +493,12 @@ func negotiateCompression( //nolint:nonamedreturns
 	sent, accept string,
 ) (requestCompression, responseCompression string, clientVisibleErr *Error) {
 	requestCompression = compressionIdentity
-	if sent != "" && sent != compressionIdentity {
+	if sent != "" && !strings.EqualFold(sent, compressionIdentity) {
 		// We default to identity, so we only care if the client sends something
-		// other than the empty string or compressIdentity.
-		if availableCompressors.Contains(sent) {
-			requestCompression = sent
+		// other than the empty string or compressIdentity. Compression names are
+		// case-insensitive, but we echo the registered spelling.
+		if name, ok := availableCompressors.Canonical(sent); ok {
+			requestCompression = name
 		} else {
 			// To comply with
 			// https://github.com/grpc/grpc/blob/master/doc/compression.md and the
@@ -288,10 +520,10 @@ func negotiateCompression( //nolint:nonamedreturns
 	// client requested a compression algorithm we support.
 	if responseCompression == compressionIdentity && accept != "" {
 		for _, name := range strings.FieldsFunc(accept, isCommaOrSpace) {
-			if availableCompressors.Contains(name) {
+			if canonical, ok := availableCompressors.Canonical(name); ok {
 				// We found a mutually supported compression algorithm. Unlike standard
 				// HTTP, there's no preference weighting, so can bail out immediately.
-				responseCompression = name
+				responseCompression = canonical
 				break
 			}
 		}
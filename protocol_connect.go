@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"mime"
 	"net/http"
 	"runtime"
 	"strconv"
@@ -81,6 +82,8 @@ func (*protocolConnect) NewClient(params *protocolClientParams) (protocolClient,
 	return &connectClient{
 		protocolClientParams: *params,
 		peer:                 newPeerFromURL(url, ProtocolConnect),
+		unaryContentType:     connectContentTypeFromCodecName(StreamTypeUnary, params.Codec.Name()),
+		streamContentType:    connectContentTypeFromCodecName(StreamTypeBidi, params.Codec.Name()),
 	}, nil
 }
 
@@ -116,7 +119,7 @@ func (*connectHandler) SetTimeout(request *http.Request) (context.Context, conte
 func (h *connectHandler) NewConn(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
-) (handlerConnCloser, bool) {
+) (handlerConnCloser, *Error) {
 	// We need to parse metadata before entering the interceptor stack; we'll
 	// send the error to the client later on.
 	var contentEncoding, acceptEncoding string
@@ -135,6 +138,21 @@ func (h *connectHandler) NewConn(
 	if failed == nil {
 		failed = checkServerStreamsCanFlush(h.Spec, responseWriter)
 	}
+	if failed == nil &&
+		h.Spec.StreamType == StreamTypeUnary &&
+		h.ReadMaxBytes > 0 &&
+		request.ContentLength > int64(h.ReadMaxBytes) {
+		// Unary Connect requests don't use envelopes, so the body is exactly one
+		// (possibly compressed) message. If the client told us up front that it's
+		// too large, reject it without reading the body. When the length isn't
+		// known, the unmarshaler enforces the limit as it reads.
+		failed = errorf(
+			CodeResourceExhausted,
+			"%s size %d is larger than configured max %d",
+			describeMessage(requestCompression != compressionIdentity),
+			request.ContentLength, h.ReadMaxBytes,
+		)
+	}
 	if failed == nil {
 		version := getHeaderCanonical(request.Header, connectHeaderProtocolVersion)
 		if version == "" && h.RequireConnectProtocolHeader {
@@ -171,6 +189,17 @@ func (h *connectHandler) NewConn(
 		getHeaderCanonical(request.Header, headerContentType),
 	)
 	codec := h.Codecs.Get(codecName) // handler.go guarantees this is not nil
+	spec := h.Spec
+	spec.Codec = codecName
+	responseCodec := codec
+	if h.Spec.StreamType == StreamTypeUnary {
+		// Unary responses aren't enveloped, so clients may ask for a different
+		// codec using the Accept header, just as they would with REST APIs.
+		if accepted := connectNegotiateUnaryResponseCodec(h.Codecs, request.Header.Values(headerAccept)); accepted != nil {
+			responseCodec = accepted
+			header[headerContentType] = []string{connectUnaryContentTypePrefix + accepted.Name()}
+		}
+	}
 
 	var conn handlerConnCloser
 	peer := Peer{
@@ -179,13 +208,13 @@ func (h *connectHandler) NewConn(
 	}
 	if h.Spec.StreamType == StreamTypeUnary {
 		conn = &connectUnaryHandlerConn{
-			spec:           h.Spec,
+			spec:           spec,
 			peer:           peer,
 			request:        request,
 			responseWriter: responseWriter,
 			marshaler: connectUnaryMarshaler{
 				writer:           responseWriter,
-				codec:            codec,
+				codec:            responseCodec,
 				compressMinBytes: h.CompressMinBytes,
 				compressionName:  responseCompression,
 				compressionPool:  h.CompressionPools.Get(responseCompression),
@@ -199,12 +228,13 @@ func (h *connectHandler) NewConn(
 				compressionPool: h.CompressionPools.Get(requestCompression),
 				bufferPool:      h.BufferPool,
 				readMaxBytes:    h.ReadMaxBytes,
+				allowEmpty:      h.AllowEmptyRequestBody,
 			},
 			responseTrailer: make(http.Header),
 		}
 	} else {
 		conn = &connectStreamingHandlerConn{
-			spec:           h.Spec,
+			spec:           spec,
 			peer:           peer,
 			request:        request,
 			responseWriter: responseWriter,
@@ -232,18 +262,53 @@ func (h *connectHandler) NewConn(
 	}
 	conn = wrapHandlerConnWithCodedErrors(conn)
 
-	if failed != nil {
-		// Negotiation failed, so we can't establish a stream.
-		_ = conn.Close(failed)
-		return nil, false
+	// If negotiation failed, we can't establish a stream. The caller sends the
+	// error to the client.
+	return conn, failed
+}
+
+func (h *connectHandler) WriteError(response http.ResponseWriter, request *http.Request, err error) error {
+	if h.Spec.StreamType == StreamTypeUnary {
+		// Unary errors are always JSON.
+		setHeaderCanonical(response.Header(), headerContentType, connectUnaryContentTypeJSON)
+		if connectErr, ok := asError(err); ok {
+			mergeHeaders(response.Header(), connectErr.meta)
+		}
+		wireErr := newConnectWireError(err)
+		response.WriteHeader(connectCodeToHTTP(wireErr.Code))
+		data, marshalErr := json.Marshal(wireErr)
+		if marshalErr != nil {
+			return fmt.Errorf("marshal error: %w", marshalErr)
+		}
+		_, writeErr := response.Write(data)
+		return writeErr
+	}
+	setHeaderCanonical(
+		response.Header(),
+		headerContentType,
+		canonicalizeContentType(getHeaderCanonical(request.Header, headerContentType)),
+	)
+	response.WriteHeader(http.StatusOK)
+	marshaler := &connectStreamingMarshaler{
+		envelopeWriter: envelopeWriter{
+			writer:     response,
+			bufferPool: h.BufferPool,
+		},
 	}
-	return conn, true
+	// MarshalEndStream returns *Error: check return value to avoid typed nils.
+	if marshalErr := marshaler.MarshalEndStream(err, make(http.Header)); marshalErr != nil {
+		return marshalErr
+	}
+	return nil
 }
 
 type connectClient struct {
 	protocolClientParams
 
 	peer Peer
+	// Content types are computed once, rather than on every call.
+	unaryContentType  string
+	streamContentType string
 }
 
 func (c *connectClient) Peer() Peer {
@@ -257,9 +322,11 @@ func (c *connectClient) WriteRequestHeader(streamType StreamType, header http.He
 		header[headerUserAgent] = []string{defaultConnectUserAgent}
 	}
 	header[connectHeaderProtocolVersion] = []string{connectProtocolVersion}
-	header[headerContentType] = []string{
-		connectContentTypeFromCodecName(streamType, c.Codec.Name()),
+	contentType := c.unaryContentType
+	if streamType != StreamTypeUnary {
+		contentType = c.streamContentType
 	}
+	header[headerContentType] = []string{contentType}
 	acceptCompressionHeader := connectUnaryHeaderAcceptCompression
 	if streamType != StreamTypeUnary {
 		// If we don't set Accept-Encoding, by default http.Client will ask the
@@ -285,7 +352,7 @@ func (c *connectClient) NewConn(
 	spec Spec,
 	header http.Header,
 ) StreamingClientConn {
-	if deadline, ok := ctx.Deadline(); ok {
+	if deadline, ok := ctx.Deadline(); ok && !c.DisableDeadlinePropagation {
 		millis := int64(time.Until(deadline) / time.Millisecond)
 		if millis > 0 {
 			encoded := strconv.FormatInt(millis, 10 /* base */)
@@ -319,8 +386,10 @@ func (c *connectClient) NewConn(
 				bufferPool:   c.BufferPool,
 				readMaxBytes: c.ReadMaxBytes,
 			},
-			responseHeader:  make(http.Header),
-			responseTrailer: make(http.Header),
+			responseHeader:         make(http.Header),
+			responseTrailer:        make(http.Header),
+			maxTrailerBytes:        c.MaxTrailerBytes,
+			rejectProtocolMismatch: c.RejectProtocolMismatch,
 		}
 		conn = unaryConn
 		duplexCall.SetValidateResponse(unaryConn.validateResponse)
@@ -344,14 +413,16 @@ func (c *connectClient) NewConn(
 			},
 			unmarshaler: connectStreamingUnmarshaler{
 				envelopeReader: envelopeReader{
-					reader:       duplexCall,
-					codec:        c.Codec,
-					bufferPool:   c.BufferPool,
-					readMaxBytes: c.ReadMaxBytes,
+					reader:          duplexCall,
+					codec:           c.Codec,
+					bufferPool:      c.BufferPool,
+					readMaxBytes:    c.ReadMaxBytes,
+					trailerMaxBytes: c.MaxTrailerBytes,
 				},
 			},
-			responseHeader:  make(http.Header),
-			responseTrailer: make(http.Header),
+			responseHeader:         make(http.Header),
+			responseTrailer:        make(http.Header),
+			rejectProtocolMismatch: c.RejectProtocolMismatch,
 		}
 		conn = streamingConn
 		duplexCall.SetValidateResponse(streamingConn.validateResponse)
@@ -369,6 +440,9 @@ type connectUnaryClientConn struct {
 	unmarshaler      connectUnaryUnmarshaler
 	responseHeader   http.Header
 	responseTrailer  http.Header
+	maxTrailerBytes  int
+	// From WithRejectProtocolMismatch.
+	rejectProtocolMismatch bool
 }
 
 func (cc *connectUnaryClientConn) Spec() Spec {
@@ -417,6 +491,11 @@ func (cc *connectUnaryClientConn) CloseResponse() error {
 }
 
 func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Error {
+	if cc.rejectProtocolMismatch {
+		if err := checkResponseProtocol(ProtocolConnect, response); err != nil {
+			return err
+		}
+	}
 	for k, v := range response.Header {
 		if !strings.HasPrefix(k, connectUnaryTrailerPrefix) {
 			cc.responseHeader[k] = v
@@ -424,6 +503,13 @@ func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Err
 		}
 		cc.responseTrailer[strings.TrimPrefix(k, connectUnaryTrailerPrefix)] = v
 	}
+	if size := headerBytes(cc.responseTrailer); cc.maxTrailerBytes > 0 && size > cc.maxTrailerBytes {
+		return errorf(
+			CodeResourceExhausted,
+			"response trailers are %d bytes, exceeding the %d byte limit",
+			size, cc.maxTrailerBytes,
+		)
+	}
 	compression := getHeaderCanonical(response.Header, connectUnaryHeaderCompression)
 	if compression != "" &&
 		compression != compressionIdentity &&
@@ -435,18 +521,26 @@ func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Err
 			cc.compressionPools.CommaSeparatedNames(),
 		)
 	}
-	if response.StatusCode != http.StatusOK {
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
 		unmarshaler := connectUnaryUnmarshaler{
 			reader:          response.Body,
 			compressionPool: cc.compressionPools.Get(compression),
 			bufferPool:      cc.bufferPool,
 		}
 		var wireErr connectWireError
-		if err := unmarshaler.UnmarshalFunc(&wireErr, json.Unmarshal); err != nil {
-			return NewError(
-				connectHTTPToCode(response.StatusCode),
-				errors.New(response.Status),
-			)
+		var body []byte
+		unmarshal := func(data []byte, v any) error {
+			// Keep the start of the body for the error if it isn't a Connect
+			// error, but parse all of it: errors with details are often large.
+			snippet := data
+			if len(snippet) > errorBodySnippetBytes {
+				snippet = snippet[:errorBodySnippetBytes+1]
+			}
+			body = append(body, snippet...) // data is pooled
+			return json.Unmarshal(data, v)
+		}
+		if err := unmarshaler.UnmarshalFunc(&wireErr, unmarshal); err != nil {
+			return httpStatusError(connectHTTPToCode(response.StatusCode), response.Status, body)
 		}
 		serverErr := wireErr.asError()
 		if serverErr == nil {
@@ -457,6 +551,10 @@ func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Err
 		return serverErr
 	}
 	cc.unmarshaler.compressionPool = cc.compressionPools.Get(compression)
+	// Handlers may use any 2xx status for successful responses (see
+	// Response.SetHTTPStatus), so we accept the whole range. 204s can't have a
+	// body.
+	cc.unmarshaler.allowEmpty = response.StatusCode == http.StatusNoContent
 	return nil
 }
 
@@ -471,6 +569,8 @@ type connectStreamingClientConn struct {
 	unmarshaler      connectStreamingUnmarshaler
 	responseHeader   http.Header
 	responseTrailer  http.Header
+	// From WithRejectProtocolMismatch.
+	rejectProtocolMismatch bool
 }
 
 func (cc *connectStreamingClientConn) Spec() Spec {
@@ -537,8 +637,17 @@ func (cc *connectStreamingClientConn) CloseResponse() error {
 }
 
 func (cc *connectStreamingClientConn) validateResponse(response *http.Response) *Error {
+	if cc.rejectProtocolMismatch {
+		if err := checkResponseProtocol(ProtocolConnect, response); err != nil {
+			return err
+		}
+	}
 	if response.StatusCode != http.StatusOK {
-		return errorf(connectHTTPToCode(response.StatusCode), "HTTP status %v", response.Status)
+		return httpStatusError(
+			connectHTTPToCode(response.StatusCode),
+			"HTTP status "+response.Status,
+			readBodySnippet(response.Body),
+		)
 	}
 	compression := getHeaderCanonical(response.Header, connectStreamingHeaderCompression)
 	if compression != "" &&
@@ -565,6 +674,7 @@ type connectUnaryHandlerConn struct {
 	unmarshaler     connectUnaryUnmarshaler
 	responseTrailer http.Header
 	wroteBody       bool
+	successStatus   int
 }
 
 func (hc *connectUnaryHandlerConn) Spec() Spec {
@@ -577,7 +687,7 @@ func (hc *connectUnaryHandlerConn) Peer() Peer {
 
 func (hc *connectUnaryHandlerConn) Receive(msg any) error {
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
-		return err
+		return wrapIfClientGone(hc.request.Context(), err)
 	}
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
@@ -589,6 +699,20 @@ func (hc *connectUnaryHandlerConn) RequestHeader() http.Header {
 func (hc *connectUnaryHandlerConn) Send(msg any) error {
 	hc.wroteBody = true
 	hc.writeResponseHeader(nil /* error */)
+	switch hc.successStatus {
+	case 0, http.StatusOK:
+	case http.StatusNoContent:
+		// HTTP doesn't allow 204 responses to have a body.
+		hc.responseWriter.WriteHeader(hc.successStatus)
+		return nil
+	default:
+		// The marshaler may still need to set Content-Encoding, so we can't write
+		// the status until it writes the body.
+		hc.marshaler.writer = &connectUnaryStatusWriter{
+			responseWriter: hc.responseWriter,
+			status:         hc.successStatus,
+		}
+	}
 	if err := hc.marshaler.Marshal(msg); err != nil {
 		return err
 	}
@@ -612,8 +736,9 @@ func (hc *connectUnaryHandlerConn) Close(err error) error {
 	}
 	// In unary Connect, errors always use application/json.
 	setHeaderCanonical(hc.responseWriter.Header(), headerContentType, connectUnaryContentTypeJSON)
-	hc.responseWriter.WriteHeader(connectCodeToHTTP(CodeOf(err)))
-	data, marshalErr := json.Marshal(newConnectWireError(err))
+	wireErr := newConnectWireError(err)
+	hc.responseWriter.WriteHeader(connectCodeToHTTP(wireErr.Code))
+	data, marshalErr := json.Marshal(wireErr)
 	if marshalErr != nil {
 		_ = hc.request.Body.Close()
 		return errorf(CodeInternal, "marshal error: %w", err)
@@ -625,6 +750,18 @@ func (hc *connectUnaryHandlerConn) Close(err error) error {
 	return hc.request.Body.Close()
 }
 
+func (hc *connectUnaryHandlerConn) setSuccessHTTPStatus(status int) {
+	hc.successStatus = status
+}
+
+func (hc *connectUnaryHandlerConn) disableResponseCompression() bool {
+	if hc.wroteBody {
+		return false
+	}
+	hc.marshaler.compressionPool = nil
+	return true
+}
+
 func (hc *connectUnaryHandlerConn) writeResponseHeader(err error) {
 	header := hc.responseWriter.Header()
 	if err != nil {
@@ -637,6 +774,22 @@ func (hc *connectUnaryHandlerConn) writeResponseHeader(err error) {
 	}
 }
 
+// connectUnaryStatusWriter writes a custom HTTP status before the first
+// write to the response body.
+type connectUnaryStatusWriter struct {
+	responseWriter http.ResponseWriter
+	status         int
+	wroteHeader    bool
+}
+
+func (w *connectUnaryStatusWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.responseWriter.WriteHeader(w.status)
+	}
+	return w.responseWriter.Write(data)
+}
+
 type connectStreamingHandlerConn struct {
 	spec            Spec
 	peer            Peer
@@ -659,7 +812,7 @@ func (hc *connectStreamingHandlerConn) Receive(msg any) error {
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
 		// Clients may not send end-of-stream metadata, so we don't need to handle
 		// errSpecialEnvelope.
-		return err
+		return wrapIfClientGone(hc.request.Context(), err)
 	}
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
@@ -676,6 +829,15 @@ func (hc *connectStreamingHandlerConn) Send(msg any) error {
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
+func (hc *connectStreamingHandlerConn) disableResponseCompression() bool {
+	// Each envelope says whether its message is compressed, so we can stop
+	// compressing at any time. If the headers haven't been sent yet, don't
+	// advertise compression at all.
+	hc.marshaler.compressionPool = nil
+	delete(hc.responseWriter.Header(), connectStreamingHeaderCompression)
+	return true
+}
+
 func (hc *connectStreamingHandlerConn) ResponseHeader() http.Header {
 	return hc.responseWriter.Header()
 }
@@ -822,6 +984,9 @@ type connectUnaryUnmarshaler struct {
 	bufferPool      *bufferPool
 	alreadyRead     bool
 	readMaxBytes    int
+	// If set, an empty body unmarshals to the message's zero value rather than
+	// being passed to the codec.
+	allowEmpty bool
 }
 
 func (u *connectUnaryUnmarshaler) Unmarshal(message any) *Error {
@@ -854,9 +1019,17 @@ func (u *connectUnaryUnmarshaler) UnmarshalFunc(message any, unmarshal func([]by
 		// Attempt to read to end in order to allow connection re-use
 		discardedBytes, err := io.Copy(io.Discard, u.reader)
 		if err != nil {
-			return errorf(CodeResourceExhausted, "message is larger than configured max %d - unable to determine message size: %w", u.readMaxBytes, err)
+			return errorf(
+				CodeResourceExhausted,
+				"%s is larger than configured max %d - unable to determine message size: %w",
+				describeMessage(u.compressionPool != nil), u.readMaxBytes, err,
+			)
 		}
-		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", bytesRead+discardedBytes, u.readMaxBytes)
+		return errorf(
+			CodeResourceExhausted,
+			"%s size %d is larger than configured max %d",
+			describeMessage(u.compressionPool != nil), bytesRead+discardedBytes, u.readMaxBytes,
+		)
 	}
 	if data.Len() > 0 && u.compressionPool != nil {
 		decompressed := u.bufferPool.Get()
@@ -866,6 +1039,9 @@ func (u *connectUnaryUnmarshaler) UnmarshalFunc(message any, unmarshal func([]by
 		}
 		data = decompressed
 	}
+	if data.Len() == 0 && u.allowEmpty {
+		return nil
+	}
 	if err := unmarshal(data.Bytes(), message); err != nil {
 		return errorf(CodeInvalidArgument, "unmarshal into %T: %w", message, err)
 	}
@@ -880,6 +1056,15 @@ func (d *connectWireDetail) MarshalJSON() ([]byte, error) {
 		// lets proxies w/o protobuf descriptors preserve human-readable details.
 		return []byte(d.wireJSON), nil
 	}
+	if d.pb == nil {
+		return json.Marshal(struct {
+			Type string          `json:"type"`
+			JSON json.RawMessage `json:"json"`
+		}{
+			Type: d.jsonType,
+			JSON: d.jsonValue,
+		})
+	}
 	wire := struct {
 		Type  string          `json:"type"`
 		Value string          `json:"value"`
@@ -900,12 +1085,21 @@ func (d *connectWireDetail) MarshalJSON() ([]byte, error) {
 
 func (d *connectWireDetail) UnmarshalJSON(data []byte) error {
 	var wire struct {
-		Type  string `json:"type"`
-		Value string `json:"value"`
+		Type  string          `json:"type"`
+		Value string          `json:"value"`
+		JSON  json.RawMessage `json:"json"`
 	}
 	if err := json.Unmarshal(data, &wire); err != nil {
 		return err
 	}
+	if wire.Value == "" && len(wire.JSON) > 0 {
+		*d = connectWireDetail{
+			jsonType:  wire.Type,
+			jsonValue: wire.JSON,
+			wireJSON:  string(data),
+		}
+		return nil
+	}
 	if !strings.Contains(wire.Type, "/") {
 		wire.Type = defaultAnyResolverPrefix + wire.Type
 	}
@@ -936,6 +1130,12 @@ func newConnectWireError(err error) *connectWireError {
 	}
 	if connectErr, ok := asError(err); ok {
 		wire.Code = connectErr.Code()
+		if wire.Code < minCode || wire.Code > maxCode {
+			// The Connect protocol only allows the codes it defines, and clients map
+			// anything else to unknown. Normalizing here keeps the body's code
+			// consistent with the HTTP status.
+			wire.Code = CodeUnknown
+		}
 		wire.Message = connectErr.Message()
 		if len(connectErr.details) > 0 {
 			wire.Details = make([]*connectWireDetail, len(connectErr.details))
@@ -1046,6 +1246,51 @@ func connectCodecFromContentType(streamType StreamType, contentType string) stri
 	return strings.TrimPrefix(contentType, connectStreamingContentTypePrefix)
 }
 
+// connectNegotiateUnaryResponseCodec chooses a response codec from the
+// request's Accept header. It prefers the most-preferred media type with a
+// registered codec, using the header's order to break ties. Vendor media types
+// match the codec named by their suffix, so application/vnd.acme+json selects
+// the JSON codec. It returns nil if the header is missing, lists only
+// wildcards, or doesn't name any registered codec, in which case the response
+// uses the request's codec.
+func connectNegotiateUnaryResponseCodec(codecs readOnlyCodecs, accept []string) Codec {
+	var (
+		best     Codec
+		bestRank float64
+	)
+	for _, value := range accept {
+		for _, mediaRange := range strings.Split(value, ",") {
+			base, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil || !strings.HasPrefix(base, connectUnaryContentTypePrefix) {
+				continue
+			}
+			rank := 1.0
+			if quality, ok := params["q"]; ok {
+				if rank, err = strconv.ParseFloat(quality, 64); err != nil {
+					continue
+				}
+				delete(params, "q")
+			}
+			if rank <= bestRank {
+				continue
+			}
+			contentType := canonicalizeContentTypeSlow(mime.FormatMediaType(base, params))
+			codec := codecs.Get(strings.TrimPrefix(contentType, connectUnaryContentTypePrefix))
+			if codec == nil {
+				// Vendor media types (like application/vnd.acme.v1+json) name their
+				// underlying format with a structured syntax suffix.
+				if i := strings.LastIndexByte(base, '+'); i >= 0 {
+					codec = codecs.Get(base[i+1:])
+				}
+			}
+			if codec != nil {
+				best, bestRank = codec, rank
+			}
+		}
+	}
+	return best
+}
+
 func connectContentTypeFromCodecName(streamType StreamType, name string) string {
 	if streamType == StreamTypeUnary {
 		return connectUnaryContentTypePrefix + name
@@ -15,13 +15,20 @@
 package connect
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/bufbuild/connect-go/internal/assert"
 	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestConnectErrorDetailMarshaling(t *testing.T) {
@@ -38,6 +45,36 @@ func TestConnectErrorDetailMarshaling(t *testing.T) {
 	assert.Equal(t, unmarshaled.pb, detail.pb)
 }
 
+func TestConnectJSONErrorDetailMarshaling(t *testing.T) {
+	t.Parallel()
+	type quota struct {
+		Limit int `json:"limit"`
+	}
+	detail, err := NewJSONErrorDetail("acme.Quota", quota{Limit: 10})
+	assert.Nil(t, err)
+	data, err := json.Marshal((*connectWireDetail)(detail))
+	assert.Nil(t, err)
+	assert.Equal(t, string(data), `{"type":"acme.Quota","json":{"limit":10}}`)
+
+	var unmarshaled connectWireDetail
+	assert.Nil(t, json.Unmarshal(data, &unmarshaled))
+	received := (*ErrorDetail)(&unmarshaled)
+	assert.Equal(t, received.Type(), "acme.Quota")
+	value, ok := received.JSON()
+	assert.True(t, ok)
+	var got quota
+	assert.Nil(t, json.Unmarshal(value, &got))
+	assert.Equal(t, got, quota{Limit: 10})
+	_, err = received.Value()
+	assert.NotNil(t, err)
+
+	// Protobuf details aren't JSON details, even though they're sent as JSON.
+	protoDetail, err := NewErrorDetail(durationpb.New(time.Second))
+	assert.Nil(t, err)
+	_, ok = protoDetail.JSON()
+	assert.False(t, ok)
+}
+
 func TestConnectErrorDetailMarshalingNoDescriptor(t *testing.T) {
 	t.Parallel()
 	raw := `{"type":"acme.user.v1.User","value":"DEADBF",` +
@@ -54,3 +91,114 @@ func TestConnectErrorDetailMarshalingNoDescriptor(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, string(encoded), raw)
 }
+
+func TestConnectUnaryErrorStatusAndCode(t *testing.T) {
+	t.Parallel()
+	// The code names and HTTP statuses from the "Error Codes" table of the
+	// Connect protocol specification.
+	testCases := []struct {
+		err      error
+		wantCode string
+		wantHTTP int
+	}{
+		{NewError(CodeCanceled, errors.New("oops")), "canceled", 408},
+		{NewError(CodeUnknown, errors.New("oops")), "unknown", 500},
+		{NewError(CodeInvalidArgument, errors.New("oops")), "invalid_argument", 400},
+		{NewError(CodeDeadlineExceeded, errors.New("oops")), "deadline_exceeded", 408},
+		{NewError(CodeNotFound, errors.New("oops")), "not_found", 404},
+		{NewError(CodeAlreadyExists, errors.New("oops")), "already_exists", 409},
+		{NewError(CodePermissionDenied, errors.New("oops")), "permission_denied", 403},
+		{NewError(CodeResourceExhausted, errors.New("oops")), "resource_exhausted", 429},
+		{NewError(CodeFailedPrecondition, errors.New("oops")), "failed_precondition", 412},
+		{NewError(CodeAborted, errors.New("oops")), "aborted", 409},
+		{NewError(CodeOutOfRange, errors.New("oops")), "out_of_range", 400},
+		{NewError(CodeUnimplemented, errors.New("oops")), "unimplemented", 404},
+		{NewError(CodeInternal, errors.New("oops")), "internal", 500},
+		{NewError(CodeUnavailable, errors.New("oops")), "unavailable", 503},
+		{NewError(CodeDataLoss, errors.New("oops")), "data_loss", 500},
+		{NewError(CodeUnauthenticated, errors.New("oops")), "unauthenticated", 401},
+		// Errors without a valid code are sent as unknown.
+		{errors.New("oops"), "unknown", 500},
+		{NewError(Code(0), errors.New("oops")), "unknown", 500},
+		{NewError(Code(99), errors.New("oops")), "unknown", 500},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.wantCode, func(t *testing.T) {
+			t.Parallel()
+			handler := NewUnaryHandler(
+				"/connect.ping.v1.PingService/Ping",
+				func(context.Context, *Request[emptypb.Empty]) (*Response[emptypb.Empty], error) {
+					return nil, testCase.err
+				},
+			)
+			request := httptest.NewRequest(http.MethodPost, "/connect.ping.v1.PingService/Ping", strings.NewReader("{}"))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			assert.Equal(t, recorder.Code, testCase.wantHTTP)
+			var body struct {
+				Code string `json:"code"`
+			}
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			assert.Equal(t, body.Code, testCase.wantCode)
+			// The code in the body always maps to the HTTP status.
+			var wireCode Code
+			assert.Nil(t, wireCode.UnmarshalText([]byte(body.Code)))
+			assert.Equal(t, connectCodeToHTTP(wireCode), recorder.Code)
+		})
+	}
+}
+
+func TestConnectEndStreamTrailers(t *testing.T) {
+	t.Parallel()
+	const procedure = "/connect.ping.v1.PingService/CountUp"
+	handler := NewServerStreamHandler(
+		procedure,
+		func(_ context.Context, _ *Request[emptypb.Empty], stream *ServerStream[emptypb.Empty]) error {
+			stream.ResponseTrailer().Add("X-Count", "1")
+			stream.ResponseTrailer().Add("X-Count", "2")
+			return stream.Send(&emptypb.Empty{})
+		},
+	)
+
+	// On the wire, trailers are the metadata of the end-of-stream message.
+	body := []byte{0, 0, 0, 0, 2, '{', '}'}
+	request := httptest.NewRequest(http.MethodPost, procedure, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/connect+json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	assert.Zero(t, recorder.Header().Get("X-Count"))
+	var frames [][]byte
+	var flags []byte
+	rest := recorder.Body.Bytes()
+	for len(rest) >= 5 {
+		size := binary.BigEndian.Uint32(rest[1:5])
+		flags = append(flags, rest[0])
+		frames = append(frames, rest[5:5+size])
+		rest = rest[5+size:]
+	}
+	assert.Equal(t, len(frames), 2)
+	assert.Equal(t, flags[1], connectFlagEnvelopeEndStream)
+	var end struct {
+		Error    *connectWireError   `json:"error"`
+		Metadata map[string][]string `json:"metadata"`
+	}
+	assert.Nil(t, json.Unmarshal(frames[1], &end))
+	assert.Nil(t, end.Error)
+	assert.Equal(t, end.Metadata["X-Count"], []string{"1", "2"})
+
+	// Clients expose the end-of-stream metadata as trailers.
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewClient[emptypb.Empty, emptypb.Empty](server.Client(), server.URL+procedure)
+	stream, err := client.CallServerStream(context.Background(), NewRequest(&emptypb.Empty{}))
+	assert.Nil(t, err)
+	assert.True(t, stream.Receive())
+	assert.False(t, stream.Receive())
+	assert.Nil(t, stream.Err())
+	assert.Equal(t, stream.ResponseTrailer().Values("X-Count"), []string{"1", "2"})
+	assert.Zero(t, stream.ResponseHeader().Get("X-Count"))
+	assert.Nil(t, stream.Close())
+}
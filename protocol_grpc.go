@@ -44,6 +44,7 @@ const (
 
 	grpcTimeoutMaxHours = math.MaxInt64 / int64(time.Hour) // how many hours fit into a time.Duration?
 	grpcMaxTimeoutChars = 8                                // from gRPC protocol
+	grpcMaxMessageBytes = 8 * 1024                         // well under common header size limits
 
 	grpcContentTypeDefault    = "application/grpc"
 	grpcWebContentTypeDefault = "application/grpc-web"
@@ -153,7 +154,7 @@ func (*grpcHandler) SetTimeout(request *http.Request) (context.Context, context.
 func (g *grpcHandler) NewConn(
 	responseWriter http.ResponseWriter,
 	request *http.Request,
-) (handlerConnCloser, bool) {
+) (handlerConnCloser, *Error) {
 	// We need to parse metadata before entering the interceptor stack; we'll
 	// send the error to the client later on.
 	requestCompression, responseCompression, failed := negotiateCompression(
@@ -174,19 +175,23 @@ func (g *grpcHandler) NewConn(
 	// skip the normalization in Header.Set.
 	header := responseWriter.Header()
 	header[headerContentType] = []string{getHeaderCanonical(request.Header, headerContentType)}
-	header[grpcHeaderAcceptCompression] = []string{g.CompressionPools.CommaSeparatedNames()}
+	if !g.OmitGRPCAcceptEncoding {
+		header[grpcHeaderAcceptCompression] = []string{g.CompressionPools.CommaSeparatedNames()}
+	}
 	if responseCompression != compressionIdentity {
 		header[grpcHeaderCompression] = []string{responseCompression}
 	}
 
 	codecName := grpcCodecFromContentType(g.web, getHeaderCanonical(request.Header, headerContentType))
 	codec := g.Codecs.Get(codecName) // handler.go guarantees this is not nil
+	spec := g.Spec
+	spec.Codec = codecName
 	protocolName := ProtocolGRPC
 	if g.web {
 		protocolName = ProtocolGRPCWeb
 	}
 	conn := wrapHandlerConnWithCodedErrors(&grpcHandlerConn{
-		spec: g.Spec,
+		spec: spec,
 		peer: Peer{
 			Addr:     request.RemoteAddr,
 			Protocol: protocolName,
@@ -219,12 +224,56 @@ func (g *grpcHandler) NewConn(
 			web: g.web,
 		},
 	})
-	if failed != nil {
-		// Negotiation failed, so we can't establish a stream.
-		_ = conn.Close(failed)
-		return nil, false
+	// If negotiation failed, we can't establish a stream. The caller sends the
+	// error to the client.
+	return conn, failed
+}
+
+func (g *grpcHandler) WriteError(response http.ResponseWriter, request *http.Request, err error) error {
+	setHeaderCanonical(
+		response.Header(),
+		headerContentType,
+		canonicalizeContentType(getHeaderCanonical(request.Header, headerContentType)),
+	)
+	if g.web {
+		// This is a trailers-only response. To match the behavior of Envoy and
+		// grpcHandlerConn, put the trailers in the HTTP headers.
+		grpcErrorToTrailer(g.BufferPool, response.Header(), g.Codecs.Protobuf(), err)
+		response.WriteHeader(http.StatusOK)
+		return nil
+	}
+	trailers := make(http.Header, 2) // need space for at least code & message
+	grpcErrorToTrailer(g.BufferPool, trailers, g.Codecs.Protobuf(), err)
+	// To make net/http reliably send trailers without a body, we must set the
+	// Trailers header rather than using http.TrailerPrefix. See
+	// https://github.com/golang/go/issues/54723.
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	setHeaderCanonical(response.Header(), headerTrailer, strings.Join(keys, ","))
+	response.WriteHeader(http.StatusOK)
+	mergeHeaders(response.Header(), trailers)
+	return nil
+}
+
+// writeRequiresHTTP2 rejects a gRPC request that arrived over HTTP/1.1 with
+// err, after any error hooks have run.
+// The status goes in the HTTP headers, like a trailers-only response, since
+// trailers may not reach the client. We don't send a 426 with an Upgrade
+// header: clients can't upgrade an in-flight gRPC request, and h2c upgrades
+// don't apply over TLS.
+func (g *grpcHandler) writeRequiresHTTP2(responseWriter http.ResponseWriter, err error) {
+	message := err.Error()
+	if connectErr, ok := asError(err); ok {
+		message = connectErr.Message()
 	}
-	return conn, true
+	header := responseWriter.Header()
+	setHeaderCanonical(header, headerContentType, "text/plain; charset=utf-8")
+	setHeaderCanonical(header, grpcHeaderStatus, strconv.Itoa(int(CodeOf(err))))
+	setHeaderCanonical(header, grpcHeaderMessage, grpcPercentEncode(g.BufferPool, message))
+	responseWriter.WriteHeader(http.StatusHTTPVersionNotSupported)
+	_, _ = io.WriteString(responseWriter, message)
 }
 
 type grpcClient struct {
@@ -252,7 +301,7 @@ func (g *grpcClient) WriteRequestHeader(_ StreamType, header http.Header) {
 	if g.CompressionName != "" && g.CompressionName != compressionIdentity {
 		header[grpcHeaderCompression] = []string{g.CompressionName}
 	}
-	if acceptCompression := g.CompressionPools.CommaSeparatedNames(); acceptCompression != "" {
+	if acceptCompression := g.CompressionPools.CommaSeparatedNames(); acceptCompression != "" && !g.OmitGRPCAcceptEncoding {
 		header[grpcHeaderAcceptCompression] = []string{acceptCompression}
 	}
 	if !g.web {
@@ -267,7 +316,7 @@ func (g *grpcClient) NewConn(
 	spec Spec,
 	header http.Header,
 ) StreamingClientConn {
-	if deadline, ok := ctx.Deadline(); ok {
+	if deadline, ok := ctx.Deadline(); ok && !g.DisableDeadlinePropagation {
 		if encodedDeadline, err := grpcEncodeTimeout(time.Until(deadline)); err == nil {
 			// Tests verify that the error in encodeTimeout is unreachable, so we
 			// don't need to handle the error case.
@@ -300,14 +349,17 @@ func (g *grpcClient) NewConn(
 		},
 		unmarshaler: grpcUnmarshaler{
 			envelopeReader: envelopeReader{
-				reader:       duplexCall,
-				codec:        g.Codec,
-				bufferPool:   g.BufferPool,
-				readMaxBytes: g.ReadMaxBytes,
+				reader:          duplexCall,
+				codec:           g.Codec,
+				bufferPool:      g.BufferPool,
+				readMaxBytes:    g.ReadMaxBytes,
+				trailerMaxBytes: g.MaxTrailerBytes,
 			},
 		},
-		responseHeader:  make(http.Header),
-		responseTrailer: make(http.Header),
+		responseHeader:         make(http.Header),
+		responseTrailer:        make(http.Header),
+		maxTrailerBytes:        g.MaxTrailerBytes,
+		rejectProtocolMismatch: g.RejectProtocolMismatch,
 	}
 	duplexCall.SetValidateResponse(conn.validateResponse)
 	if g.web {
@@ -338,6 +390,10 @@ type grpcClientConn struct {
 	responseHeader   http.Header
 	responseTrailer  http.Header
 	readTrailers     func(*grpcUnmarshaler, *duplexHTTPCall) http.Header
+	trailersOnly     bool // set by validateResponse
+	maxTrailerBytes  int
+	// From WithRejectProtocolMismatch.
+	rejectProtocolMismatch bool
 }
 
 func (cc *grpcClientConn) Spec() Spec {
@@ -369,17 +425,20 @@ func (cc *grpcClientConn) Receive(msg any) error {
 	if err == nil {
 		return nil
 	}
-	if getHeaderCanonical(cc.responseHeader, grpcHeaderStatus) != "" {
+	if cc.trailersOnly {
 		// We got what gRPC calls a trailers-only response, which puts the trailing
 		// metadata (including errors) into HTTP headers. validateResponse has
-		// already extracted the error.
+		// already extracted the trailers and any error, so the stream ended
+		// without messages.
 		return err
 	}
 	// See if the server sent an explicit error in the HTTP or gRPC-Web trailers.
-	mergeHeaders(
-		cc.responseTrailer,
-		cc.readTrailers(&cc.unmarshaler, cc.duplexCall),
-	)
+	trailers := cc.readTrailers(&cc.unmarshaler, cc.duplexCall)
+	if tooLarge := cc.checkTrailerBytes(trailers); tooLarge != nil {
+		cc.duplexCall.SetError(tooLarge)
+		return tooLarge
+	}
+	mergeHeaders(cc.responseTrailer, trailers)
 	serverErr := grpcErrorFromTrailer(cc.bufferPool, cc.protobuf, cc.responseTrailer)
 	if serverErr != nil && (errors.Is(err, io.EOF) || !errors.Is(serverErr, errTrailersWithoutGRPCStatus)) {
 		// We've either:
@@ -417,6 +476,21 @@ func (cc *grpcClientConn) CloseResponse() error {
 }
 
 func (cc *grpcClientConn) validateResponse(response *http.Response) *Error {
+	protocol := ProtocolGRPC
+	if cc.unmarshaler.web {
+		protocol = ProtocolGRPCWeb
+	}
+	if cc.rejectProtocolMismatch {
+		if err := checkResponseProtocol(protocol, response); err != nil {
+			return err
+		}
+	}
+	if getHeaderCanonical(response.Header, grpcHeaderStatus) != "" {
+		// Trailers-only responses put the trailers in the HTTP headers.
+		if err := cc.checkTrailerBytes(response.Header); err != nil {
+			return err
+		}
+	}
 	if err := grpcValidateResponse(
 		response,
 		cc.responseHeader,
@@ -427,11 +501,31 @@ func (cc *grpcClientConn) validateResponse(response *http.Response) *Error {
 	); err != nil {
 		return err
 	}
+	cc.trailersOnly = getHeaderCanonical(response.Header, grpcHeaderStatus) != ""
 	compression := getHeaderCanonical(response.Header, grpcHeaderCompression)
 	cc.unmarshaler.envelopeReader.compressionPool = cc.compressionPools.Get(compression)
 	return nil
 }
 
+// checkTrailerBytes returns an error if the trailers exceed the configured
+// limit. We don't keep oversized trailers, but the error reports the server's
+// status if we can find it.
+func (cc *grpcClientConn) checkTrailerBytes(trailers http.Header) *Error {
+	size := headerBytes(trailers)
+	if cc.maxTrailerBytes <= 0 || size <= cc.maxTrailerBytes {
+		return nil
+	}
+	status := "ok"
+	if serverErr := grpcErrorFromTrailer(cc.bufferPool, cc.protobuf, trailers); serverErr != nil {
+		status = serverErr.Code().String()
+	}
+	return errorf(
+		CodeResourceExhausted,
+		"response trailers are %d bytes, exceeding the %d byte limit (server status: %s)",
+		size, cc.maxTrailerBytes, status,
+	)
+}
+
 type grpcHandlerConn struct {
 	spec            Spec
 	peer            Peer
@@ -457,7 +551,7 @@ func (hc *grpcHandlerConn) Peer() Peer {
 
 func (hc *grpcHandlerConn) Receive(msg any) error {
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
-		return err // already coded
+		return wrapIfClientGone(hc.request.Context(), err) // already coded
 	}
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
@@ -478,6 +572,16 @@ func (hc *grpcHandlerConn) Send(msg any) error {
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
+func (hc *grpcHandlerConn) disableResponseCompression() bool {
+	// As in the Connect streaming protocol, each envelope says whether its
+	// message is compressed.
+	hc.marshaler.compressionPool = nil
+	if !hc.wroteToBody {
+		delete(hc.responseWriter.Header(), grpcHeaderCompression)
+	}
+	return true
+}
+
 func (hc *grpcHandlerConn) ResponseHeader() http.Header {
 	return hc.responseHeader
 }
@@ -582,7 +686,14 @@ type grpcMarshaler struct {
 func (m *grpcMarshaler) MarshalWebTrailers(trailer http.Header) *Error {
 	raw := m.envelopeWriter.bufferPool.Get()
 	defer m.envelopeWriter.bufferPool.Put(raw)
-	if err := trailer.Write(raw); err != nil {
+	// The gRPC-Web specification requires lower-case trailer names, and some
+	// browser clients look up "grpc-status" verbatim.
+	lowercased := make(http.Header, len(trailer))
+	for key, values := range trailer {
+		lower := strings.ToLower(key)
+		lowercased[lower] = append(lowercased[lower], values...)
+	}
+	if err := lowercased.Write(raw); err != nil {
 		return errorf(CodeInternal, "format trailers: %w", err)
 	}
 	return m.Write(&envelope{
@@ -642,7 +753,11 @@ func grpcValidateResponse(
 	protobuf Codec,
 ) *Error {
 	if response.StatusCode != http.StatusOK {
-		return errorf(grpcHTTPToCode(response.StatusCode), "HTTP status %v", response.Status)
+		return httpStatusError(
+			grpcHTTPToCode(response.StatusCode),
+			"HTTP status "+response.Status,
+			readBodySnippet(response.Body),
+		)
 	}
 	if compression := getHeaderCanonical(response.Header, grpcHeaderCompression); compression != "" &&
 		compression != compressionIdentity &&
@@ -657,24 +772,24 @@ func grpcValidateResponse(
 			availableCompressors.CommaSeparatedNames(),
 		)
 	}
-	// When there's no body, gRPC and gRPC-Web servers may send error information
-	// in the HTTP headers.
-	if err := grpcErrorFromTrailer(
-		bufferPool,
-		protobuf,
-		response.Header,
-	); err != nil && !errors.Is(err, errTrailersWithoutGRPCStatus) {
-		// Per the specification, only the HTTP status code and Content-Type should
-		// be treated as headers. The rest should be treated as trailing metadata.
+	if getHeaderCanonical(response.Header, grpcHeaderStatus) != "" {
+		// When there's no body, gRPC and gRPC-Web servers may send a
+		// "trailers-only" response, which puts the status and trailing metadata in
+		// the HTTP headers. grpc-go does this for many errors, but it's also valid
+		// for successful streaming responses with no messages. Per the
+		// specification, only the HTTP status code and Content-Type should be
+		// treated as headers. The rest should be treated as trailing metadata.
 		if contentType := getHeaderCanonical(response.Header, headerContentType); contentType != "" {
 			setHeaderCanonical(header, headerContentType, contentType)
 		}
 		mergeHeaders(trailer, response.Header)
 		delHeaderCanonical(trailer, headerContentType)
-		// Also set the error metadata
-		err.meta = header.Clone()
-		mergeHeaders(err.meta, trailer)
-		return err
+		if err := grpcErrorFromTrailer(bufferPool, protobuf, trailer); err != nil {
+			err.meta = header.Clone()
+			mergeHeaders(err.meta, trailer)
+			return err
+		}
+		return nil
 	}
 	// The response is valid, so we should expose the headers.
 	mergeHeaders(header, response.Header)
@@ -850,9 +965,13 @@ func grpcStatusFromError(err error) *statusv1.Status {
 // It's a variant of URL-encoding with fewer reserved characters. It's intended
 // to take UTF-8 encoded text and escape non-ASCII bytes so that they're valid
 // HTTP/1 headers, while still maximizing readability of the data on the wire.
+// Multi-byte characters are escaped one byte at a time, so clients can decode
+// the message byte-by-byte and recover the original UTF-8.
 //
 // The grpc-message trailer (used for human-readable error messages) should be
-// percent-encoded.
+// percent-encoded. Because proxies and clients limit the size of headers,
+// encoded messages are truncated to grpcMaxMessageBytes. Truncation never
+// splits a character or escape sequence.
 //
 // References:
 //
@@ -862,30 +981,57 @@ func grpcPercentEncode(bufferPool *bufferPool, msg string) string {
 	for i := 0; i < len(msg); i++ {
 		// Characters that need to be escaped are defined in gRPC's HTTP/2 spec.
 		// They're different from the generic set defined in RFC 3986.
-		if c := msg[i]; c < ' ' || c > '~' || c == '%' {
+		if c := msg[i]; grpcShouldEscape(c) {
 			return grpcPercentEncodeSlow(bufferPool, msg, i)
 		}
 	}
+	if len(msg) > grpcMaxMessageBytes {
+		// The message is entirely ASCII, so any byte is a character boundary.
+		return msg[:grpcMaxMessageBytes]
+	}
 	return msg
 }
 
 // msg needs some percent-escaping. Bytes before offset don't require
 // percent-encoding, so they can be copied to the output as-is.
 func grpcPercentEncodeSlow(bufferPool *bufferPool, msg string, offset int) string {
+	if offset > grpcMaxMessageBytes {
+		return msg[:grpcMaxMessageBytes]
+	}
 	out := bufferPool.Get()
 	defer bufferPool.Put(out)
 	out.WriteString(msg[:offset])
-	for i := offset; i < len(msg); i++ {
-		c := msg[i]
-		if c < ' ' || c > '~' || c == '%' {
-			out.WriteString(fmt.Sprintf("%%%02X", c))
-			continue
+	for i := offset; i < len(msg); {
+		// Encode a whole character at a time, so that truncation can't leave
+		// a partial character behind. Invalid UTF-8 has a width of one byte.
+		_, width := utf8.DecodeRuneInString(msg[i:])
+		encodedWidth := 0
+		for _, c := range []byte(msg[i : i+width]) {
+			if grpcShouldEscape(c) {
+				encodedWidth += 3
+			} else {
+				encodedWidth++
+			}
+		}
+		if out.Len()+encodedWidth > grpcMaxMessageBytes {
+			break
 		}
-		out.WriteByte(c)
+		for _, c := range []byte(msg[i : i+width]) {
+			if grpcShouldEscape(c) {
+				out.WriteString(fmt.Sprintf("%%%02X", c))
+				continue
+			}
+			out.WriteByte(c)
+		}
+		i += width
 	}
 	return out.String()
 }
 
+func grpcShouldEscape(c byte) bool {
+	return c < ' ' || c > '~' || c == '%'
+}
+
 func grpcPercentDecode(bufferPool *bufferPool, encoded string) string {
 	for i := 0; i < len(encoded); i++ {
 		if c := encoded[i]; c == '%' && i+2 < len(encoded) {
@@ -909,10 +1055,12 @@ func grpcPercentDecodeSlow(bufferPool *bufferPool, encoded string, offset int) s
 		}
 		parsed, err := strconv.ParseUint(encoded[i+1:i+3], 16 /* hex */, 8 /* bitsize */)
 		if err != nil {
-			out.WriteRune(utf8.RuneError)
-		} else {
-			out.WriteByte(byte(parsed))
+			// The gRPC spec asks decoders to be lenient, so pass invalid escape
+			// sequences through unchanged.
+			out.WriteByte(c)
+			continue
 		}
+		out.WriteByte(byte(parsed))
 		i += 2
 	}
 	return out.String()
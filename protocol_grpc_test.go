@@ -15,6 +15,9 @@
 package connect
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"math"
 	"net/http"
@@ -27,6 +30,7 @@ import (
 
 	"github.com/bufbuild/connect-go/internal/assert"
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestGRPCHandlerSender(t *testing.T) {
@@ -173,4 +177,107 @@ func TestGRPCPercentEncoding(t *testing.T) {
 	roundtrip("foo bar")
 	roundtrip(`foo%bar`)
 	roundtrip("fiancée")
+	roundtrip("emoji 🔥🎉 mixed")
+	roundtrip("日本語のエラーメッセージ")
+	roundtrip("tab\tand\nnewline")
+	assert.Equal(t, grpcPercentEncode(pool, "é"), "%C3%A9")
+	// Decoding is lenient: invalid escape sequences pass through unchanged.
+	assert.Equal(t, grpcPercentDecode(pool, "100%zz done"), "100%zz done")
+	assert.Equal(t, grpcPercentDecode(pool, "%ZZ"), "%ZZ")
+	assert.Equal(t, grpcPercentDecode(pool, "%"), "%")
+	assert.Equal(t, grpcPercentDecode(pool, "50%"), "50%")
+	assert.Equal(t, grpcPercentDecode(pool, "trailing %4"), "trailing %4")
+	assert.Equal(t, grpcPercentDecode(pool, "%+1%-1"), "%+1%-1")
+	assert.Equal(t, grpcPercentDecode(pool, "%%41"), "%A")
+}
+
+func TestGRPCErrorFromMalformedMessage(t *testing.T) {
+	t.Parallel()
+	// A malformed Grpc-Message shouldn't prevent the client from receiving the
+	// status code.
+	trailer := make(http.Header)
+	trailer.Set(grpcHeaderStatus, "5")
+	trailer.Set(grpcHeaderMessage, "50% done, %ZZ%C3%A9%")
+	err := grpcErrorFromTrailer(newBufferPool(), &protoBinaryCodec{}, trailer)
+	assert.NotNil(t, err)
+	assert.Equal(t, err.Code(), CodeNotFound)
+	assert.Equal(t, err.Message(), "50% done, %ZZé%")
+}
+
+func TestGRPCPercentEncodingTruncation(t *testing.T) {
+	t.Parallel()
+	pool := newBufferPool()
+	ascii := strings.Repeat("a", grpcMaxMessageBytes+10)
+	assert.Equal(t, grpcPercentEncode(pool, ascii), ascii[:grpcMaxMessageBytes])
+
+	// Each "🔥" is four bytes, encoded as twelve. Truncation must not split
+	// either the character or its escape sequences.
+	emoji := "x" + strings.Repeat("🔥", grpcMaxMessageBytes)
+	encoded := grpcPercentEncode(pool, emoji)
+	assert.True(t, len(encoded) <= grpcMaxMessageBytes)
+	assert.Equal(t, (len(encoded)-1)%12, 0)
+	decoded := grpcPercentDecode(pool, encoded)
+	assert.True(t, utf8.ValidString(decoded))
+	assert.True(t, strings.HasPrefix(emoji, decoded))
+}
+
+func TestGRPCWebTrailersFrame(t *testing.T) {
+	t.Parallel()
+	const procedure = "/connect.ping.v1.PingService/CountUp"
+	handler := NewServerStreamHandler(
+		procedure,
+		func(_ context.Context, _ *Request[emptypb.Empty], stream *ServerStream[emptypb.Empty]) error {
+			stream.ResponseTrailer().Add("X-Count", "1")
+			stream.ResponseTrailer().Add("X-Count", "2")
+			if err := stream.Send(&emptypb.Empty{}); err != nil {
+				return err
+			}
+			return NewError(CodeNotFound, errors.New("no more"))
+		},
+	)
+
+	// Browsers can't read HTTP trailers, so the status and trailers are the
+	// last length-prefixed frame of the body, flagged with 0x80.
+	body := []byte{0, 0, 0, 0, 0}
+	request := httptest.NewRequest(http.MethodPost, procedure, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/grpc-web+proto")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	assert.Zero(t, recorder.Header().Get("X-Count"))
+	var frames [][]byte
+	var flags []byte
+	rest := recorder.Body.Bytes()
+	for len(rest) >= 5 {
+		size := int(binary.BigEndian.Uint32(rest[1:5]))
+		assert.True(t, len(rest) >= 5+size, assert.Sprintf("frame of %d bytes is truncated", size))
+		flags = append(flags, rest[0])
+		frames = append(frames, rest[5:5+size])
+		rest = rest[5+size:]
+	}
+	assert.Zero(t, len(rest))
+	assert.Equal(t, len(frames), 2)
+	assert.Equal(t, flags[0], byte(0))
+	assert.Equal(t, flags[1], grpcFlagEnvelopeTrailer)
+	// Trailers are an HTTP/1 header block with lower-case names and no
+	// terminating blank line.
+	lines := strings.Split(strings.TrimSuffix(string(frames[1]), "\r\n"), "\r\n")
+	assert.Equal(t, len(lines), 5, assert.Sprintf("trailers: %q", lines))
+	assert.True(t, containsString(lines, "grpc-status: 5"), assert.Sprintf("trailers: %q", lines))
+	assert.True(t, containsString(lines, "grpc-message: no more"), assert.Sprintf("trailers: %q", lines))
+	assert.True(t, containsString(lines, "grpc-status-details-bin: CAUSB25vIG1vcmU"), assert.Sprintf("trailers: %q", lines))
+	assert.True(t, containsString(lines, "x-count: 1"), assert.Sprintf("trailers: %q", lines))
+	assert.True(t, containsString(lines, "x-count: 2"), assert.Sprintf("trailers: %q", lines))
+
+	// Clients read the frame back into trailers and the final status.
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewClient[emptypb.Empty, emptypb.Empty](server.Client(), server.URL+procedure, WithGRPCWeb())
+	stream, err := client.CallServerStream(context.Background(), NewRequest(&emptypb.Empty{}))
+	assert.Nil(t, err)
+	assert.True(t, stream.Receive())
+	assert.False(t, stream.Receive())
+	assert.Equal(t, CodeOf(stream.Err()), CodeNotFound)
+	assert.Equal(t, stream.ResponseTrailer().Values("X-Count"), []string{"1", "2"})
+	assert.Nil(t, stream.Close())
 }
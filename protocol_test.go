@@ -15,6 +15,8 @@
 package connect
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/bufbuild/connect-go/internal/assert"
@@ -63,3 +65,25 @@ func BenchmarkCanonicalizeContentType(b *testing.B) {
 		b.ReportAllocs()
 	})
 }
+
+func TestErrorWriterSupportsHandlerProtocols(t *testing.T) {
+	t.Parallel()
+	config := newHandlerConfig("/acme.foo.v1.FooService/Bar", nil)
+	writer := NewErrorWriter()
+	var protocols int
+	for _, streamType := range []StreamType{StreamTypeUnary, StreamTypeClient, StreamTypeServer, StreamTypeBidi} {
+		handlers := config.newProtocolHandlers(streamType)
+		protocols = len(handlers)
+		for _, handler := range handlers {
+			for contentType := range handler.ContentTypes() {
+				request := httptest.NewRequest(http.MethodPost, "/", nil)
+				request.Header.Set(headerContentType, contentType)
+				assert.True(t, writer.IsSupported(request), assert.Sprintf("%s", contentType))
+				recorder := httptest.NewRecorder()
+				assert.Nil(t, writer.Write(recorder, request, NewError(CodeUnavailable, nil)))
+				assert.NotZero(t, recorder.Header().Get(headerContentType))
+			}
+		}
+	}
+	assert.Equal(t, protocols, len(handlerProtocols))
+}
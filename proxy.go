@@ -0,0 +1,184 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ForwardDecoded proxies a streaming RPC from a handler to an upstream server
+// by decoding and re-encoding every message. It copies request headers and
+// messages from the handler's connection to the client's connection, and
+// copies response headers, messages, and trailers back. Protocol-specific
+// headers (like Content-Type and anything beginning with "Connect-" or
+// "Grpc-") aren't copied, since each side negotiates its own protocol, codec,
+// and compression.
+//
+// Because each message is unmarshaled from the downstream codec and marshaled
+// again with the upstream codec (and vice versa), the two sides may use
+// different protocols, codecs, and compression, and the proxy can inspect
+// messages. The price is the CPU and allocations of a full decode and encode
+// per message: ForwardDecoded isn't a byte-for-byte passthrough, and fields
+// the proxy's message types don't know about only survive when both sides use
+// the binary Protobuf codec.
+//
+// There's no byte-for-byte mode: handler connections always decode messages
+// with the codec negotiated with the client. Proxies that don't need to
+// inspect messages or translate protocols can forward raw HTTP requests with
+// [net/http/httputil.ReverseProxy] instead, since all three protocols are
+// plain HTTP.
+//
+// The newRequest and newResponse functions construct empty messages to
+// receive into. When proxying without generated code, construct them with
+// dynamicpb and the method descriptor, as in [NewDynamicHandler].
+//
+// ForwardDecoded returns when the upstream response ends. If the upstream
+// server returns an error, ForwardDecoded returns it with the same code,
+// message, details, and application metadata, so handlers can return it
+// directly and clients see the original error. If the downstream client is
+// still sending, ForwardDecoded closes the upstream request and stops reading
+// the downstream request, discarding any remaining messages, and waits until
+// it has stopped using both connections. To do that, ctx must be the context
+// passed to the handler's implementation: with any other context,
+// ForwardDecoded waits for the downstream client to finish sending.
+//
+// To cancel the upstream RPC when the downstream client goes away, create the
+// client connection with the handler's context. ForwardDecoded sends and
+// receives concurrently, so the handler connection must support the same
+// concurrent use as a bidirectional stream. Both connections must have the
+// same stream type.
+func ForwardDecoded(
+	ctx context.Context,
+	handler StreamingHandlerConn,
+	client StreamingClientConn,
+	newRequest, newResponse func() any,
+) error {
+	mergeNonProtocolHeaders(client.RequestHeader(), handler.RequestHeader())
+	requestsDone := make(chan error, 1)
+	go func() {
+		requestsDone <- forwardRequests(handler, client, newRequest)
+	}()
+	responseErr := forwardResponses(handler, client, newResponse)
+	var requestErr error
+	select {
+	case requestErr = <-requestsDone:
+	default:
+		// The upstream response ended before the downstream client stopped
+		// sending. Closing the upstream request unblocks Send, and closing the
+		// downstream request body unblocks Receive. Either way, the goroutine
+		// must stop before we return: the handler's request body can't be read
+		// after the handler returns.
+		_ = client.CloseRequest()
+		if call, ok := handlerCallFromContext(ctx); ok {
+			_ = call.requestBody.Close()
+		}
+		<-requestsDone // errors are expected, since we closed the streams
+	}
+	_ = client.CloseResponse()
+	if responseErr != nil {
+		return responseErr
+	}
+	return requestErr
+}
+
+func forwardRequests(handler StreamingHandlerConn, client StreamingClientConn, newRequest func() any) error {
+	for {
+		msg := newRequest()
+		if err := handler.Receive(msg); err != nil {
+			closeErr := client.CloseRequest()
+			if errors.Is(err, io.EOF) {
+				return closeErr
+			}
+			return err
+		}
+		if err := client.Send(msg); err != nil {
+			_ = client.CloseRequest()
+			if errors.Is(err, io.EOF) {
+				// The upstream server has responded, and the error (if any) is
+				// available from Receive.
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func forwardResponses(handler StreamingHandlerConn, client StreamingClientConn, newResponse func() any) error {
+	var copiedHeader bool
+	copyHeader := func() {
+		if !copiedHeader {
+			mergeNonProtocolHeaders(handler.ResponseHeader(), client.ResponseHeader())
+			copiedHeader = true
+		}
+	}
+	for {
+		msg := newResponse()
+		if err := client.Receive(msg); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return forwardedError(err)
+			}
+			copyHeader()
+			mergeNonProtocolHeaders(handler.ResponseTrailer(), client.ResponseTrailer())
+			return nil
+		}
+		copyHeader()
+		if err := handler.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// forwardedError strips protocol headers from an upstream error's metadata, so
+// that handlers can return it without confusing downstream clients. The
+// error's metadata already includes the upstream response headers and
+// trailers.
+func forwardedError(err error) error {
+	connectErr, ok := asError(err)
+	if !ok {
+		return err
+	}
+	forwarded := *connectErr
+	forwarded.meta = make(http.Header, len(connectErr.meta))
+	mergeNonProtocolHeaders(forwarded.meta, connectErr.meta)
+	return &forwarded
+}
+
+// mergeNonProtocolHeaders copies application-defined headers, skipping those
+// that describe the protocol, codec, compression, or HTTP connection.
+func mergeNonProtocolHeaders(into, from http.Header) {
+	for key, values := range from {
+		if isProtocolHeader(key) {
+			continue
+		}
+		into[key] = append(into[key], values...)
+	}
+}
+
+func isProtocolHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case headerContentType, headerUserAgent, headerTrailer,
+		"Content-Length", "Content-Encoding", "Accept-Encoding",
+		"Connection", "Keep-Alive", "Te", "Transfer-Encoding", "Upgrade", "Date":
+		return true
+	}
+	lower := strings.ToLower(key)
+	return strings.HasPrefix(lower, "connect-") ||
+		strings.HasPrefix(lower, "grpc-") ||
+		strings.HasPrefix(lower, "trailer-")
+}
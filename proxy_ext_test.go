@@ -0,0 +1,162 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestForwardDecoded(t *testing.T) {
+	t.Parallel()
+	const cumSumProcedure = "/" + pingv1connect.PingServiceName + "/CumSum"
+	var leakedReceive int32
+	upstreamMux := http.NewServeMux()
+	upstreamMux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			stream.ResponseHeader().Set("X-Echo", stream.RequestHeader().Get("X-Test"))
+			var sum int64
+			for {
+				request, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					stream.ResponseTrailer().Set("X-Total", "done")
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if request.Number < 0 {
+					connectErr := connect.NewError(connect.CodeInvalidArgument, errors.New("negative number"))
+					connectErr.Meta().Set("X-Bad-Number", "true")
+					return connectErr
+				}
+				sum += request.Number
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	}))
+	upstream := httptest.NewUnstartedServer(upstreamMux)
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	t.Cleanup(upstream.Close)
+
+	// The proxy speaks gRPC to the upstream server, regardless of the protocol
+	// used by its own clients.
+	upstreamClient := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+		upstream.Client(),
+		upstream.URL+cumSumProcedure,
+		connect.WithGRPC(),
+	)
+	method := pingv1.File_connect_ping_v1_ping_proto.Services().ByName("PingService").Methods().ByName("CumSum")
+	proxyMux := http.NewServeMux()
+	proxyMux.Handle(cumSumProcedure, connect.NewDynamicHandler(
+		method,
+		func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+			clientConn, err := upstreamClient.CallBidiStream(ctx).Conn()
+			if err != nil {
+				return err
+			}
+			counting := &receiveCountingConn{StreamingHandlerConn: conn}
+			err = connect.ForwardDecoded(
+				ctx,
+				counting,
+				clientConn,
+				func() any { return &pingv1.CumSumRequest{} },
+				func() any { return &pingv1.CumSumResponse{} },
+			)
+			// The request body can't be read after the handler returns.
+			if atomic.LoadInt32(&counting.receiving) != 0 {
+				atomic.StoreInt32(&leakedReceive, 1)
+			}
+			return err
+		},
+	))
+	proxy := httptest.NewUnstartedServer(proxyMux)
+	proxy.EnableHTTP2 = true
+	proxy.StartTLS()
+	t.Cleanup(proxy.Close)
+
+	run := func(t *testing.T, opts ...connect.ClientOption) {
+		t.Helper()
+		client := pingv1connect.NewPingServiceClient(proxy.Client(), proxy.URL, opts...)
+		t.Run("success", func(t *testing.T) {
+			stream := client.CumSum(context.Background())
+			stream.RequestHeader().Set("X-Test", "forwarded")
+			for _, number := range []int64{1, 2, 3} {
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: number}))
+				response, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Equal(t, response.Sum, number*(number+1)/2)
+			}
+			assert.Nil(t, stream.CloseRequest())
+			_, err := stream.Receive()
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, stream.ResponseHeader().Get("X-Echo"), "forwarded")
+			assert.Equal(t, stream.ResponseTrailer().Get("X-Total"), "done")
+			assert.Nil(t, stream.CloseResponse())
+		})
+		t.Run("error", func(t *testing.T) {
+			stream := client.CumSum(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: -1}))
+			_, err := stream.Receive()
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeInvalidArgument)
+			assert.Equal(t, connectErr.Message(), "negative number")
+			assert.Equal(t, connectErr.Meta().Get("X-Bad-Number"), "true")
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+		})
+	}
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		run(t)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPC())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		run(t, connect.WithGRPCWeb())
+	})
+	t.Cleanup(func() {
+		assert.Zero(t, atomic.LoadInt32(&leakedReceive))
+	})
+}
+
+// receiveCountingConn counts calls to Receive that haven't returned yet.
+type receiveCountingConn struct {
+	connect.StreamingHandlerConn
+
+	receiving int32
+}
+
+func (c *receiveCountingConn) Receive(msg any) error {
+	atomic.AddInt32(&c.receiving, 1)
+	defer atomic.AddInt32(&c.receiving, -1)
+	return c.StreamingHandlerConn.Receive(msg)
+}
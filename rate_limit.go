@@ -0,0 +1,137 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"time"
+)
+
+// A MessageRateLimit describes the limit enforced by the interceptor returned
+// from [NewMessageRateLimitInterceptor].
+type MessageRateLimit struct {
+	// Rate is the sustained number of messages per second that each stream may
+	// receive. If it's zero or negative, messages aren't limited.
+	Rate float64
+	// Burst is the number of messages a stream may receive in quick succession
+	// before the sustained rate applies. If it's less than 1, it's treated as
+	// 1.
+	Burst int
+	// Wait makes the interceptor delay messages that exceed the limit until the
+	// stream is allowed to receive them, rather than failing the RPC with
+	// CodeResourceExhausted. Delays end early if the context is done.
+	Wait bool
+}
+
+// NewMessageRateLimitInterceptor returns a handler interceptor that limits
+// the rate at which each streaming RPC receives messages from the client,
+// protecting CPU-bound handlers from chatty clients. Each stream gets its own
+// token bucket, which starts full: a stream may receive Burst messages at
+// once, and then Rate messages per second.
+//
+// Only messages received by handlers are limited. Messages sent by handlers,
+// unary RPCs, and clients are unaffected.
+func NewMessageRateLimitInterceptor(limit MessageRateLimit) Interceptor {
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &messageRateLimitInterceptor{
+		rate:  limit.Rate,
+		burst: float64(burst),
+		wait:  limit.Wait,
+	}
+}
+
+type messageRateLimitInterceptor struct {
+	rate  float64
+	burst float64
+	wait  bool
+}
+
+func (i *messageRateLimitInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return next
+}
+
+func (i *messageRateLimitInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *messageRateLimitInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	if i.rate <= 0 {
+		return next
+	}
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return next(ctx, &messageRateLimitedHandlerConn{
+			StreamingHandlerConn: conn,
+			ctx:                  ctx,
+			interceptor:          i,
+			tokens:               i.burst,
+			last:                 time.Now(),
+		})
+	}
+}
+
+// messageRateLimitedHandlerConn takes a token from the stream's bucket for
+// each received message. Receive isn't called concurrently, so the bucket
+// doesn't need a lock.
+type messageRateLimitedHandlerConn struct {
+	StreamingHandlerConn
+
+	ctx         context.Context
+	interceptor *messageRateLimitInterceptor
+	tokens      float64
+	last        time.Time
+}
+
+func (c *messageRateLimitedHandlerConn) Receive(msg any) error {
+	if err := c.StreamingHandlerConn.Receive(msg); err != nil {
+		return err
+	}
+	return c.take()
+}
+
+func (c *messageRateLimitedHandlerConn) take() error {
+	now := time.Now()
+	c.tokens += now.Sub(c.last).Seconds() * c.interceptor.rate
+	if c.tokens > c.interceptor.burst {
+		c.tokens = c.interceptor.burst
+	}
+	c.last = now
+	if c.tokens >= 1 {
+		c.tokens--
+		return nil
+	}
+	if !c.interceptor.wait {
+		return errorf(
+			CodeResourceExhausted,
+			"%s: client exceeded %v messages per second",
+			c.Spec().Procedure,
+			c.interceptor.rate,
+		)
+	}
+	delay := time.Duration((1 - c.tokens) / c.interceptor.rate * float64(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.ctx.Done():
+		return wrapIfContextError(c.ctx.Err())
+	}
+	// The token that accrued while we waited is spent on this message.
+	c.tokens = 0
+	c.last = now.Add(delay)
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestMessageRateLimitInterceptor(t *testing.T) {
+	t.Parallel()
+	newClient := func(t *testing.T, limit connect.MessageRateLimit) pingv1connect.PingServiceClient {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			&pluggablePingServer{
+				sum: func(_ context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+					var sum int64
+					for stream.Receive() {
+						sum += stream.Msg().Number
+					}
+					if err := stream.Err(); err != nil {
+						return nil, err
+					}
+					return connect.NewResponse(&pingv1.SumResponse{Sum: sum}), nil
+				},
+			},
+			connect.WithInterceptors(connect.NewMessageRateLimitInterceptor(limit)),
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	}
+	sendBurst := func(t *testing.T, client pingv1connect.PingServiceClient, count int) (*connect.Response[pingv1.SumResponse], error) {
+		t.Helper()
+		stream := client.Sum(context.Background())
+		for i := 0; i < count; i++ {
+			if err := stream.Send(&pingv1.SumRequest{Number: 1}); err != nil {
+				break
+			}
+		}
+		return stream.CloseAndReceive()
+	}
+
+	t.Run("within_burst", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t, connect.MessageRateLimit{Rate: 1, Burst: 5})
+		response, err := sendBurst(t, client, 5)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Sum, 5)
+	})
+	t.Run("reject", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t, connect.MessageRateLimit{Rate: 1, Burst: 5})
+		_, err := sendBurst(t, client, 20)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+	t.Run("wait", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t, connect.MessageRateLimit{Rate: 100, Burst: 1, Wait: true})
+		start := time.Now()
+		response, err := sendBurst(t, client, 6)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.Sum, 6)
+		// The first message uses the burst, and the rest arrive 10ms apart.
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	})
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			&pluggablePingServer{
+				ping: func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+					return connect.NewResponse(&pingv1.PingResponse{}), nil
+				},
+			},
+			connect.WithInterceptors(connect.NewMessageRateLimitInterceptor(connect.MessageRateLimit{Rate: 1})),
+		))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+		for i := 0; i < 3; i++ {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// WithRawRequestBody configures unary Handlers to buffer the request body
+// before unmarshaling it, so that interceptors and implementations can read
+// the exact bytes the client sent with [RawRequestBody]. It's intended for
+// verifying signatures (like webhook HMACs) computed over the request body.
+//
+// The buffered body is the HTTP request body as sent over the network: it's
+// still compressed if the client compressed it, and gRPC and gRPC-Web bodies
+// include the message envelope. Requests with bodies larger than maxBytes fail
+// with [CodeResourceExhausted]. Streaming handlers ignore this option, since
+// buffering would prevent them from processing messages as they arrive.
+func WithRawRequestBody(maxBytes int) HandlerOption {
+	return &rawRequestBodyOption{maxBytes: maxBytes}
+}
+
+// RawRequestBody returns the request body buffered by a Handler configured
+// with [WithRawRequestBody]. Call it from an interceptor or implementation
+// using the context passed to it. It reports false for contexts that didn't
+// come from such a Handler. Callers must not modify the returned bytes.
+func RawRequestBody(ctx context.Context) ([]byte, bool) {
+	call, ok := handlerCallFromContext(ctx)
+	if !ok || call.rawBody == nil {
+		return nil, false
+	}
+	return call.rawBody, true
+}
+
+type rawRequestBodyOption struct {
+	maxBytes int
+}
+
+func (o *rawRequestBodyOption) applyToHandler(config *handlerConfig) {
+	config.RawRequestBodyMaxBytes = o.maxBytes
+}
+
+// bufferRequestBody reads the request body (up to maxBytes) into memory and
+// replaces it with an in-memory reader, so the protocol can unmarshal the same
+// bytes.
+func bufferRequestBody(request *http.Request, maxBytes int) ([]byte, *Error) {
+	body, err := io.ReadAll(io.LimitReader(request.Body, int64(maxBytes)+1))
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		if connectErr, ok := asError(wrapIfContextError(err)); ok {
+			return nil, connectErr
+		}
+		return nil, errorf(CodeUnknown, "read request body: %w", err)
+	}
+	if len(body) > maxBytes {
+		return nil, errorf(CodeResourceExhausted, "request body is larger than configured max %d", maxBytes)
+	}
+	return body, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestRawRequestBody(t *testing.T) {
+	t.Parallel()
+	key := []byte("secret")
+	mac := func(body []byte) []byte {
+		hash := hmac.New(sha256.New, key)
+		_, _ = hash.Write(body)
+		return hash.Sum(nil)
+	}
+	sign := func(body string) string {
+		return hex.EncodeToString(mac([]byte(body)))
+	}
+	verify := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			body, ok := connect.RawRequestBody(ctx)
+			if !ok {
+				return nil, connect.NewError(connect.CodeInternal, errors.New("no raw body"))
+			}
+			signature, err := hex.DecodeString(request.Header().Get("Signature"))
+			if err != nil || !hmac.Equal(signature, mac(body)) {
+				return nil, connect.NewError(connect.CodeUnauthenticated, errors.New("invalid signature"))
+			}
+			return next(ctx, request)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.Number}), nil
+			},
+		},
+		connect.WithRawRequestBody(64),
+		connect.WithInterceptors(verify),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	post := func(t *testing.T, body, signature string) (int, string) {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL+"/"+pingv1connect.PingServiceName+"/Ping",
+			strings.NewReader(body),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Signature", signature)
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		var wire struct {
+			Code   string `json:"code"`
+			Number string `json:"number"`
+		}
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&wire))
+		if wire.Code != "" {
+			return response.StatusCode, wire.Code
+		}
+		return response.StatusCode, wire.Number
+	}
+
+	body := `{"number": 42}`
+	status, result := post(t, body, sign(body))
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, result, "42")
+
+	_, result = post(t, body, sign(`{"number": 43}`))
+	assert.Equal(t, result, connect.CodeUnauthenticated.String())
+
+	large := `{"text": "` + strings.Repeat("a", 64) + `"}`
+	_, result = post(t, large, sign(large))
+	assert.Equal(t, result, connect.CodeResourceExhausted.String())
+}
@@ -0,0 +1,78 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// A ReadinessGate rejects new RPCs while a server isn't ready to serve them,
+// for example while it's warming caches during startup or draining before a
+// rolling deploy replaces it. It's an [Interceptor]: apply it to handlers with
+// [WithInterceptors]. While the gate is closed, handlers reject new RPCs with
+// CodeUnavailable, which clients and load balancers treat as retryable. RPCs
+// already in progress are unaffected.
+//
+// Health checks should report the same state, so that load balancers stop
+// routing traffic to the server at the same time as it starts rejecting RPCs.
+// Have the health checker consult Ready, and don't apply the gate to the
+// health check handler itself.
+//
+// The gate has no effect on clients. It's safe to use concurrently.
+type ReadinessGate struct {
+	notReady atomic.Bool
+}
+
+// NewReadinessGate constructs a ReadinessGate. New gates are open: the server
+// is ready.
+func NewReadinessGate() *ReadinessGate {
+	return &ReadinessGate{}
+}
+
+// SetReady opens or closes the gate.
+func (g *ReadinessGate) SetReady(ready bool) {
+	g.notReady.Store(!ready)
+}
+
+// Ready reports whether the gate is open.
+func (g *ReadinessGate) Ready() bool {
+	return !g.notReady.Load()
+}
+
+// WrapUnary implements [Interceptor].
+func (g *ReadinessGate) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if !request.Spec().IsClient && !g.Ready() {
+			return nil, errorf(CodeUnavailable, "server isn't ready: retry %s later", request.Spec().Procedure)
+		}
+		return next(ctx, request)
+	}
+}
+
+// WrapStreamingClient implements [Interceptor] with a no-op.
+func (g *ReadinessGate) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements [Interceptor].
+func (g *ReadinessGate) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		if !g.Ready() {
+			return errorf(CodeUnavailable, "server isn't ready: retry %s later", conn.Spec().Procedure)
+		}
+		return next(ctx, conn)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// IsRetryable reports whether a client may safely retry an RPC that failed
+// with the supplied error. Retry interceptors should use it (perhaps combined
+// with their own rules) to decide whether to try again.
+//
+// Any RPC may be retried if the server certainly didn't process it: see
+// [IsUnprocessed]. Otherwise, only idempotent RPCs may be retried, and only if
+// the failure is likely to be temporary: the server returned CodeUnavailable,
+// or the connection failed partway through the RPC (for example, because it
+// was reset or timed out). Errors caused by the caller's context being
+// canceled or timing out are never retryable, nor are other errors returned
+// by the server.
+func IsRetryable(err error, idempotent bool) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if IsUnprocessed(err) {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+	if IsWireError(err) {
+		return CodeOf(err) == CodeUnavailable
+	}
+	// The RPC failed in the transport, possibly after the server started
+	// processing it.
+	return CodeOf(err) == CodeUnavailable || isConnectionError(err)
+}
+
+// IsUnprocessed reports whether an RPC failed before the server could have
+// started processing it, so that it's safe to retry even if it isn't
+// idempotent. This is the case when the client couldn't connect to the
+// server, when the server refused the HTTP/2 stream (REFUSED_STREAM), and when
+// the server began a graceful shutdown (GOAWAY) before receiving the request.
+//
+// Errors returned by the server and failures after the request may have been
+// received (like a GOAWAY that includes the request's stream, or a reset
+// connection) aren't unprocessed.
+func IsUnprocessed(err error) bool {
+	if err == nil || IsWireError(err) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	// As in wrapIfRSTError, the HTTP/2 errors aren't exported from net/http, so
+	// we're left matching strings. Streams with IDs higher than the one in a
+	// GOAWAY frame were never processed; net/http reports them as a graceful
+	// shutdown, while streams the server may have processed are reported as
+	// "server sent GOAWAY and closed the connection".
+	msg := err.Error()
+	return strings.Contains(msg, "; REFUSED_STREAM; received from peer") ||
+		strings.Contains(msg, "http2: Transport received Server's graceful shutdown GOAWAY")
+}
+
+// isConnectionError reports whether the error is from a broken connection.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		strings.Contains(err.Error(), "http2: server sent GOAWAY and closed the connection")
+}
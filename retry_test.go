@@ -0,0 +1,114 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/bufbuild/connect-go/internal/assert"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		err         error
+		unprocessed bool
+		idempotent  bool // retryable if idempotent
+	}{
+		{name: "nil"},
+		{
+			name:        "dial",
+			err:         NewError(CodeUnavailable, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}),
+			unprocessed: true,
+			idempotent:  true,
+		},
+		{
+			name:        "refused_stream",
+			err:         wrapIfRSTError(errors.New("stream error: stream ID 3; REFUSED_STREAM; received from peer")),
+			unprocessed: true,
+			idempotent:  true,
+		},
+		{
+			name:        "goaway_before_request",
+			err:         NewError(CodeUnavailable, errors.New(`Post "https://example.com": http2: Transport received Server's graceful shutdown GOAWAY`)),
+			unprocessed: true,
+			idempotent:  true,
+		},
+		{
+			name:       "goaway_after_request",
+			err:        NewError(CodeUnknown, errors.New(`http2: server sent GOAWAY and closed the connection; LastStreamID=3, ErrCode=NO_ERROR, debug=""`)),
+			idempotent: true,
+		},
+		{
+			name:       "connection_reset",
+			err:        NewError(CodeUnknown, fmt.Errorf("read: %w", syscall.ECONNRESET)),
+			idempotent: true,
+		},
+		{
+			name:       "server_unavailable",
+			err:        NewWireError(CodeUnavailable, errors.New("overloaded")),
+			idempotent: true,
+		},
+		{
+			name: "server_internal",
+			err:  NewWireError(CodeInternal, errors.New("oops")),
+		},
+		{
+			name: "server_refused_stream_text",
+			err:  NewWireError(CodeUnavailable, errors.New("stream error: stream ID 3; REFUSED_STREAM; received from peer")),
+			// Wire errors aren't transport failures, regardless of their text.
+			idempotent: true,
+		},
+		{
+			name: "canceled",
+			err:  wrapIfContextError(context.Canceled),
+		},
+		{
+			name: "deadline_exceeded",
+			err:  NewError(CodeDeadlineExceeded, fmt.Errorf("read: %w", context.DeadlineExceeded)),
+		},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, IsUnprocessed(testCase.err), testCase.unprocessed)
+			assert.Equal(t, IsRetryable(testCase.err, false), testCase.unprocessed)
+			assert.Equal(t, IsRetryable(testCase.err, true), testCase.idempotent)
+		})
+	}
+}
+
+func TestIsUnprocessedConnectionRefused(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	client := NewClient[emptypb.Empty, emptypb.Empty](http.DefaultClient, url+"/acme.v1.Service/Method")
+	_, err := client.CallUnary(context.Background(), NewRequest(&emptypb.Empty{}))
+	assert.NotNil(t, err)
+	assert.Equal(t, CodeOf(err), CodeUnavailable)
+	assert.True(t, IsUnprocessed(err))
+	assert.True(t, IsRetryable(err, false))
+}
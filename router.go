@@ -0,0 +1,117 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A Router maps a fully-qualified Protobuf service name (for example,
+// "acme.user.v1.UserService") and a method name to the URL path that serves
+// the RPC. By default, RPCs are served from "/" + service + "/" + method.
+// Routers enable versioned or vanity paths, like "/v2/users/GetUser", and let
+// multiple versions of a service coexist on one server.
+//
+// Handlers find the method from the last segment of the request path, so the
+// paths a Router returns must end with "/" followed by the method name. They
+// must also be unique: no two RPCs may share a path.
+type Router func(service, method string) string
+
+// WithRouter configures a client to send RPCs to the paths chosen by the
+// router, appended to the client's base URL. Servers must mount handlers
+// with a [RouterHandler] using the same router. Procedure names, including
+// those in [Spec], don't change.
+func WithRouter(router Router) ClientOption {
+	return &routerOption{router: router}
+}
+
+// RouterHandler serves RPCs from the paths chosen by a [Router]. Mount the
+// paths and handlers returned from generated service constructors on it:
+//
+//	router := connect.NewRouterHandler(func(service, method string) string {
+//	  return "/v2/" + strings.ToLower(service) + "/" + method
+//	})
+//	router.Handle(pingv1connect.NewPingServiceHandler(&pingServer{}))
+//	mux.Handle("/v2/", router)
+//
+// Requests to paths that the router didn't choose get HTTP status 404 Not
+// Found. Clients must be configured with [WithRouter] and the same router.
+type RouterHandler struct {
+	router Router
+	// Services in the order they were mounted, with their handlers.
+	services []string
+	handlers map[string]http.Handler
+}
+
+// NewRouterHandler constructs a RouterHandler.
+func NewRouterHandler(router Router) *RouterHandler {
+	return &RouterHandler{
+		router:   router,
+		handlers: make(map[string]http.Handler),
+	}
+}
+
+// Handle mounts a service. The path must be the one returned from the
+// generated constructor, like "/acme.user.v1.UserService/". Handle isn't
+// safe to call concurrently with ServeHTTP, so mount all services before
+// serving.
+func (h *RouterHandler) Handle(path string, handler http.Handler) {
+	service := strings.Trim(path, "/")
+	if _, ok := h.handlers[service]; !ok {
+		h.services = append(h.services, service)
+	}
+	h.handlers[service] = handler
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *RouterHandler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	path := request.URL.Path
+	method := path[strings.LastIndexByte(path, '/')+1:]
+	if method == "" {
+		http.NotFound(responseWriter, request)
+		return
+	}
+	for _, service := range h.services {
+		if h.router(service, method) != path {
+			continue
+		}
+		// The generated handler dispatches on the default path.
+		routed := request.Clone(request.Context())
+		routed.URL.Path = "/" + service + "/" + method
+		routed.URL.RawPath = ""
+		h.handlers[service].ServeHTTP(responseWriter, routed)
+		return
+	}
+	http.NotFound(responseWriter, request)
+}
+
+type routerOption struct {
+	router Router
+}
+
+func (o *routerOption) applyToClient(config *clientConfig) {
+	config.Router = o.router
+}
+
+// routeURL replaces the default path of the procedure at the end of the URL
+// with the router's path.
+func routeURL(url, procedure string, router Router) string {
+	service, method, ok := strings.Cut(strings.TrimPrefix(procedure, "/"), "/")
+	if !ok {
+		return url
+	}
+	return strings.TrimSuffix(url, procedure) + router(service, method)
+}
@@ -0,0 +1,99 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+	versioned := func(version string) connect.Router {
+		return func(service, method string) string {
+			short := service[strings.LastIndexByte(service, '.')+1:]
+			return "/" + version + "/" + strings.ToLower(short) + "/" + method
+		}
+	}
+	newPingServer := func(version int64) *pluggablePingServer {
+		return &pluggablePingServer{
+			ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				// Procedures don't change.
+				assert.Equal(t, request.Spec().Procedure, "/"+pingv1connect.PingServiceName+"/Ping")
+				return connect.NewResponse(&pingv1.PingResponse{Number: version}), nil
+			},
+			countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				for i := int64(1); i <= request.Msg.Number; i++ {
+					if err := stream.Send(&pingv1.CountUpResponse{Number: version * i}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}
+	}
+	// Two versions of the service coexist on one server.
+	mux := http.NewServeMux()
+	v1 := connect.NewRouterHandler(versioned("v1"))
+	v1.Handle(pingv1connect.NewPingServiceHandler(newPingServer(1)))
+	mux.Handle("/v1/", v1)
+	v2 := connect.NewRouterHandler(versioned("v2"))
+	v2.Handle(pingv1connect.NewPingServiceHandler(newPingServer(2)))
+	mux.Handle("/v2/", v2)
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	for _, opt := range []connect.ClientOption{connect.WithProtoJSON(), connect.WithGRPC()} {
+		for _, version := range []int64{1, 2} {
+			router := versioned("v1")
+			if version == 2 {
+				router = versioned("v2")
+			}
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opt, connect.WithRouter(router))
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.Number, version)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+			assert.Nil(t, err)
+			var got []int64
+			for stream.Receive() {
+				got = append(got, stream.Msg().Number)
+			}
+			assert.Nil(t, stream.Err())
+			assert.Nil(t, stream.Close())
+			assert.Equal(t, got, []int64{version, 2 * version})
+		}
+	}
+
+	// The default paths aren't served, and neither are paths the router
+	// didn't choose.
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+	response, err := server.Client().Post(server.URL+"/v1/other/Ping", "application/json", strings.NewReader("{}"))
+	assert.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
+	assert.Equal(t, response.StatusCode, http.StatusNotFound)
+}
@@ -0,0 +1,52 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverIdleTimeout       = 2 * time.Minute
+	serverMaxHeaderBytes    = 64 * 1024
+)
+
+// NewHTTPServer returns an [http.Server] with timeouts suitable for serving
+// RPCs. The zero value of http.Server has no timeouts at all, which lets
+// clients hold connections open indefinitely by trickling headers or idling.
+// Setting the obvious timeouts breaks streaming, though: ReadTimeout and
+// WriteTimeout limit the entire request and response, so they cut off
+// long-lived streams.
+//
+// The returned server limits only the time to read request headers (10
+// seconds), the time an idle keep-alive connection stays open (2 minutes), and
+// the size of request headers (64 KiB). It leaves ReadTimeout and WriteTimeout
+// unset: use [WithStreamSendTimeout] to limit how long handlers wait for slow
+// clients, and timeouts from clients' contexts to limit the duration of RPCs.
+// Callers may adjust any of the fields before starting the server.
+//
+// To serve gRPC, which requires HTTP/2, start the server with TLS or wrap the
+// handler with golang.org/x/net/http2/h2c.
+func NewHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		IdleTimeout:       serverIdleTimeout,
+		MaxHeaderBytes:    serverMaxHeaderBytes,
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const headerServerTiming = "Server-Timing"
+
+// WithServerTiming configures a handler to report how long it spent
+// processing each RPC in a Server-Timing header, which browsers display in
+// their developer tools. The metric name must be a valid HTTP token, like
+// "rpc" or "app"; if empty, it defaults to "rpc". Durations are reported in
+// milliseconds, as in
+//
+//	Server-Timing: rpc;dur=12.345
+//
+// Unary responses (including errors) carry the timing as a header. Streaming
+// responses, including unary RPCs served by [NewDynamicHandler], send their
+// headers before the duration is known, so they carry it as a trailer
+// instead.
+//
+// The duration runs from the point where this option appears among the
+// handler's interceptors until the implementation and any later interceptors
+// return: place it before WithInterceptors to include the time spent in other
+// interceptors. It doesn't include decoding the request before the
+// interceptors run, or writing the response (or, for streams, the end of the
+// stream) afterwards. Every response carries the timing, whatever error the
+// implementation returns.
+func WithServerTiming(metric string) HandlerOption {
+	if metric == "" {
+		metric = "rpc"
+	}
+	return WithInterceptors(&serverTimingInterceptor{metric: metric})
+}
+
+type serverTimingInterceptor struct {
+	metric string
+}
+
+func (i *serverTimingInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			return next(ctx, request)
+		}
+		start := time.Now()
+		response, err := next(ctx, request)
+		// Headers set on the context are sent with errors of any type, as well
+		// as with successful responses.
+		if header, ok := ResponseHeaderFromContext(ctx); ok {
+			i.record(header, start)
+		}
+		return response, err
+	}
+}
+
+func (i *serverTimingInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *serverTimingInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		start := time.Now()
+		err := next(ctx, conn)
+		i.record(conn.ResponseTrailer(), start)
+		return err
+	}
+}
+
+func (i *serverTimingInterceptor) record(header http.Header, start time.Time) {
+	milliseconds := float64(time.Since(start)) / float64(time.Millisecond)
+	addHeaderCanonical(
+		header,
+		headerServerTiming,
+		i.metric+";dur="+strconv.FormatFloat(milliseconds, 'f', 3, 64),
+	)
+}
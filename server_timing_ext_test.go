@@ -0,0 +1,81 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestServerTiming(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				switch request.Msg.Text {
+				case "fail":
+					return nil, connect.NewError(connect.CodeInternal, errors.New("oops"))
+				case "plain":
+					return nil, errors.New("oops")
+				}
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+			countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				return stream.Send(&pingv1.CountUpResponse{})
+			},
+		},
+		connect.WithServerTiming("app"),
+	))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL)
+	const timing = `^app;dur=\d+\.\d{3}$`
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Match(t, response.Header().Get("Server-Timing"), timing)
+	})
+	t.Run("unary_error", func(t *testing.T) {
+		t.Parallel()
+		for _, text := range []string{"fail", "plain"} {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Match(t, connectErr.Meta().Get("Server-Timing"), timing)
+		}
+	})
+	t.Run("server_stream", func(t *testing.T) {
+		t.Parallel()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		for stream.Receive() {
+			assert.Zero(t, stream.ResponseHeader().Get("Server-Timing"))
+		}
+		assert.Nil(t, stream.Err())
+		assert.Match(t, stream.ResponseTrailer().Get("Server-Timing"), timing)
+		assert.Nil(t, stream.Close())
+	})
+}
@@ -0,0 +1,196 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithTokenRefresh configures a client to authenticate requests with a token
+// obtained from the refresh function. The token is sent as the value of the
+// named header (usually "Authorization"), so refresh should return the
+// complete header value, including any scheme like "Bearer ".
+//
+// The client calls refresh before its first RPC and whenever the server
+// rejects a token with CodeUnauthenticated. Concurrent RPCs share a single
+// refresh: while a new token is being fetched, other RPCs wait for it rather
+// than calling refresh themselves. Each waiting RPC gives up when its own
+// context is done, without affecting the others. Because the refresh is
+// shared, it isn't canceled with the RPC that started it: refresh receives a
+// context carrying that RPC's values but no deadline, so it should apply its
+// own timeout.
+//
+// Unary RPCs that fail with CodeUnauthenticated are retried once with the
+// new token; if the retry also fails, its error is returned. Streaming RPCs
+// can't be replayed, so they're never retried, but the next RPC uses a fresh
+// token.
+//
+// Errors from refresh are returned from the RPC. Unless they're already
+// [*Error]s, they have CodeUnauthenticated.
+func WithTokenRefresh(refresh func(context.Context) (string, error), header string) ClientOption {
+	return WithInterceptors(&tokenRefreshInterceptor{
+		refresh: refresh,
+		header:  http.CanonicalHeaderKey(header),
+	})
+}
+
+type tokenRefreshInterceptor struct {
+	refresh func(context.Context) (string, error)
+	header  string
+
+	mu    sync.Mutex
+	token string
+	// Non-nil while a refresh is in flight.
+	refreshing *tokenRefresh
+}
+
+// tokenRefresh is a single call to the refresh function, shared by all the
+// RPCs waiting for it.
+type tokenRefresh struct {
+	done  chan struct{} // closed once token and err are set
+	token string
+	err   error
+}
+
+func (i *tokenRefreshInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if !request.Spec().IsClient {
+			return next(ctx, request)
+		}
+		token, err := i.currentToken(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		request.Header().Set(i.header, token)
+		response, err := next(ctx, request)
+		if CodeOf(err) != CodeUnauthenticated {
+			return response, err
+		}
+		token, err = i.currentToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		request.Header().Set(i.header, token)
+		return next(ctx, request)
+	}
+}
+
+func (i *tokenRefreshInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		conn := next(ctx, spec)
+		token, err := i.currentToken(ctx, "")
+		if err != nil {
+			return &erroredStreamingClientConn{StreamingClientConn: conn, err: err}
+		}
+		conn.RequestHeader().Set(i.header, token)
+		return &tokenRefreshStreamingClientConn{StreamingClientConn: conn, interceptor: i, token: token}
+	}
+}
+
+func (i *tokenRefreshInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return next
+}
+
+// currentToken returns the cached token, refreshing it if there's no cached
+// token or the cached token is the rejected one. Concurrent callers share a
+// single refresh, but each stops waiting when its own context is done.
+func (i *tokenRefreshInterceptor) currentToken(ctx context.Context, rejected string) (string, error) {
+	i.mu.Lock()
+	if i.token != "" && i.token != rejected {
+		token := i.token
+		i.mu.Unlock()
+		return token, nil
+	}
+	refresh := i.refreshing
+	if refresh == nil {
+		refresh = &tokenRefresh{done: make(chan struct{})}
+		i.refreshing = refresh
+		go i.runRefresh(valueOnlyContext{ctx}, refresh)
+	}
+	i.mu.Unlock()
+	select {
+	case <-refresh.done:
+		return refresh.token, refresh.err
+	case <-ctx.Done():
+		return "", wrapIfContextError(ctx.Err())
+	}
+}
+
+func (i *tokenRefreshInterceptor) runRefresh(ctx context.Context, refresh *tokenRefresh) {
+	token, err := i.refresh(ctx)
+	if err != nil {
+		if connectErr, ok := asError(err); ok {
+			refresh.err = connectErr
+		} else {
+			refresh.err = errorf(CodeUnauthenticated, "refresh token: %w", err)
+		}
+	}
+	refresh.token = token
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if refresh.err == nil {
+		i.token = token
+	}
+	i.refreshing = nil
+	close(refresh.done)
+}
+
+// invalidate discards the token if it's still cached, so that the next RPC
+// fetches a new one.
+func (i *tokenRefreshInterceptor) invalidate(token string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.token == token {
+		i.token = ""
+	}
+}
+
+// tokenRefreshStreamingClientConn watches for streams rejected with
+// CodeUnauthenticated.
+type tokenRefreshStreamingClientConn struct {
+	StreamingClientConn
+
+	interceptor *tokenRefreshInterceptor
+	token       string
+}
+
+func (c *tokenRefreshStreamingClientConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	if CodeOf(err) == CodeUnauthenticated {
+		c.interceptor.invalidate(c.token)
+	}
+	return err
+}
+
+// valueOnlyContext keeps a context's values but not its deadline or
+// cancelation.
+type valueOnlyContext struct {
+	context.Context
+}
+
+func (valueOnlyContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (valueOnlyContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (valueOnlyContext) Err() error {
+	return nil
+}
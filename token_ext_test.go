@@ -0,0 +1,192 @@
+// Copyright 2021-2023 Buf Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/bufbuild/connect-go/internal/assert"
+	pingv1 "github.com/bufbuild/connect-go/internal/gen/connect/ping/v1"
+	"github.com/bufbuild/connect-go/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestTokenRefresh(t *testing.T) {
+	t.Parallel()
+	// The server accepts only the most recently issued token, and the
+	// authorization server issues tokens with increasing serial numbers.
+	type tokenServer struct {
+		issued   int32
+		accepted int32
+	}
+	newServer := func(t *testing.T, tokens *tokenServer) *httptest.Server {
+		t.Helper()
+		authenticate := func(header http.Header) error {
+			want := fmt.Sprintf("Bearer %d", atomic.LoadInt32(&tokens.accepted))
+			if got := header.Get("Authorization"); got != want {
+				return connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("got token %q", got))
+			}
+			return nil
+		}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				if err := authenticate(request.Header()); err != nil {
+					return nil, err
+				}
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+			countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				if err := authenticate(request.Header()); err != nil {
+					return err
+				}
+				return stream.Send(&pingv1.CountUpResponse{})
+			},
+		}))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server
+	}
+	newClient := func(server *httptest.Server, tokens *tokenServer) pingv1connect.PingServiceClient {
+		refresh := func(context.Context) (string, error) {
+			serial := atomic.AddInt32(&tokens.issued, 1)
+			atomic.StoreInt32(&tokens.accepted, serial)
+			return fmt.Sprintf("Bearer %d", serial), nil
+		}
+		return pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithTokenRefresh(refresh, "Authorization"),
+		)
+	}
+	ping := func(client pingv1connect.PingServiceClient) error {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		return err
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		var tokens tokenServer
+		client := newClient(newServer(t, &tokens), &tokens)
+		assert.Nil(t, ping(client))
+		assert.Nil(t, ping(client))
+		assert.Equal(t, atomic.LoadInt32(&tokens.issued), 1)
+		// Revoke the token: the next call should refresh and retry.
+		atomic.StoreInt32(&tokens.accepted, -1)
+		assert.Nil(t, ping(client))
+		assert.Equal(t, atomic.LoadInt32(&tokens.issued), 2)
+	})
+	t.Run("single_flight", func(t *testing.T) {
+		t.Parallel()
+		var tokens tokenServer
+		client := newClient(newServer(t, &tokens), &tokens)
+		assert.Nil(t, ping(client))
+		atomic.StoreInt32(&tokens.accepted, -1)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Nil(t, ping(client))
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, atomic.LoadInt32(&tokens.issued), 2)
+	})
+	t.Run("waiter_context", func(t *testing.T) {
+		t.Parallel()
+		var tokens tokenServer
+		server := newServer(t, &tokens)
+		unblock := make(chan struct{})
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithTokenRefresh(func(ctx context.Context) (string, error) {
+				<-unblock
+				// The refresh isn't canceled with the RPC that started it.
+				if err := ctx.Err(); err != nil {
+					return "", err
+				}
+				serial := atomic.AddInt32(&tokens.issued, 1)
+				atomic.StoreInt32(&tokens.accepted, serial)
+				return fmt.Sprintf("Bearer %d", serial), nil
+			}, "Authorization"),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		close(unblock)
+		assert.Nil(t, ping(client))
+		assert.Equal(t, atomic.LoadInt32(&tokens.issued), 1)
+	})
+	t.Run("retry_once", func(t *testing.T) {
+		t.Parallel()
+		var tokens tokenServer
+		server := newServer(t, &tokens)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithTokenRefresh(func(context.Context) (string, error) {
+				// Issue tokens that the server never accepts.
+				return fmt.Sprintf("Bearer stale-%d", atomic.AddInt32(&tokens.issued, 1)), nil
+			}, "Authorization"),
+		)
+		assert.Equal(t, connect.CodeOf(ping(client)), connect.CodeUnauthenticated)
+		assert.Equal(t, atomic.LoadInt32(&tokens.issued), 2)
+	})
+	t.Run("refresh_error", func(t *testing.T) {
+		t.Parallel()
+		var tokens tokenServer
+		server := newServer(t, &tokens)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL,
+			connect.WithTokenRefresh(func(context.Context) (string, error) {
+				return "", errors.New("oops")
+			}, "Authorization"),
+		)
+		assert.Equal(t, connect.CodeOf(ping(client)), connect.CodeUnauthenticated)
+		_, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnauthenticated)
+	})
+	t.Run("streaming", func(t *testing.T) {
+		t.Parallel()
+		var tokens tokenServer
+		client := newClient(newServer(t, &tokens), &tokens)
+		assert.Nil(t, ping(client))
+		atomic.StoreInt32(&tokens.accepted, -1)
+		countUp := func() error {
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			defer stream.Close()
+			for stream.Receive() {
+			}
+			return stream.Err()
+		}
+		// Streams aren't retried, but the rejected token is discarded.
+		assert.Equal(t, connect.CodeOf(countUp()), connect.CodeUnauthenticated)
+		assert.Nil(t, countUp())
+		assert.Equal(t, atomic.LoadInt32(&tokens.issued), 2)
+	})
+}